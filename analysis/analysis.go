@@ -0,0 +1,179 @@
+// Package analysis defines the interface between a modular static
+// analysis of gotex sources and an analysis driver, modeled on the Go
+// package golang.org/x/tools/go/analysis.
+//
+// An [Analyzer] describes an analysis: its name, its documentation and the
+// function that runs it on a [Pass], which holds a parsed file, its source
+// and the signatures of the commands it may use. The analysis reports
+// positioned [Diagnostic] values, each with optional [SuggestedFix] values
+// that a driver may apply as text edits. An analyzer may require others
+// and use their results, computed once per file.
+//
+// A [Checker] is a driver: it runs a set of analyzers on a file and
+// filters their diagnostics by the [Config] of the module and the
+// %gotex:ignore directives of the file. A directive names the analyzers
+// to silence, separated by spaces or commas; a name like "typography"
+// silences a whole group of analyzers like "typography/dash":
+//
+//	He said "so".  %gotex:ignore typography/quotes
+//
+//	%gotex:ignore typography/dash
+//	pages 3-5
+//
+// A directive after text on a line applies to that line; a directive on a
+// line of its own applies to the next line that is not a comment. A
+// %gotex:ignore-file directive applies to the whole file.
+//
+// The built-in analyzers are in the subdirectories of passes.
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/token"
+)
+
+// An Analyzer describes an analysis function and its options.
+type Analyzer struct {
+	// Name is the name of the analyzer, like "commands", or a name
+	// within a group, like "typography/dash". It is used in
+	// %gotex:ignore directives and in the configuration.
+	Name string
+
+	// Doc is the documentation of the analyzer. The first line is a
+	// summary.
+	Doc string
+
+	// Run applies the analyzer to a file. It reports its findings with
+	// pass.Report and returns a result for the analyzers requiring it;
+	// an error means the analysis could not be completed.
+	Run func(pass *Pass) (any, error)
+
+	// Requires lists the analyzers whose results this one uses. The
+	// driver runs them on the file first, once however many analyzers
+	// require them, and passes their results in Pass.ResultOf.
+	Requires []*Analyzer
+}
+
+func (a *Analyzer) String() string { return a.Name }
+
+// A Pass provides information to the Run function that applies a
+// specific analyzer to a single file.
+type Pass struct {
+	Analyzer *Analyzer
+
+	Fset      *token.FileSet
+	File      *ast.File   // syntax tree of the file, parsed in full mode
+	TokenFile *token.File // token.File of the file
+	Src       []byte      // source of the file
+
+	// Commands holds the signatures of the commands known to the file:
+	// those built into the engine and declared by its module. The
+	// macros defined in the file are in File.Macros.
+	Commands *command.Registry
+
+	// Imports holds the files whose definitions are visible in the
+	// file, like the other files of its document.
+	Imports []*ast.File
+
+	// ResultOf holds the results of the analyzers in Analyzer.Requires.
+	ResultOf map[*Analyzer]any
+
+	// Report reports a diagnostic.
+	Report func(Diagnostic)
+}
+
+// Reportf reports a diagnostic at pos with a formatted message.
+func (pass *Pass) Reportf(pos token.Pos, format string, args ...any) {
+	pass.Report(Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// Text returns the source text between pos and end.
+func (pass *Pass) Text(pos, end token.Pos) string {
+	base := pass.TokenFile.Base()
+	return string(pass.Src[int(pos)-base : int(end)-base])
+}
+
+// A Diagnostic is a message associated with a source location or range.
+type Diagnostic struct {
+	Pos     token.Pos
+	End     token.Pos // optional
+	Message string
+
+	// SuggestedFixes are alternative ways to fix the problem; a driver
+	// applies at most one of them.
+	SuggestedFixes []SuggestedFix
+
+	// Analyzer is the analyzer reporting the diagnostic. It is set by
+	// the driver.
+	Analyzer *Analyzer
+}
+
+// A SuggestedFix is a change to the source that fixes a diagnostic.
+type SuggestedFix struct {
+	Message   string // describes the fix, like "Replace with \\dots"
+	TextEdits []TextEdit
+}
+
+// A TextEdit replaces the source between Pos and End by NewText. If End is
+// Pos, NewText is inserted at Pos.
+type TextEdit struct {
+	Pos     token.Pos
+	End     token.Pos
+	NewText []byte
+}
+
+var validName = regexp.MustCompile(`^[a-z][a-z0-9]*(/[a-z][a-z0-9]*)*$`)
+
+// Validate reports an error if an analyzer or one it requires is
+// malformed: if its name is not lower-case words separated by slashes, it
+// has no documentation or Run function, two analyzers have the same name,
+// or an analyzer requires itself, directly or not.
+func Validate(analyzers []*Analyzer) error {
+	names := make(map[string]bool)
+	done := make(map[*Analyzer]bool) // false while visiting its requirements
+	var visit func(a *Analyzer) error
+	visit = func(a *Analyzer) error {
+		if finished, ok := done[a]; ok {
+			if !finished {
+				return fmt.Errorf("analyzer %s requires itself", a.Name)
+			}
+			return nil
+		}
+		switch {
+		case !validName.MatchString(a.Name):
+			return fmt.Errorf("invalid analyzer name %q", a.Name)
+		case a.Doc == "":
+			return fmt.Errorf("analyzer %s is undocumented", a.Name)
+		case a.Run == nil:
+			return fmt.Errorf("analyzer %s has no Run function", a.Name)
+		case names[a.Name]:
+			return fmt.Errorf("duplicate analyzer %s", a.Name)
+		}
+		names[a.Name] = true
+		done[a] = false
+		for _, req := range a.Requires {
+			if err := visit(req); err != nil {
+				return err
+			}
+		}
+		done[a] = true
+		return nil
+	}
+	for _, a := range analyzers {
+		if err := visit(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the analyzer named name is selected by pattern:
+// its name, or the name of a group it belongs to.
+func Matches(pattern, name string) bool {
+	return len(name) >= len(pattern) && name[:len(pattern)] == pattern &&
+		(len(name) == len(pattern) || name[len(pattern)] == '/')
+}
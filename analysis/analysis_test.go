@@ -0,0 +1,219 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// word reports each occurrence of a word in the source, with a fix
+// replacing it.
+func word(name, w, replacement string) *Analyzer {
+	return &Analyzer{
+		Name: name,
+		Doc:  "report " + w,
+		Run: func(pass *Pass) (any, error) {
+			base := token.Pos(pass.TokenFile.Base())
+			src := string(pass.Src)
+			for offs := 0; ; {
+				i := strings.Index(src[offs:], w)
+				if i < 0 {
+					return nil, nil
+				}
+				pos := base + token.Pos(offs+i)
+				end := pos + token.Pos(len(w))
+				pass.Report(Diagnostic{
+					Pos:     pos,
+					End:     end,
+					Message: fmt.Sprintf("found %s", w),
+					SuggestedFixes: []SuggestedFix{{
+						Message:   "Replace with " + replacement,
+						TextEdits: []TextEdit{{Pos: pos, End: end, NewText: []byte(replacement)}},
+					}},
+				})
+				offs += i + len(w)
+			}
+		},
+	}
+}
+
+// parse parses src and returns a function running a checker on it.
+func parse(t *testing.T, src string) (*token.FileSet, *token.File, func(c *Checker) ([]Diagnostic, error)) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	f, err := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, file, func(c *Checker) ([]Diagnostic, error) {
+		return c.File(fset, f, file, []byte(src))
+	}
+}
+
+func TestChecker(t *testing.T) {
+	src := `foo bar
+foo bar %gotex:ignore style/foo
+%gotex:ignore style
+% another comment
+foo bar
+foo bar
+%gotex:ignore-file nobar
+`
+	fset, _, run := parse(t, src)
+	c := &Checker{Analyzers: []*Analyzer{
+		word("style/foo", "foo", "baz"),
+		word("nobar", "bar", "qux"),
+	}}
+	diags, err := run(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, fmt.Sprintf("%d:%d %s %s", fset.Position(d.Pos).Line, fset.Position(d.Pos).Column, d.Analyzer, d.Message))
+	}
+	want := "1:1 style/foo found foo, 6:1 style/foo found foo"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("got %s; want %s", strings.Join(got, ", "), want)
+	}
+
+	c.Config = &Config{Settings: map[string]bool{"style": false}}
+	if diags, _ := run(c); len(diags) != 0 {
+		t.Errorf("disabled analyzer reported %v", diags)
+	}
+
+	c.Analyzers = append(c.Analyzers, &Analyzer{Name: "fail", Doc: "fail", Run: func(*Pass) (any, error) { return nil, errors.New("broken") }})
+	if _, err := run(c); err == nil || err.Error() != "fail: broken" {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestRequires(t *testing.T) {
+	_, _, run := parse(t, "foo bar foo")
+	runs := 0
+	count := &Analyzer{
+		Name: "count",
+		Doc:  "count words",
+		Run: func(pass *Pass) (any, error) {
+			runs++
+			pass.Reportf(pass.File.Pos(), "counted")
+			return len(strings.Fields(string(pass.Src))), nil
+		},
+	}
+	var got []any
+	user := func(name string) *Analyzer {
+		return &Analyzer{
+			Name:     name,
+			Doc:      "use the count",
+			Requires: []*Analyzer{count},
+			Run: func(pass *Pass) (any, error) {
+				got = append(got, pass.ResultOf[count])
+				return nil, nil
+			},
+		}
+	}
+	c := &Checker{
+		Analyzers: []*Analyzer{user("a"), count, user("b")},
+		Config:    &Config{Settings: map[string]bool{"count": false}},
+	}
+	diags, err := run(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 || fmt.Sprint(got) != "[3 3]" {
+		t.Errorf("count ran %d times with results %v; want once with [3 3]", runs, got)
+	}
+	if len(diags) != 0 {
+		t.Errorf("disabled analyzer reported %v", diags)
+	}
+
+	// The analyzers requiring one that failed are not run.
+	got = nil
+	count.Run = func(*Pass) (any, error) { return nil, errors.New("broken") }
+	if _, err := run(c); err == nil || err.Error() != "count: broken" || len(got) != 0 {
+		t.Errorf("got error %v and results %v", err, got)
+	}
+}
+
+func TestApplyFixes(t *testing.T) {
+	src := "foo food bar\n%gotex:ignore style\nfoo"
+	_, file, run := parse(t, src)
+	c := &Checker{Analyzers: []*Analyzer{word("style", "foo", "baz"), word("o", "oo", "0")}}
+	diags, _ := run(c)
+	out, n := ApplyFixes(file, []byte(src), diags)
+	if n != 3 {
+		t.Errorf("applied %d fixes; want 3", n)
+	}
+	if want := "baz bazd bar\n%gotex:ignore style\nf0"; string(out) != want {
+		t.Errorf("got %q; want %q", out, want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	run := func(*Pass) (any, error) { return nil, nil }
+	self := &Analyzer{Name: "self", Doc: "d", Run: run}
+	self.Requires = []*Analyzer{{Name: "req", Doc: "d", Run: run, Requires: []*Analyzer{self}}}
+	for _, test := range []struct {
+		analyzers []*Analyzer
+		err       string
+	}{
+		{[]*Analyzer{{Name: "a", Doc: "d", Run: run}, {Name: "g/b2", Doc: "d", Run: run}}, ""},
+		{[]*Analyzer{{Name: "A", Doc: "d", Run: run}}, `invalid analyzer name "A"`},
+		{[]*Analyzer{{Name: "g/", Doc: "d", Run: run}}, `invalid analyzer name "g/"`},
+		{[]*Analyzer{{Name: "a", Run: run}}, "analyzer a is undocumented"},
+		{[]*Analyzer{{Name: "a", Doc: "d"}}, "analyzer a has no Run function"},
+		{[]*Analyzer{{Name: "a", Doc: "d", Run: run}, {Name: "a", Doc: "d", Run: run}}, "duplicate analyzer a"},
+		{[]*Analyzer{{Name: "a", Doc: "d", Run: run, Requires: []*Analyzer{{Name: "B", Doc: "d", Run: run}}}}, `invalid analyzer name "B"`},
+		{[]*Analyzer{self}, "analyzer self requires itself"},
+	} {
+		err := Validate(test.analyzers)
+		if got := fmt.Sprint(err); err == nil && test.err != "" || err != nil && got != test.err {
+			t.Errorf("Validate(%v) = %v; want %q", test.analyzers, err, test.err)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	data := `[commands]
+x = "m"
+
+[vet]
+typography = false   # too noisy
+"typography/dash" = true
+labels = maybe
+"labels#x" = false # "#" in a quoted name is not a comment
+`
+	cfg, err := ParseConfig("gotex.mod", []byte(data))
+	list, _ := err.(scanner.ErrorList)
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"gotex.mod:7:1: labels: expected true or false",
+		`gotex.mod:8:1: invalid analyzer name "labels#x"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for name, want := range map[string]bool{
+		"typography":        false,
+		"typography/quotes": false,
+		"typography/dash":   true,
+		"typographyx":       true,
+		"labels":            true,
+	} {
+		if got := cfg.Enabled(name); got != want {
+			t.Errorf("Enabled(%q) = %v; want %v", name, got, want)
+		}
+	}
+	if !(*Config)(nil).Enabled("labels") {
+		t.Errorf("nil config disables analyzers")
+	}
+}
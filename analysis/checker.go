@@ -0,0 +1,164 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/token"
+)
+
+// A Checker runs analyzers on files.
+type Checker struct {
+	Analyzers []*Analyzer
+
+	// Config enables and disables analyzers. If nil, all analyzers
+	// are enabled.
+	Config *Config
+
+	// Commands holds the signatures of the commands known to the
+	// files. If nil, command.Default() is used.
+	Commands *command.Registry
+
+	// Imports holds the files whose definitions are visible in the
+	// checked files, like the other files of their document.
+	Imports []*ast.File
+}
+
+// File runs the enabled analyzers on f, parsed in full mode from src, and
+// returns the diagnostics not silenced by a %gotex:ignore directive,
+// sorted by position. The analyzers they require run first, whether
+// enabled or not; only their results are used. The errors of analyzers
+// that failed are joined into the returned error; the analyzers
+// requiring them are not run.
+func (c *Checker) File(fset *token.FileSet, f *ast.File, file *token.File, src []byte) ([]Diagnostic, error) {
+	commands := c.Commands
+	if commands == nil {
+		commands = command.Default()
+	}
+	ignores := directives(f, file, src)
+
+	// Each analyzer runs once, after those it requires.
+	var order []*Analyzer
+	enabled := make(map[*Analyzer]bool)
+	seen := make(map[*Analyzer]bool)
+	var visit func(a *Analyzer)
+	visit = func(a *Analyzer) {
+		if seen[a] {
+			return
+		}
+		seen[a] = true
+		for _, req := range a.Requires {
+			visit(req)
+		}
+		order = append(order, a)
+	}
+	for _, a := range c.Analyzers {
+		if c.Config.Enabled(a.Name) {
+			enabled[a] = true
+			visit(a)
+		}
+	}
+
+	var (
+		diags   []Diagnostic
+		errs    []error
+		results = make(map[*Analyzer]any)
+	)
+run:
+	for _, a := range order {
+		for _, req := range a.Requires {
+			if _, ok := results[req]; !ok {
+				continue run
+			}
+		}
+		pass := &Pass{
+			Analyzer:  a,
+			Fset:      fset,
+			File:      f,
+			TokenFile: file,
+			Src:       src,
+			Commands:  commands,
+			Imports:   c.Imports,
+			ResultOf:  results,
+		}
+		pass.Report = func(d Diagnostic) {
+			if enabled[a] && !ignores.silence(a.Name, file.PositionFor(d.Pos, false).Line) {
+				d.Analyzer = a
+				diags = append(diags, d)
+			}
+		}
+		result, err := a.Run(pass)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", a.Name, err))
+			continue
+		}
+		results[a] = result
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Pos < diags[j].Pos })
+	return diags, errors.Join(errs...)
+}
+
+// An ignore is a %gotex:ignore directive.
+type ignore struct {
+	line  int // line silenced, or 0 for the whole file
+	names []string
+}
+
+type ignoreList []ignore
+
+// directives returns the %gotex:ignore directives of f.
+func directives(f *ast.File, file *token.File, src []byte) ignoreList {
+	var list ignoreList
+	for _, d := range f.Directives {
+		if d.Kind != ast.GotexIgnore {
+			continue
+		}
+		ig := ignore{names: strings.FieldsFunc(d.Value, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' })}
+		if d.Key == "ignore" {
+			ig.line = silencedLine(file, src, d.Pos())
+		}
+		list = append(list, ig)
+	}
+	return list
+}
+
+// silencedLine returns the line silenced by a directive at pos: its own
+// line if text precedes it, or else the next line that is not a comment.
+func silencedLine(file *token.File, src []byte, pos token.Pos) int {
+	line := file.PositionFor(pos, false).Line
+	start := int(file.LineStart(line)) - file.Base()
+	if strings.TrimSpace(string(src[start:int(pos)-file.Base()])) != "" {
+		return line
+	}
+	for line++; line <= file.LineCount(); line++ {
+		start := int(file.LineStart(line)) - file.Base()
+		end := len(src)
+		if line < file.LineCount() {
+			end = int(file.LineStart(line+1)) - file.Base()
+		}
+		if !strings.HasPrefix(strings.TrimLeft(string(src[start:end]), " \t"), "%") {
+			break
+		}
+	}
+	return line
+}
+
+// silence reports whether the diagnostics of the analyzer name on line
+// are silenced.
+func (list ignoreList) silence(name string, line int) bool {
+	for _, ig := range list {
+		if ig.line != 0 && ig.line != line {
+			continue
+		}
+		for _, pattern := range ig.names {
+			if Matches(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
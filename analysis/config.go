@@ -0,0 +1,62 @@
+package analysis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/neox5/gotex/command"
+)
+
+// A Config enables and disables analyzers.
+type Config struct {
+	// Settings maps names of analyzers and groups of analyzers to
+	// whether they are enabled.
+	Settings map[string]bool
+}
+
+// Enabled reports whether the analyzer named name is enabled: by the
+// setting of its name, or else by that of the innermost group with a
+// setting. Analyzers without setting are enabled, as are all analyzers of
+// a nil Config.
+func (c *Config) Enabled(name string) bool {
+	if c == nil {
+		return true
+	}
+	for {
+		if on, ok := c.Settings[name]; ok {
+			return on
+		}
+		i := strings.LastIndexByte(name, '/')
+		if i < 0 {
+			return true
+		}
+		name = name[:i]
+	}
+}
+
+// ParseConfig returns the configuration in the [vet] table of a gotex.mod
+// file. Each entry maps the name of an analyzer or a group to true or
+// false; names with slashes must be quoted:
+//
+//	[vet]
+//	typography = false
+//	"typography/dash" = true
+//
+// Other tables are ignored. The file is read, and errors are returned,
+// as by [command.ReadMod].
+func ParseConfig(filename string, data []byte) (*Config, error) {
+	cfg := &Config{Settings: make(map[string]bool)}
+	err := command.ReadMod(filename, data, "vet", func(name, value string) error {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("invalid analyzer name %q", name)
+		}
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: expected true or false", name)
+		}
+		cfg.Settings[name] = on
+		return nil
+	})
+	return cfg, err
+}
@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/neox5/gotex/token"
+)
+
+// ApplyFixes applies the first suggested fix of each diagnostic to src,
+// the source of file, and returns the new source and the number of fixes
+// applied. A fix with an edit overlapping an edit of a fix applied before
+// is skipped, as is a fix with an edit outside of file; running the
+// analyzers again may then find it anew.
+func ApplyFixes(file *token.File, src []byte, diags []Diagnostic) ([]byte, int) {
+	base := token.Pos(file.Base())
+	var edits []TextEdit
+	n := 0
+	for _, d := range diags {
+		if len(d.SuggestedFixes) == 0 {
+			continue
+		}
+		fix := d.SuggestedFixes[0].TextEdits
+		ok := true
+		for _, e := range fix {
+			if e.Pos < base || e.End < e.Pos || int(e.End-base) > len(src) {
+				ok = false
+			}
+			for _, applied := range edits {
+				if overlap(e, applied) {
+					ok = false
+				}
+			}
+		}
+		if ok {
+			edits = append(edits, fix...)
+			n++
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Pos < edits[j].Pos })
+
+	var out bytes.Buffer
+	offs := 0
+	for _, e := range edits {
+		out.Write(src[offs : e.Pos-base])
+		out.Write(e.NewText)
+		offs = int(e.End - base)
+	}
+	out.Write(src[offs:])
+	return out.Bytes(), n
+}
+
+// overlap reports whether two edits change the same text or insert text
+// at the same position, so that their order would be ambiguous.
+func overlap(a, b TextEdit) bool {
+	return a.Pos < b.End && b.Pos < a.End || a.Pos == b.Pos
+}
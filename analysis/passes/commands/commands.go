@@ -0,0 +1,53 @@
+// Package commands defines an analyzer reporting undefined commands and
+// calls with missing arguments.
+package commands
+
+import (
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/check"
+	"github.com/neox5/gotex/token"
+)
+
+const Doc = `report undefined commands and missing arguments
+
+The commands analyzer reports commands that are neither built into the
+engine, declared by the module nor defined in the document, and calls
+with fewer mandatory arguments than the command takes. For a misspelled
+command, it suggests the defined command with the closest name.`
+
+var Analyzer = &analysis.Analyzer{
+	Name: "commands",
+	Doc:  Doc,
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	c := &check.Checker{Fset: pass.Fset, Commands: pass.Commands, Imports: pass.Imports}
+	errs, _ := c.File(pass.TokenFile, pass.Src) // syntax errors are reported by the driver
+	for _, e := range errs {
+		pos := pass.TokenFile.Pos(e.Pos.Offset)
+		d := analysis.Diagnostic{Pos: pos, Message: e.Msg}
+		if e.Suggestion != "" {
+			// The position is that of the backslash of the command.
+			end := pos + 1 + token.Pos(nameLen(pass.Src[e.Pos.Offset+1:]))
+			d.Message += " (did you mean \\" + e.Suggestion + "?)"
+			d.SuggestedFixes = []analysis.SuggestedFix{{
+				Message:   "Replace with \\" + e.Suggestion,
+				TextEdits: []analysis.TextEdit{{Pos: pos + 1, End: end, NewText: []byte(e.Suggestion)}},
+			}}
+			d.End = end
+		}
+		pass.Report(d)
+	}
+	return nil, nil
+}
+
+// nameLen returns the length of the command name at the start of src: a
+// run of letters and @.
+func nameLen(src []byte) int {
+	n := 0
+	for n < len(src) && (src[n] == '@' || 'a' <= src[n] && src[n] <= 'z' || 'A' <= src[n] && src[n] <= 'Z') {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/token"
+)
+
+func TestAnalyzer(t *testing.T) {
+	src := "\\newcommand{\\twice}[1]{#1#1}\n\\secton{Intro} \\twice\n"
+	fset := token.NewFileSet()
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	f, err := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &analysis.Checker{Analyzers: []*analysis.Analyzer{Analyzer}}
+	diags, err := c.File(fset, f, file, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"doc.tex:2:1: undefined command \\secton (did you mean \\section?)",
+		"doc.tex:2:16: not enough arguments in call to \\twice (have 0, want 1)",
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics; want %d", len(diags), len(want))
+	}
+	for i, d := range diags {
+		if got := fset.Position(d.Pos).String() + ": " + d.Message; got != want[i] {
+			t.Errorf("got %s; want %s", got, want[i])
+		}
+	}
+
+	out, n := analysis.ApplyFixes(file, []byte(src), diags)
+	if want := "\\newcommand{\\twice}[1]{#1#1}\n\\section{Intro} \\twice\n"; n != 1 || string(out) != want {
+		t.Errorf("applied %d fixes: %q", n, out)
+	}
+}
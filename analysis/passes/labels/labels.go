@@ -0,0 +1,37 @@
+// Package labels defines an analyzer reporting labels defined twice.
+package labels
+
+import (
+	"fmt"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/xref"
+)
+
+const Doc = `report labels defined more than once
+
+The labels analyzer reports each \label of a file whose name is
+defined before in the same file. References resolve to the first
+definition, so the later ones cannot be referenced.`
+
+var Analyzer = &analysis.Analyzer{
+	Name: "labels",
+	Doc:  Doc,
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	x := xref.NewIndex(pass.Fset)
+	x.Commands = pass.Commands
+	x.AddFile(pass.File, pass.TokenFile, pass.Src)
+	for _, l := range x.Labels {
+		if first := x.Lookup(l.Name)[0]; first != l {
+			pass.Report(analysis.Diagnostic{
+				Pos:     l.Pos,
+				End:     l.End,
+				Message: fmt.Sprintf("duplicate label %q (first defined at %s)", l.Name, pass.Fset.Position(first.Pos)),
+			})
+		}
+	}
+	return nil, nil
+}
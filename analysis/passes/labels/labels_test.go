@@ -0,0 +1,28 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/token"
+)
+
+func TestAnalyzer(t *testing.T) {
+	src := "\\section{A}\\label{sec}\n\\section{B}\\label{sec} \\label{other}\n"
+	fset := token.NewFileSet()
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	f, err := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &analysis.Checker{Analyzers: []*analysis.Analyzer{Analyzer}}
+	diags, err := c.File(fset, f, file, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `doc.tex:2:19: duplicate label "sec" (first defined at doc.tex:1:19)`
+	if len(diags) != 1 || fset.Position(diags[0].Pos).String()+": "+diags[0].Message != want {
+		t.Errorf("got %v; want %s", diags, want)
+	}
+}
@@ -0,0 +1,301 @@
+package typography
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// An item is a token of the running text of a file.
+type item struct {
+	pos, end token.Pos // source span; that of a command includes its skipped arguments
+	tok      token.Token
+	lit      string
+	math     bool // in math mode
+}
+
+// A display is a $$...$$ display.
+type display struct {
+	open, close token.Pos // positions of the dollar signs; close is NoPos if unclosed
+}
+
+// text holds the running text of a file.
+type text struct {
+	pass     *analysis.Pass
+	items    []item
+	displays []display
+}
+
+// gap returns the source between two items.
+func (t *text) gap(a, b item) string {
+	return t.pass.Text(a.end, b.pos)
+}
+
+// byteAt returns the source byte at pos, or 0 outside of the file.
+func (t *text) byteAt(pos token.Pos) byte {
+	offs := int(pos) - t.pass.TokenFile.Base()
+	if offs < 0 || offs >= len(t.pass.Src) {
+		return 0
+	}
+	return t.pass.Src[offs]
+}
+
+// isSpace reports whether s is nonempty white space within a paragraph:
+// spaces and tabs with at most one line break.
+func isSpace(s string) bool {
+	return s != "" && strings.Trim(s, " \t\r\n") == "" && strings.Count(s, "\n") <= 1
+}
+
+const textDoc = `compute the running text of a file
+
+The text analyzer computes the running text the other typography
+analyzers look at, once per file. It reports nothing.`
+
+// textAnalyzer computes the running text of a file for the analyzers
+// requiring it; see runningText.
+var textAnalyzer = &analysis.Analyzer{
+	Name: "typography/text",
+	Doc:  textDoc,
+	Run:  runText,
+}
+
+// runningText returns the running text of the file of pass, computed by
+// textAnalyzer: its tokens except comments, verbatim text, macro
+// definitions, environment names and the arguments of commands, with
+// their math mode. The mandatory arguments of commands whose signature
+// has a Content mode, like \emph and \text, are running text in that
+// mode, as are the bodies of environments like equation.
+func runningText(pass *analysis.Pass) *text {
+	return pass.ResultOf[textAnalyzer].(*text)
+}
+
+func runText(pass *analysis.Pass) (any, error) {
+	t := &text{pass: pass}
+	b := &textBuilder{t: t, ends: make(map[token.Pos]token.Pos)}
+	b.display = -1
+	b.collect(pass.File)
+	b.scan()
+	return t, nil
+}
+
+// A span is a range [start, end) of the source.
+type span struct {
+	start, end token.Pos
+	math       bool // for a span of its own mode, whether it is math mode
+}
+
+func sortSpans(spans []span) {
+	// Of two spans starting together, the outer one comes first.
+	slices.SortStableFunc(spans, func(a, b span) int {
+		if a.start != b.start {
+			return int(a.start - b.start)
+		}
+		return int(b.end - a.end)
+	})
+}
+
+// delims is the state of the math delimiters $, $$, \( and \[.
+type delims struct {
+	inline, bracket bool
+	display         int // index of the open display in t.displays, or -1
+}
+
+// A frame is a span of its own mode that encloses the current token.
+type frame struct {
+	end   token.Pos
+	math  bool
+	outer delims // state of the delimiters outside of the span
+}
+
+// textBuilder collects the running text of a file.
+type textBuilder struct {
+	t *text
+
+	skip   []span                  // source not to scan: verbatim text and definitions
+	hidden []span                  // source that is not running text
+	modes  []span                  // source typeset in a mode of its own
+	ends   map[token.Pos]token.Pos // ends of commands whose arguments are all hidden, by position
+
+	hiddenEnd token.Pos // end of the hidden spans started so far
+	stack     []frame
+	delims
+	second bool // the current token is the second dollar of $$
+}
+
+// collect records the parts of the source that are not running text and
+// those typeset in a mode of their own, as told by the Content of the
+// signatures of commands and environments.
+func (b *textBuilder) collect(f *ast.File) {
+	commands := b.t.pass.Commands
+	var envs []*ast.Command // open environments
+	closeEnvs := func(envs []*ast.Command, end token.Pos) {
+		for _, begin := range envs {
+			if sig := commands.Lookup(begin.Arg(0).Lit); sig != nil && sig.Content != 0 {
+				b.modes = append(b.modes, span{begin.End(), end, sig.Content == command.MathMode})
+			}
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Verbatim:
+			// Skipping starts after \begin or \verb, which are scanned.
+			b.skip = append(b.skip, span{start: n.Pos() + 1, end: n.ContentPos + token.Pos(len(n.Content))})
+			b.hidden = append(b.hidden, span{start: n.Pos(), end: n.End()})
+		case *ast.MacroDef:
+			b.skip = append(b.skip, span{start: n.Pos() + 1, end: n.End()})
+			b.hidden = append(b.hidden, span{start: n.Pos(), end: n.End()})
+		case *ast.LineBreak:
+			if n.Kind == "\\" {
+				start := n.Pos() + 2
+				if n.Star {
+					start++
+				}
+				b.hidden = append(b.hidden, span{start: start, end: n.End()}) // \\[2pt]
+			}
+		case *ast.Command:
+			switch n.Name {
+			case "begin":
+				envs = append(envs, n)
+				b.hidden = append(b.hidden, span{start: n.Pos(), end: n.End()})
+				return true
+			case "end":
+				b.hidden = append(b.hidden, span{start: n.Pos(), end: n.End()})
+				for i := len(envs) - 1; i >= 0; i-- {
+					if envs[i].Arg(0).Lit == n.Arg(0).Lit {
+						closeEnvs(envs[i:], n.Pos()) // unclosed inner environments end too
+						envs = envs[:i]
+						break
+					}
+				}
+				return true
+			}
+			sig := commands.Lookup(n.Name)
+			hidden := true
+			for _, arg := range n.Args {
+				switch {
+				case !arg.Present:
+				case arg.Kind == 'm' && sig != nil && sig.Content != 0:
+					b.modes = append(b.modes, span{arg.Pos(), arg.End(), sig.Content == command.MathMode})
+					hidden = false
+				default:
+					b.hidden = append(b.hidden, span{start: arg.Pos(), end: arg.End()})
+				}
+			}
+			if hidden {
+				b.ends[n.Pos()] = n.End()
+			}
+		}
+		return true
+	})
+	closeEnvs(envs, f.End())
+	sortSpans(b.skip)
+	sortSpans(b.hidden)
+	sortSpans(b.modes)
+}
+
+// scan scans the source and collects the items of the running text.
+func (b *textBuilder) scan() {
+	pass := b.t.pass
+	var s scanner.Scanner
+	s.Init(pass.Fset, pass.TokenFile, pass.Src, nil) // errors are reported by the parser
+	s.SetMode(scanner.TrackCatcodes)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return
+		}
+		end := s.Pos()
+		for len(b.skip) > 0 && b.skip[0].end <= end {
+			b.skip = b.skip[1:]
+		}
+		if len(b.skip) > 0 && b.skip[0].start <= end {
+			s.SkipTo(b.skip[0].end)
+			b.skip = b.skip[1:]
+		}
+		if tok == token.COMMENT || tok == token.NEWLINE || b.isHidden(pos) {
+			continue // the source between items is checked for line breaks
+		}
+		b.enter(pos)
+
+		switch tok {
+		case token.DOLLAR:
+			switch {
+			case b.second:
+				b.second = false
+			case b.t.byteAt(end) == '$':
+				b.dollars(pos)
+				b.second = true
+			default:
+				b.inline = !b.inline
+			}
+		case token.CONTROL_SYMBOL:
+			switch lit {
+			case "(", ")":
+				b.inline = lit == "("
+			case "[", "]":
+				b.bracket = lit == "["
+			}
+		case token.COMMAND:
+			if e, ok := b.ends[pos]; ok {
+				end = e
+			}
+		}
+		b.t.items = append(b.t.items, item{pos, end, tok, lit, b.math()})
+	}
+}
+
+// isHidden reports whether the token at pos is not running text. The
+// positions of the tokens must increase from call to call.
+func (b *textBuilder) isHidden(pos token.Pos) bool {
+	for len(b.hidden) > 0 && b.hidden[0].start <= pos {
+		b.hiddenEnd = max(b.hiddenEnd, b.hidden[0].end)
+		b.hidden = b.hidden[1:]
+	}
+	return pos < b.hiddenEnd
+}
+
+// enter leaves the spans of their own mode ending before pos and enters
+// those starting before it. Like a group in TeX, such a span starts
+// without open math delimiters and restores them at its end.
+func (b *textBuilder) enter(pos token.Pos) {
+	b.leave(pos)
+	for len(b.modes) > 0 && b.modes[0].start <= pos {
+		sp := b.modes[0]
+		b.modes = b.modes[1:]
+		if pos < sp.end {
+			b.stack = append(b.stack, frame{sp.end, sp.math, b.delims})
+			b.delims = delims{display: -1}
+		}
+	}
+}
+
+func (b *textBuilder) leave(pos token.Pos) {
+	for n := len(b.stack); n > 0 && b.stack[n-1].end <= pos; n-- {
+		b.delims = b.stack[n-1].outer
+		b.stack = b.stack[:n-1]
+	}
+}
+
+func (b *textBuilder) math() bool {
+	if n := len(b.stack); n > 0 && b.stack[n-1].math {
+		return true
+	}
+	return b.inline || b.bracket || b.display >= 0
+}
+
+// dollars handles the first dollar of $$, which opens or closes a
+// display.
+func (b *textBuilder) dollars(pos token.Pos) {
+	if b.display >= 0 {
+		b.t.displays[b.display].close = pos
+		b.display = -1
+	} else if !b.math() {
+		b.t.displays = append(b.t.displays, display{open: pos})
+		b.display = len(b.t.displays) - 1
+	}
+}
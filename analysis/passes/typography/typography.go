@@ -0,0 +1,292 @@
+// Package typography defines analyzers reporting common typographic
+// mistakes in running text, each with a suggested fix.
+//
+// The analyzers form the group "typography" and may be disabled
+// together in the [vet] table of gotex.mod or one by one, like
+// "typography/dash". They look at running text only: comments, verbatim
+// text, macro definitions and the arguments of commands like \ref and
+// \includegraphics are skipped. The registry tells which arguments and
+// environment bodies are running text, and in which mode; see the Content
+// field of command.Signature.
+package typography
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/token"
+)
+
+// Analyzers are the typography analyzers.
+var Analyzers = []*analysis.Analyzer{
+	QuotesAnalyzer,
+	TieAnalyzer,
+	DotsAnalyzer,
+	DashAnalyzer,
+	FootnoteAnalyzer,
+	DisplayMathAnalyzer,
+	SentenceAnalyzer,
+}
+
+const QuotesDoc = `report straight double quotes
+
+The quotes analyzer reports a " in text, which TeX typesets as a
+closing quote. It suggests two grave accents for an opening quote,
+after a space or an opening bracket, and two apostrophes ('') otherwise.
+A " between two letters or before one of the characters ' = - | ~ or a
+grave accent is taken to be a babel shorthand, like "a or "=.`
+
+var QuotesAnalyzer = &analysis.Analyzer{
+	Name:     "typography/quotes",
+	Doc:      QuotesDoc,
+	Run:      runQuotes,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+func runQuotes(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	for _, it := range t.items {
+		if it.tok != token.OTHER || it.lit != `"` || it.math {
+			continue
+		}
+		before, after := t.byteAt(it.pos-1), t.byteAt(it.end)
+		if isLetter(before) && isLetter(after) || strings.IndexByte("`'=-|~", after) >= 0 && after != 0 {
+			continue
+		}
+		quote, kind := "''", "a closing"
+		if before == 0 || strings.IndexByte(" \t\r\n([{~", before) >= 0 {
+			quote, kind = "``", "an opening"
+		}
+		report(pass, it.pos, it.end, fmt.Sprintf("straight double quote; use %s for %s quote", quote, kind), quote)
+	}
+	return nil, nil
+}
+
+const TieDoc = `report breakable spaces before references
+
+The tie analyzer reports a space between a word or number and \ref,
+\eqref, \pageref or \cite, as in "Figure \ref{fig}", where a line
+break would separate the reference from the word it belongs to. It
+suggests a tie (~) instead.`
+
+var TieAnalyzer = &analysis.Analyzer{
+	Name:     "typography/tie",
+	Doc:      TieDoc,
+	Run:      runTie,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+// tied are the commands to be tied to the preceding word.
+var tied = map[string]bool{"ref": true, "eqref": true, "pageref": true, "cite": true}
+
+func runTie(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	for i := 1; i < len(t.items); i++ {
+		it, prev := t.items[i], t.items[i-1]
+		if it.tok != token.COMMAND || !tied[it.lit] || it.math ||
+			prev.tok != token.WORD && prev.tok != token.NUMBER || !isSpace(t.gap(prev, it)) {
+			continue
+		}
+		report(pass, prev.end, it.pos, fmt.Sprintf(`missing non-breaking space before \%s; use ~`, it.lit), "~")
+	}
+	return nil, nil
+}
+
+const DotsDoc = `report ellipses typed as three periods
+
+The dots analyzer reports ..., whose periods TeX sets too close
+together, and suggests \dots. Before a letter, or a space in text, it
+suggests \dots{} so that the letter or space is kept.`
+
+var DotsAnalyzer = &analysis.Analyzer{
+	Name:     "typography/dots",
+	Doc:      DotsDoc,
+	Run:      runDots,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+func runDots(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	adjacent := func(i, j int) bool {
+		return 0 <= i && j < len(t.items) && t.items[i].tok == token.PERIOD &&
+			t.items[j].tok == token.PERIOD && t.items[i].end == t.items[j].pos
+	}
+	for i := 0; i+2 < len(t.items); i++ {
+		if !adjacent(i, i+1) || !adjacent(i+1, i+2) || adjacent(i-1, i) || adjacent(i+2, i+3) {
+			continue
+		}
+		first, last := t.items[i], t.items[i+2]
+		dots := `\dots`
+		if next := t.byteAt(last.end); isLetter(next) || !first.math && (next == ' ' || next == '\t' || next == '\n' || next == '\r') {
+			dots = `\dots{}`
+		}
+		report(pass, first.pos, last.end, `ellipsis typed as ...; use \dots`, dots)
+		i += 2
+	}
+	return nil, nil
+}
+
+const DashDoc = `report hyphens in number ranges
+
+The dash analyzer reports a hyphen between two numbers, as in
+"pages 3-5", and suggests an en-dash (--). Numbers joined by more than
+one hyphen, like the date 2024-01-31, are not reported.`
+
+var DashAnalyzer = &analysis.Analyzer{
+	Name:     "typography/dash",
+	Doc:      DashDoc,
+	Run:      runDash,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+func runDash(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	joined := func(i, j int) bool {
+		return 0 <= i && j < len(t.items) && t.items[i].end == t.items[j].pos
+	}
+	isDash := func(i int) bool {
+		return 0 <= i && i < len(t.items) && t.items[i].tok == token.DASH
+	}
+	for i := 0; i+2 < len(t.items); i++ {
+		lo, dash, hi := t.items[i], t.items[i+1], t.items[i+2]
+		if lo.tok != token.NUMBER || dash.tok != token.DASH || hi.tok != token.NUMBER || dash.math ||
+			!joined(i, i+1) || !joined(i+1, i+2) ||
+			isDash(i-1) && joined(i-1, i) || isDash(i+3) && joined(i+2, i+3) {
+			continue
+		}
+		report(pass, dash.pos, dash.end, "hyphen in number range; use an en-dash (--)", "--")
+	}
+	return nil, nil
+}
+
+const FootnoteDoc = `report spaces before footnotes
+
+The footnote analyzer reports a space before \footnote, which TeX
+typesets between the word and the footnote mark, and suggests removing
+it.`
+
+var FootnoteAnalyzer = &analysis.Analyzer{
+	Name:     "typography/footnote",
+	Doc:      FootnoteDoc,
+	Run:      runFootnote,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+func runFootnote(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	for i := 1; i < len(t.items); i++ {
+		it, prev := t.items[i], t.items[i-1]
+		if it.tok != token.COMMAND || it.lit != "footnote" || it.math || !isSpace(t.gap(prev, it)) {
+			continue
+		}
+		report(pass, prev.end, it.pos, `space before \footnote`, "")
+	}
+	return nil, nil
+}
+
+const DisplayMathDoc = `report $$ display math
+
+The displaymath analyzer reports displays delimited by $$, a plain TeX
+construct with wrong vertical spacing in LaTeX, and suggests \[ and \]
+instead.`
+
+var DisplayMathAnalyzer = &analysis.Analyzer{
+	Name:     "typography/displaymath",
+	Doc:      DisplayMathDoc,
+	Run:      runDisplayMath,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+func runDisplayMath(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	for _, d := range t.displays {
+		diag := analysis.Diagnostic{
+			Pos:     d.open,
+			End:     d.open + 2,
+			Message: `$$ display math; use \[ ... \]`,
+		}
+		if d.close != token.NoPos {
+			diag.SuggestedFixes = []analysis.SuggestedFix{{
+				Message: `Replace with \[ ... \]`,
+				TextEdits: []analysis.TextEdit{
+					{Pos: d.open, End: d.open + 2, NewText: []byte(`\[`)},
+					{Pos: d.close, End: d.close + 2, NewText: []byte(`\]`)},
+				},
+			}}
+		}
+		pass.Report(diag)
+	}
+	return nil, nil
+}
+
+const SentenceDoc = `report sentences ending after an uppercase word
+
+TeX takes a period after an uppercase letter to end an abbreviation,
+not a sentence, and sets a normal space after it. The sentence analyzer
+reports a period ending a sentence after an uppercase word, as in
+"made by NASA. Then", and suggests \@ before the period to get the
+wider space between sentences.`
+
+var SentenceAnalyzer = &analysis.Analyzer{
+	Name:     "typography/sentence",
+	Doc:      SentenceDoc,
+	Run:      runSentence,
+	Requires: []*analysis.Analyzer{textAnalyzer},
+}
+
+func runSentence(pass *analysis.Pass) (any, error) {
+	t := runningText(pass)
+	for i := 0; i+2 < len(t.items); i++ {
+		word, period, next := t.items[i], t.items[i+1], t.items[i+2]
+		// A single letter, like the initial in "D. E. Knuth", is not a word.
+		if word.tok != token.WORD || len(word.lit) < 2 || !isUpper(word.lit) || word.math ||
+			period.tok != token.PERIOD || period.pos != word.end ||
+			next.tok != token.WORD || !isUpper(next.lit[:1]) || !isSpace(t.gap(period, next)) {
+			continue
+		}
+		pass.Report(analysis.Diagnostic{
+			Pos:     period.pos,
+			End:     period.end,
+			Message: fmt.Sprintf(`period after uppercase %s ends a sentence; use \@.`, word.lit),
+			SuggestedFixes: []analysis.SuggestedFix{{
+				Message:   `Insert \@`,
+				TextEdits: []analysis.TextEdit{{Pos: period.pos, End: period.pos, NewText: []byte(`\@`)}},
+			}},
+		})
+	}
+	return nil, nil
+}
+
+// report reports the source between pos and end with a fix replacing it
+// by repl.
+func report(pass *analysis.Pass, pos, end token.Pos, msg, repl string) {
+	fix := "Replace with " + repl
+	if repl == "" {
+		fix = "Remove"
+	}
+	pass.Report(analysis.Diagnostic{
+		Pos:     pos,
+		End:     end,
+		Message: msg,
+		SuggestedFixes: []analysis.SuggestedFix{{
+			Message:   fix,
+			TextEdits: []analysis.TextEdit{{Pos: pos, End: end, NewText: []byte(repl)}},
+		}},
+	})
+}
+
+func isLetter(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
+
+// isUpper reports whether s is a nonempty string of uppercase ASCII
+// letters.
+func isUpper(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || 'Z' < s[i] {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,122 @@
+package typography
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/token"
+)
+
+func TestAnalyzers(t *testing.T) {
+	for _, test := range []struct {
+		analyzer *analysis.Analyzer
+		src      string
+		want     []string // positions and messages of the diagnostics
+		fixed    string
+	}{
+		{
+			QuotesAnalyzer,
+			"He said \"so\" (\"no\").\n\"Start\" and Stra\"se, \"`x\"' $a\"$\n\\verb|\"| % \"\n\\begin{verbatim}\n\"x\"\n\\end{verbatim}\n",
+			[]string{
+				"1:9: straight double quote; use `` for an opening quote",
+				"1:12: straight double quote; use '' for a closing quote",
+				"1:15: straight double quote; use `` for an opening quote",
+				"1:18: straight double quote; use '' for a closing quote",
+				"2:1: straight double quote; use `` for an opening quote",
+				"2:7: straight double quote; use '' for a closing quote",
+			},
+			"He said ``so'' (``no'').\n``Start'' and Stra\"se, \"`x\"' $a\"$\n\\verb|\"| % \"\n\\begin{verbatim}\n\"x\"\n\\end{verbatim}\n",
+		},
+		{
+			TieAnalyzer,
+			"Figure \\ref{f} and 3 \\cite[p.~2]{k}, see~\\ref{g}.\n\\cite{a} in\n\\eqref{e} and \\label{x} \\ref{y}\n\nSection\n\n\\ref{z}\n",
+			[]string{
+				"1:7: missing non-breaking space before \\ref; use ~",
+				"1:21: missing non-breaking space before \\cite; use ~",
+				"2:12: missing non-breaking space before \\eqref; use ~",
+			},
+			"Figure~\\ref{f} and 3~\\cite[p.~2]{k}, see~\\ref{g}.\n\\cite{a} in~\\eqref{e} and \\label{x} \\ref{y}\n\nSection\n\n\\ref{z}\n",
+		},
+		{
+			DotsAnalyzer,
+			"Wait... and...so $1,...,n$ or .... \\label{a...b}\n",
+			[]string{
+				"1:5: ellipsis typed as ...; use \\dots",
+				"1:12: ellipsis typed as ...; use \\dots",
+				"1:21: ellipsis typed as ...; use \\dots",
+			},
+			"Wait\\dots{} and\\dots{}so $1,\\dots,n$ or .... \\label{a...b}\n",
+		},
+		{
+			DashAnalyzer,
+			"pages 3-5, 10--12, on 2024-01-31, $1-2$ and \\cite[pp. 4-6]{k} or 7 - 8.\n\\begin{align*}\n1-2\n\\end{align*} 1-2\n\\begin{equation}\n1-2 \\text{pp. 3-5}\n\\end{equation}\n",
+			[]string{
+				"1:8: hyphen in number range; use an en-dash (--)",
+				"4:15: hyphen in number range; use an en-dash (--)",
+				"6:16: hyphen in number range; use an en-dash (--)",
+			},
+			"pages 3--5, 10--12, on 2024-01-31, $1-2$ and \\cite[pp. 4-6]{k} or 7 - 8.\n\\begin{align*}\n1-2\n\\end{align*} 1--2\n\\begin{equation}\n1-2 \\text{pp. 3--5}\n\\end{equation}\n",
+		},
+		{
+			FootnoteAnalyzer,
+			"Word \\footnote{a} and\n\\footnote{b}, word\\footnote{c}.\n\n\\footnote{d} $x \\footnote{e}$\n",
+			[]string{
+				"1:5: space before \\footnote",
+				"1:22: space before \\footnote",
+			},
+			"Word\\footnote{a} and\\footnote{b}, word\\footnote{c}.\n\n\\footnote{d} $x \\footnote{e}$\n",
+		},
+		{
+			DisplayMathAnalyzer,
+			"Let $$x = 1$$ and \\[y\\] and $a$$b$.\n$$z\n",
+			[]string{
+				"1:5: $$ display math; use \\[ ... \\]",
+				"2:1: $$ display math; use \\[ ... \\]",
+			},
+			"Let \\[x = 1\\] and \\[y\\] and $a$$b$.\n$$z\n",
+		},
+		{
+			SentenceAnalyzer,
+			"Made by NASA. Then by D. E. Knuth, NASA.\n\nNo, the ESA\\@. But the IBM\nPC. Also $AB. C$ and \\ref{AB}. Done.\n",
+			[]string{
+				"1:13: period after uppercase NASA ends a sentence; use \\@.",
+				"4:3: period after uppercase PC ends a sentence; use \\@.",
+			},
+			"Made by NASA\\@. Then by D. E. Knuth, NASA.\n\nNo, the ESA\\@. But the IBM\nPC\\@. Also $AB. C$ and \\ref{AB}. Done.\n",
+		},
+	} {
+		t.Run(test.analyzer.Name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file := fset.AddFile("doc.tex", fset.Base(), len(test.src))
+			f, err := parser.Parse(fset, file, []byte(test.src), parser.ParseFull)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &analysis.Checker{Analyzers: []*analysis.Analyzer{test.analyzer}}
+			diags, err := c.File(fset, f, file, []byte(test.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range diags {
+				p := fset.Position(d.Pos)
+				got = append(got, strings.TrimPrefix(p.String(), "doc.tex:")+": "+d.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+			out, _ := analysis.ApplyFixes(file, []byte(test.src), diags)
+			if string(out) != test.fixed {
+				t.Errorf("fixed:\n%s\nwant:\n%s", out, test.fixed)
+			}
+		})
+	}
+}
+
+func TestAnalyzersValid(t *testing.T) {
+	if err := analysis.Validate(Analyzers); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/neox5/gotex/token"
+import (
+	"strings"
+
+	"github.com/neox5/gotex/token"
+)
 
 // All node types impilement the Node interface
 type Node interface {
@@ -11,6 +15,7 @@ type Node interface {
 // ImportSpec represents \import{}, \input{}, or \usemodule{} commands
 type ImportSpec struct {
 	Token token.Token // token.IMPORT, token.COMMAND, etc.
+	Cmd   string      // Command name without backslash ("import", "input", "usemodule", ...)
 	Name  string      // Logical name from braces
 	Path  string      // Resolved path (set later)
 	Pos_  token.Pos
@@ -20,18 +25,109 @@ type ImportSpec struct {
 func (s *ImportSpec) Pos() token.Pos { return s.Pos_ }
 func (s *ImportSpec) End() token.Pos { return s.End_ }
 
-// File represents a parsed .tex file in ImportsOnly mode
+// File represents a parsed .tex file. In ImportsOnly mode, only Imports,
+// Directives and Comments are set. In full mode, the imports are also
+// nodes of the Body.
 type File struct {
-	Filename string
-	Imports  []*ImportSpec
-	Body     []Node
-	Pos_     token.Pos
-	End_     token.Pos
+	Filename   string
+	Imports    []*ImportSpec
+	Directives []*Directive         // magic and directive comments in source order
+	Comments   []*CommentGroup      // all comments in source order; see CommentMap
+	Macros     map[string]*MacroDef // macros defined in the file by name (without backslash); see MacroDef
+	Body       []Node
+	Newline    string // first line break in the source: "\n", "\r\n", "\r", or "" for a single line
+	Pos_       token.Pos
+	End_       token.Pos
 }
 
 func (f *File) Pos() token.Pos { return f.Pos_ }
 func (f *File) End() token.Pos { return f.End_ }
 
+// Directive returns the first directive of the given kind, or nil.
+func (f *File) Directive(kind DirectiveKind) *Directive {
+	for _, d := range f.Directives {
+		if d.Kind == kind {
+			return d
+		}
+	}
+	return nil
+}
+
+// MacroDef is a macro definition: \newcommand{\name}[n][default]{body}
+// and its variants \renewcommand, \providecommand and
+// \DeclareRobustCommand, or \def\name<parameter text>{body} and its
+// variants \gdef, \edef and \xdef, or
+// \NewDocumentCommand{\name}{spec}{body} and its variants
+// \RenewDocumentCommand, \ProvideDocumentCommand and
+// \DeclareDocumentCommand, whose arguments are described by an xparse
+// argument specification.
+//
+// In File.Macros, a later definition of a name replaces an earlier one,
+// except for \providecommand and \ProvideDocumentCommand, which only
+// define macros not yet defined.
+type MacroDef struct {
+	Cmd        string    // defining command without backslash ("newcommand", "def", ...)
+	Star       bool      // \newcommand*: arguments may not contain \par
+	Name       string    // defined macro without backslash
+	NamePos    token.Pos // position of the backslash of the name
+	NArgs      int       // number of arguments
+	Default    *string   // default value of the optional first argument, or nil
+	DefaultPos token.Pos // position of the default value
+	Params     string    // parameter text of \def, like "#1#2" or "#1.#2"; "" otherwise
+	Spec       string    // argument specification of \NewDocumentCommand, like "s o m"; "" otherwise
+	SpecPos    token.Pos // position of the argument specification
+	Body       string    // replacement text without the enclosing braces
+	BodyPos    token.Pos // position of the replacement text
+	Pos_       token.Pos
+	End_       token.Pos
+}
+
+func (d *MacroDef) Pos() token.Pos { return d.Pos_ }
+func (d *MacroDef) End() token.Pos { return d.End_ }
+
+// IsDef reports whether d is a TeX primitive definition like \def, whose
+// arguments are described by the parameter text.
+func (d *MacroDef) IsDef() bool {
+	return strings.HasSuffix(d.Cmd, "def")
+}
+
+// IsDocumentCommand reports whether d is an xparse definition like
+// \NewDocumentCommand, whose arguments are described by d.Spec.
+func (d *MacroDef) IsDocumentCommand() bool {
+	return strings.HasSuffix(d.Cmd, "DocumentCommand")
+}
+
+// Provides reports whether d only defines a macro not yet defined, like
+// \providecommand.
+func (d *MacroDef) Provides() bool {
+	return d.Cmd == "providecommand" || d.Cmd == "ProvideDocumentCommand"
+}
+
+// DirectiveKind classifies directive comments.
+type DirectiveKind int
+
+const (
+	TeXRoot     DirectiveKind = iota // % !TEX root = main.tex
+	TeXProgram                       // % !TEX program = xelatex
+	TeXMagic                         // other % !TEX key = value comments
+	GotexIgnore                      // %gotex:ignore rule or %gotex:ignore-file rule
+	GotexModule                      // %gotex:module name
+	GotexOther                       // other %gotex:key value comments
+)
+
+// Directive is a comment with a meaning to tools: a TeX magic comment
+// like "% !TEX root = main.tex", as understood by editors, or a gotex
+// directive like "%gotex:ignore rule".
+type Directive struct {
+	Kind       DirectiveKind
+	Key        string // lower-case key: "root", "program", "ignore", "module", ...
+	Value      string // value with surrounding space removed
+	Pos_, End_ token.Pos
+}
+
+func (d *Directive) Pos() token.Pos { return d.Pos_ }
+func (d *Directive) End() token.Pos { return d.End_ }
+
 // ----------------------------------------------------------------------------
 
 type Comment struct {
@@ -42,11 +138,42 @@ type Comment struct {
 func (c *Comment) Pos() token.Pos { return c.Pos_ }
 func (c *Comment) End() token.Pos { return c.End_ }
 
+// CommentGroup represents a sequence of comments with no other tokens and
+// no blank lines between them, such as the lines of a comment block.
+type CommentGroup struct {
+	List []*Comment // len(List) > 0
+}
+
+func (g *CommentGroup) Pos() token.Pos { return g.List[0].Pos() }
+func (g *CommentGroup) End() token.Pos { return g.List[len(g.List)-1].End() }
+
+// Text returns the text of the comment group: the comments without their
+// % markers and leading space on each line, joined by newlines. Directive
+// comments (%gotex:...) are omitted.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range g.List {
+		if strings.HasPrefix(c.Lit, "%gotex:") {
+			continue
+		}
+		text := strings.TrimLeft(c.Lit, "%")
+		text = strings.TrimPrefix(text, " ")
+		lines = append(lines, strings.TrimRight(text, " \t"))
+	}
+	return strings.Join(lines, "\n")
+}
+
 // ----------------------------------------------------------------------------
 
-// Word node (e.g., "hello", "world")
+// Word node (e.g., "hello", "world", "caf\'e", "Stra\ss e"). Lit is the
+// source text of the word; a normalization pass (see package normalize)
+// may replace it by its Unicode form and keep the source text in Raw.
 type Word struct {
 	Lit        string
+	Raw        string // source text if Lit was normalized, "" otherwise
 	Pos_, End_ token.Pos
 }
 
@@ -61,23 +188,98 @@ type Newline struct {
 func (n *Newline) Pos() token.Pos { return n.Pos_ }
 func (n *Newline) End() token.Pos { return n.End_ }
 
-// LineBreak (explicit `\\`, `\newline`, etc.)
+// LineBreak (explicit `\\`, `\\*`, `\\[1ex]`, `\newline`)
 type LineBreak struct {
-	Kind       string
+	Kind       string // "\\" or "newline"
+	Star       bool   // \\* (no page break after the line)
+	Length     string // extra vertical space of \\[length], e.g. "1ex"
 	Pos_, End_ token.Pos
 }
 
 func (b *LineBreak) Pos() token.Pos { return b.Pos_ }
 func (b *LineBreak) End() token.Pos { return b.End_ }
 
+// ControlSymbol is a control symbol other than a line break or an accent,
+// like the spaces \, \; \! and \ (control space), the italic
+// correction \/ and the space factor \@.
+type ControlSymbol struct {
+	Lit        string // the character after the backslash, e.g. ","
+	Pos_, End_ token.Pos
+}
+
+func (c *ControlSymbol) Pos() token.Pos { return c.Pos_ }
+func (c *ControlSymbol) End() token.Pos { return c.End_ }
+
+// Verbatim represents source that is taken literally: the body of a
+// verbatim-like environment (\begin{verbatim}...\end{verbatim}) or an
+// inline \verb|...|.
+type Verbatim struct {
+	Env        string    // environment name ("verbatim", "verbatim*", "lstlisting", ...), or "verb"
+	Star       bool      // starred \verb*
+	Args       []string  // raw arguments following \begin{env}, e.g. the minted language
+	Content    string    // exact source bytes of the body
+	ContentPos token.Pos // position of the first byte of Content
+	Pos_, End_ token.Pos
+}
+
+func (v *Verbatim) Pos() token.Pos { return v.Pos_ }
+func (v *Verbatim) End() token.Pos { return v.End_ }
+
+// Command is a use of a command whose signature is known to the parser.
+// Args has one entry per argument of the signature, in order.
+type Command struct {
+	Name       string // command name without backslash
+	Args       []*Arg
+	Pos_, End_ token.Pos
+}
+
+func (c *Command) Pos() token.Pos { return c.Pos_ }
+func (c *Command) End() token.Pos { return c.End_ }
+
+// Arg returns the i-th argument of c, or nil if c has fewer arguments.
+func (c *Command) Arg(i int) *Arg {
+	if i < len(c.Args) {
+		return c.Args[i]
+	}
+	return nil
+}
+
+// Arg is an argument of a command.
+type Arg struct {
+	Kind       byte      // argument type of the signature: 's' (star), 'o' (optional), 'm' (mandatory)
+	Present    bool      // false for an omitted star or optional argument
+	Lit        string    // source text without the delimiters; "" for a star
+	LitPos     token.Pos // position of Lit
+	Body       []Node    // content of a braced mandatory argument, unless read verbatim; nil otherwise
+	Pos_, End_ token.Pos // span including the delimiters
+}
+
+func (a *Arg) Pos() token.Pos { return a.Pos_ }
+func (a *Arg) End() token.Pos { return a.End_ }
+
 type TextNode interface {
 	Node
 	textNode()
 }
 
-func (w *Word) textNode()      {}
-func (n *Newline) textNode()   {}
-func (b *LineBreak) textNode() {}
+func (w *Word) textNode()          {}
+func (n *Newline) textNode()       {}
+func (b *LineBreak) textNode()     {}
+func (c *ControlSymbol) textNode() {}
+func (v *Verbatim) textNode()      {}
+
+// Paragraph groups the content between paragraph breaks: blank lines and
+// \par. Single line breaks inside a paragraph act as inter-word spaces and
+// are kept as Newline nodes in its text blocks. Blank lines are not part
+// of a paragraph; they remain in the enclosing body.
+type Paragraph struct {
+	Body       []Node    // text blocks, comments, verbatim environments, ...
+	Par        token.Pos // position of the \par ending the paragraph, or NoPos
+	Pos_, End_ token.Pos
+}
+
+func (p *Paragraph) Pos() token.Pos { return p.Pos_ }
+func (p *Paragraph) End() token.Pos { return p.End_ }
 
 type TextBlock struct {
 	Content    []TextNode
@@ -0,0 +1,167 @@
+package ast
+
+import (
+	"slices"
+
+	"github.com/neox5/gotex/token"
+)
+
+// A CommentMap maps an AST node to a list of comment groups associated
+// with it. See [NewCommentMap] for a description of the association.
+type CommentMap map[Node][]*CommentGroup
+
+func (cmap CommentMap) addComment(n Node, c *CommentGroup) {
+	cmap[n] = append(cmap[n], c)
+}
+
+// nodeList returns the nodes of the AST rooted at n in depth-first order,
+// excluding n itself and the comment and newline nodes kept in the body.
+func nodeList(n Node) []Node {
+	var list []Node
+	Inspect(n, func(m Node) bool {
+		switch m.(type) {
+		case *Comment, *CommentGroup, *Newline:
+			return false
+		}
+		if m != n {
+			list = append(list, m)
+		}
+		return true
+	})
+	return list
+}
+
+// NewCommentMap creates a new comment map by associating the comment
+// groups of the comments list with the nodes of the AST specified by node.
+//
+// A comment group g is associated with a node n if:
+//
+//   - g starts on the same line as n ends
+//   - g starts on the line immediately following n, and there is at least
+//     one empty line after g and before the next node
+//   - g starts before n and is not associated to the node before n via
+//     the previous rules
+//
+// Of several nodes ending at the same position, the outermost one is
+// chosen. Comment groups following the last node of an enclosing node are
+// associated with the enclosing node, and those that cannot be associated
+// otherwise with node itself.
+//
+// Like in go/ast, the map lets tools rewriting the AST keep comments with
+// the code they describe.
+func NewCommentMap(fset *token.FileSet, node Node, comments []*CommentGroup) CommentMap {
+	if len(comments) == 0 {
+		return nil // no comments to map
+	}
+
+	cmap := make(CommentMap)
+
+	// Sort a copy of the comments list.
+	tmp := slices.Clone(comments)
+	slices.SortFunc(tmp, func(a, b *CommentGroup) int { return int(a.Pos() - b.Pos()) })
+	comments = tmp
+
+	var (
+		stack []Node // nodes enclosing the current position, outermost first
+		prev  Node   // node ending last before the current position
+	)
+	// pop removes the nodes ending at or before pos from the stack and
+	// updates prev.
+	pop := func(pos token.Pos) {
+		for len(stack) > 0 && stack[len(stack)-1].End() <= pos {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if prev == nil || top.End() >= prev.End() {
+				prev = top // outermost of the nodes ending at the same position
+			}
+		}
+	}
+
+	nodes := nodeList(node)
+	i := 0 // index of the next comment group
+	for k := 0; k <= len(nodes); k++ {
+		var q Node // next node
+		if k < len(nodes) {
+			q = nodes[k]
+		}
+
+		// Associate the comment groups before q.
+		for ; i < len(comments) && (q == nil || comments[i].Pos() < q.Pos()); i++ {
+			g := comments[i]
+			pop(g.Pos())
+
+			gpos, gend := fset.Position(g.Pos()), fset.Position(g.End())
+			var qpos token.Position
+			if q != nil {
+				qpos = fset.Position(q.Pos())
+			}
+			var pend token.Position
+			if prev != nil {
+				// Use the last character: text nodes may end with a line break.
+				pend = fset.Position(prev.End() - 1)
+			}
+			// q is only a candidate if it is inside the enclosing node.
+			qInside := q != nil && (len(stack) == 0 || q.Pos() < stack[len(stack)-1].End())
+
+			var assoc Node
+			switch {
+			case prev != nil && pend.Line == gpos.Line:
+				assoc = prev // trailing comment
+			case prev != nil && pend.Line+1 == gpos.Line && (!qInside || gend.Line+1 < qpos.Line):
+				assoc = prev // comment below prev, separated from q by a blank line
+			case qInside:
+				assoc = q // leading comment
+			case len(stack) > 0:
+				assoc = stack[len(stack)-1] // last comment in the enclosing node
+			default:
+				assoc = node
+			}
+			cmap.addComment(assoc, g)
+		}
+
+		if q != nil {
+			pop(q.Pos())
+			stack = append(stack, q)
+			// Comments after q follow q or one of its children; the
+			// nodes before q are no longer candidates.
+			prev = nil
+		}
+	}
+
+	return cmap
+}
+
+// Update replaces an old node in the comment map with the new node and
+// returns the new node. Comments that were associated with the old node
+// are associated with the new node.
+func (cmap CommentMap) Update(old, new Node) Node {
+	if list := cmap[old]; len(list) > 0 {
+		delete(cmap, old)
+		cmap[new] = append(cmap[new], list...)
+	}
+	return new
+}
+
+// Filter returns a new comment map consisting of only those entries of
+// cmap for which a corresponding node exists in the AST specified by node.
+func (cmap CommentMap) Filter(node Node) CommentMap {
+	umap := make(CommentMap)
+	Inspect(node, func(n Node) bool {
+		if g := cmap[n]; len(g) > 0 {
+			umap[n] = g
+		}
+		return true
+	})
+	return umap
+}
+
+// Comments returns the list of comment groups in the comment map. The
+// result is sorted in source order.
+func (cmap CommentMap) Comments() []*CommentGroup {
+	list := make([]*CommentGroup, 0, len(cmap))
+	for _, e := range cmap {
+		list = append(list, e...)
+	}
+	slices.SortFunc(list, func(a, b *CommentGroup) int { return int(a.Pos() - b.Pos()) })
+	return list
+}
@@ -0,0 +1,99 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/token"
+)
+
+const commentSrc = `% doc comment
+% continues
+Hello % trailing
+% about hello
+
+% leading world
+world
+% end
+`
+
+func TestCommentMap(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("comments.tex", fset.Base(), len(commentSrc))
+	f, err := parser.Parse(fset, file, []byte(commentSrc), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []string
+	for _, g := range f.Comments {
+		groups = append(groups, g.Text())
+	}
+	want := []string{"doc comment\ncontinues", "trailing\nabout hello", "leading world", "end"}
+	if len(groups) != len(want) {
+		t.Fatalf("got comment groups %q; want %q", groups, want)
+	}
+	for i := range want {
+		if groups[i] != want[i] {
+			t.Errorf("group %d: got %q; want %q", i, groups[i], want[i])
+		}
+	}
+
+	// Find the paragraphs and text blocks holding the words.
+	pars := make(map[string]ast.Node)
+	blocks := make(map[string]ast.Node)
+	var par ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Paragraph:
+			par = n
+		case *ast.TextBlock:
+			for _, c := range n.Content {
+				if w, ok := c.(*ast.Word); ok {
+					pars[w.Lit], blocks[w.Lit] = par, n
+				}
+			}
+		}
+		return true
+	})
+
+	cmap := ast.NewCommentMap(fset, f, f.Comments)
+	check := func(word string, want ...string) {
+		t.Helper()
+		// Leading comments belong to the paragraph, the others to the
+		// text block they follow.
+		var got []string
+		for _, n := range []ast.Node{pars[word], blocks[word]} {
+			for _, g := range cmap[n] {
+				got = append(got, g.Text())
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("comments of %q: got %q; want %q", word, got, want)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("comments of %q: got %q; want %q", word, got, want)
+			}
+		}
+	}
+	check("Hello", "doc comment\ncontinues", "trailing\nabout hello")
+	check("world", "leading world", "end")
+
+	if n := len(cmap.Comments()); n != len(f.Comments) {
+		t.Errorf("got %d mapped comment groups; want %d", n, len(f.Comments))
+	}
+
+	// Comments move with their node.
+	hello := blocks["Hello"]
+	repl := &ast.TextBlock{Pos_: hello.Pos(), End_: hello.End()}
+	cmap.Update(hello, repl)
+	if len(cmap[hello]) != 0 || len(cmap[repl]) != 1 {
+		t.Errorf("Update did not move the comments")
+	}
+	if fm := cmap.Filter(pars["world"]); len(fm) != 2 {
+		t.Errorf("Filter kept %d nodes; want 2", len(fm))
+	}
+}
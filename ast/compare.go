@@ -2,6 +2,7 @@ package ast
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -76,6 +77,26 @@ func (v *CompareVisitor) compareNodes(a, b Node) bool {
 		}
 		return true
 
+	case *Paragraph:
+		y, ok := b.(*Paragraph)
+		if !ok {
+			v.T.Errorf("expected Paragraph, got %T", b)
+			return false
+		}
+		if len(x.Body) != len(y.Body) {
+			v.T.Errorf("Paragraph.Body length mismatch: got %d, want %d\n  got:  %s\n  want: %s",
+				len(x.Body), len(y.Body), shortNode(x), shortNode(y))
+			return false
+		}
+		for i := range x.Body {
+			if !v.compareNodes(x.Body[i], y.Body[i]) {
+				v.T.Errorf("Paragraph.Body[%d] mismatch:\n  got:  %s\n  want: %s",
+					i, shortNode(x.Body[i]), shortNode(y.Body[i]))
+				return false
+			}
+		}
+		return true
+
 	case *Word:
 		y, ok := b.(*Word)
 		if !ok || x.Lit != y.Lit {
@@ -94,8 +115,16 @@ func (v *CompareVisitor) compareNodes(a, b Node) bool {
 
 	case *LineBreak:
 		y, ok := b.(*LineBreak)
-		if !ok || x.Kind != y.Kind {
-			v.T.Errorf("LineBreak mismatch: got %q, want %q", x.Kind, y.Kind)
+		if !ok || x.Kind != y.Kind || x.Star != y.Star || x.Length != y.Length {
+			v.T.Errorf("LineBreak mismatch: got %s, want %s", shortNode(x), shortNode(b))
+			return false
+		}
+		return true
+
+	case *ControlSymbol:
+		y, ok := b.(*ControlSymbol)
+		if !ok || x.Lit != y.Lit {
+			v.T.Errorf("ControlSymbol mismatch: got %s, want %s", shortNode(x), shortNode(b))
 			return false
 		}
 		return true
@@ -108,6 +137,47 @@ func (v *CompareVisitor) compareNodes(a, b Node) bool {
 		}
 		return true
 
+	case *Verbatim:
+		y, ok := b.(*Verbatim)
+		if !ok || x.Env != y.Env || x.Star != y.Star || x.Content != y.Content ||
+			fmt.Sprint(x.Args) != fmt.Sprint(y.Args) {
+			v.T.Errorf("Verbatim mismatch: got %s, want %s", shortNode(x), shortNode(b))
+			return false
+		}
+		return true
+
+	case *MacroDef:
+		y, ok := b.(*MacroDef)
+		if !ok || x.Cmd != y.Cmd || x.Star != y.Star || x.Name != y.Name || x.NArgs != y.NArgs ||
+			(x.Default == nil) != (y.Default == nil) || x.Default != nil && *x.Default != *y.Default ||
+			x.Params != y.Params || x.Spec != y.Spec || x.Body != y.Body {
+			v.T.Errorf("MacroDef mismatch: got %s, want %s", shortNode(x), shortNode(b))
+			return false
+		}
+		return true
+
+	case *ImportSpec:
+		y, ok := b.(*ImportSpec)
+		if !ok || x.Cmd != y.Cmd || x.Name != y.Name {
+			v.T.Errorf("ImportSpec mismatch: got %s, want %s", shortNode(x), shortNode(b))
+			return false
+		}
+		return true
+
+	case *Command:
+		y, ok := b.(*Command)
+		if !ok || x.Name != y.Name || len(x.Args) != len(y.Args) {
+			v.T.Errorf("Command mismatch: got %s, want %s", shortNode(x), shortNode(b))
+			return false
+		}
+		for i, arg := range x.Args {
+			if want := y.Args[i]; arg.Kind != want.Kind || arg.Present != want.Present || arg.Lit != want.Lit {
+				v.T.Errorf("Command mismatch: got %s, want %s", shortNode(x), shortNode(b))
+				return false
+			}
+		}
+		return true
+
 	default:
 		v.T.Errorf("unexpected node type: %T", a)
 		return false
@@ -139,14 +209,56 @@ func shortNode(n Node) string {
 		}
 		return fmt.Sprintf("TextBlock[%d: %s%s]", len(x.Content), joinSnippets(snippets), more)
 
+	case *Paragraph:
+		snippets := make([]string, 0, 2)
+		for i := 0; i < min(2, len(x.Body)); i++ {
+			snippets = append(snippets, shortNode(x.Body[i]))
+		}
+		more := ""
+		if len(x.Body) > 2 {
+			more = ", ..."
+		}
+		return fmt.Sprintf("Paragraph[%d: %s%s]", len(x.Body), joinSnippets(snippets), more)
+
 	case *Word:
 		return fmt.Sprintf("Word(%q)", x.Lit)
 	case *Newline:
 		return "Newline"
 	case *LineBreak:
+		switch {
+		case x.Length != "":
+			return fmt.Sprintf("LineBreak(%q, star=%v, length=%q)", x.Kind, x.Star, x.Length)
+		case x.Star:
+			return fmt.Sprintf("LineBreak(%q, star)", x.Kind)
+		}
 		return fmt.Sprintf("LineBreak(%q)", x.Kind)
+	case *ControlSymbol:
+		return fmt.Sprintf("ControlSymbol(%q)", x.Lit)
 	case *Comment:
 		return fmt.Sprintf("Comment(%q)", x.Lit)
+	case *Verbatim:
+		env := x.Env
+		if x.Star {
+			env += "*"
+		}
+		return fmt.Sprintf("Verbatim(%s, %q)", env, x.Content)
+	case *MacroDef:
+		return fmt.Sprintf("MacroDef(\\%s \\%s, %d args, %q)", x.Cmd, x.Name, x.NArgs, x.Body)
+	case *ImportSpec:
+		return fmt.Sprintf("ImportSpec(\\%s %q)", x.Cmd, x.Name)
+	case *Command:
+		args := make([]string, len(x.Args))
+		for i, arg := range x.Args {
+			switch {
+			case !arg.Present:
+				args[i] = "-"
+			case arg.Kind == 's':
+				args[i] = "*"
+			default:
+				args[i] = fmt.Sprintf("%q", arg.Lit)
+			}
+		}
+		return fmt.Sprintf("Command(\\%s %s)", x.Name, strings.Join(args, " "))
 	default:
 		return fmt.Sprintf("%T", x)
 	}
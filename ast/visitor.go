@@ -19,9 +19,37 @@ func Walk(v Visitor, node Node) {
 		for _, c := range n.Content {
 			Walk(v, c)
 		}
+	case *Paragraph:
+		for _, c := range n.Body {
+			Walk(v, c)
+		}
 	case *File:
 		for _, c := range n.Body {
 			Walk(v, c)
 		}
+	case *Command:
+		for _, a := range n.Args {
+			Walk(v, a)
+		}
+	case *Arg:
+		for _, c := range n.Body {
+			Walk(v, c)
+		}
 	}
 }
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: It starts by calling
+// f(node); node must not be nil. If f returns true, Inspect invokes f
+// recursively for each of the children of node.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,172 @@
+// Package bib parses BibTeX and biblatex bibliography files (.bib).
+//
+// A .bib file is a sequence of entries like
+//
+//	@article{knuth84,
+//	  author  = {Donald E. Knuth},
+//	  title   = "Literate Programming",
+//	  journal = cj # { 27},
+//	  year    = 1984,
+//	}
+//
+// together with @string macros, @preamble text and @comment entries. As
+// in BibTeX, text outside entries is ignored. [Parse] returns the entries
+// as typed structs, with field values expanded: string macros are
+// replaced, parts joined by # are concatenated, and fields missing in an
+// entry are inherited from the entry named by its crossref field.
+//
+// Positions are [token.Pos] values of a [token.FileSet], so that they can
+// be reported together with those of the documents citing the entries.
+package bib
+
+import (
+	"strings"
+
+	"github.com/neox5/gotex/token"
+)
+
+// A File is a parsed .bib file.
+type File struct {
+	Filename  string
+	Entries   []*Entry    // entries in source order
+	Strings   []*Field    // @string definitions in source order
+	Preambles []*Preamble // @preamble texts in source order
+	Pos_      token.Pos
+	End_      token.Pos
+
+	keys map[string]*Entry // first entry of each key
+}
+
+func (f *File) Pos() token.Pos { return f.Pos_ }
+func (f *File) End() token.Pos { return f.End_ }
+
+// Lookup returns the entry with the given key, or nil. Keys are case
+// sensitive, as in biber.
+func (f *File) Lookup(key string) *Entry {
+	return f.keys[key]
+}
+
+// An Entry is a bibliography entry, like @article{key, ...}.
+type Entry struct {
+	Type   string // entry type in lower case ("article", "book", ...)
+	Key    string // citation key
+	KeyPos token.Pos
+	Fields []*Field // fields in source order, followed by the inherited fields
+	Parent *Entry   // entry named by the crossref field, once resolved; or nil
+	Pos_   token.Pos
+	End_   token.Pos
+}
+
+func (e *Entry) Pos() token.Pos { return e.Pos_ }
+func (e *Entry) End() token.Pos { return e.End_ }
+
+// Field returns the field of e with the given name, or nil. Field names
+// are case insensitive.
+func (e *Entry) Field(name string) *Field {
+	name = strings.ToLower(name)
+	for _, f := range e.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Get returns the value of the field of e with the given name, or "".
+func (e *Entry) Get(name string) string {
+	if f := e.Field(name); f != nil {
+		return f.Value
+	}
+	return ""
+}
+
+// Names returns the names of a name list field like author or editor:
+// its value split at each "and" outside braces. So the value
+// "Knuth, Donald and {Barnes and Noble}" yields two names.
+func (e *Entry) Names(field string) []string {
+	value := e.Get(field)
+	if value == "" {
+		return nil
+	}
+	var names []string
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ' ':
+			if depth == 0 && i+5 <= len(value) && strings.EqualFold(value[i:i+5], " and ") {
+				names = append(names, strings.TrimSpace(value[start:i]))
+				start = i + 5
+				i += 4
+			}
+		}
+	}
+	return append(names, strings.TrimSpace(value[start:]))
+}
+
+// A Field is a field of an entry, like title = {...}, or the definition
+// of a @string macro.
+type Field struct {
+	Name    string    // name in lower case
+	NamePos token.Pos // position of the name as written
+	Value   string    // value with macros expanded, parts concatenated and white space collapsed
+	Parts   []*Part   // parts of the value joined by #
+	From    *Entry    // entry the field is inherited from, or nil
+	Pos_    token.Pos
+	End_    token.Pos
+}
+
+func (f *Field) Pos() token.Pos { return f.Pos_ }
+func (f *Field) End() token.Pos { return f.End_ }
+
+// A PartKind is the form of a part of a field value.
+type PartKind int
+
+const (
+	Braced PartKind = iota // {text}
+	Quoted                 // "text"
+	Number                 // 1984
+	Macro                  // jan, a @string macro
+)
+
+// A Part is a part of a field value as written in the source.
+type Part struct {
+	Kind PartKind
+	Lit  string    // text without braces or quotes, number, or macro name
+	Pos_ token.Pos // position of the part including its delimiters
+	End_ token.Pos
+}
+
+func (p *Part) Pos() token.Pos { return p.Pos_ }
+func (p *Part) End() token.Pos { return p.End_ }
+
+// A Preamble is a @preamble{...} entry: text for the preamble of the
+// bibliography.
+type Preamble struct {
+	Value string
+	Parts []*Part
+	Pos_  token.Pos
+	End_  token.Pos
+}
+
+func (p *Preamble) Pos() token.Pos { return p.Pos_ }
+func (p *Preamble) End() token.Pos { return p.End_ }
+
+// months are the string macros predefined by the standard BibTeX styles.
+var months = map[string]string{
+	"jan": "January",
+	"feb": "February",
+	"mar": "March",
+	"apr": "April",
+	"may": "May",
+	"jun": "June",
+	"jul": "July",
+	"aug": "August",
+	"sep": "September",
+	"oct": "October",
+	"nov": "November",
+	"dec": "December",
+}
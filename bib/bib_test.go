@@ -0,0 +1,222 @@
+package bib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+func parse(t *testing.T, src string) (*File, *token.File, error) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file := fset.AddFile("refs.bib", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src))
+	return f, file, err
+}
+
+func TestParse(t *testing.T) {
+	src := `This text is ignored, like in BibTeX.
+@String{cj = "The Computer Journal"}
+@preamble{ "\newcommand{\noop}[1]{}" }
+@comment{ @article{commented, title = {Not an entry}} }
+
+@Article{knuth84,
+  Author  = {Donald E. Knuth},
+  title   = "Literate {"}Programming{"}",
+  journal = cj # {, } # "vol. " # 27,
+  month   = may,
+  year    = 1984,
+}
+
+% a comment
+@book(lamport94,
+  author = {Leslie Lamport and {Barnes and Noble}},
+  title  = {\LaTeX: A Document
+            Preparation System}
+)`
+	f, file, err := parse(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Strings) != 1 || f.Strings[0].Name != "cj" || f.Strings[0].Value != "The Computer Journal" {
+		t.Errorf("got strings %+v", f.Strings)
+	}
+	if len(f.Preambles) != 1 || f.Preambles[0].Value != `\newcommand{\noop}[1]{}` {
+		t.Errorf("got preambles %+v", f.Preambles)
+	}
+	if len(f.Entries) != 2 {
+		t.Fatalf("got %d entries; want 2", len(f.Entries))
+	}
+
+	knuth := f.Lookup("knuth84")
+	if knuth == nil || knuth.Type != "article" {
+		t.Fatalf("got entry %+v", knuth)
+	}
+	for name, want := range map[string]string{
+		"author":  "Donald E. Knuth",
+		"title":   `Literate {"}Programming{"}`,
+		"journal": "The Computer Journal, vol. 27",
+		"month":   "May",
+		"YEAR":    "1984",
+		"volume":  "",
+	} {
+		if got := knuth.Get(name); got != want {
+			t.Errorf("%s = %q; want %q", name, got, want)
+		}
+	}
+	text := func(pos, end token.Pos) string {
+		return src[int(pos)-file.Base() : int(end)-file.Base()]
+	}
+	if got := text(knuth.Pos(), knuth.End()); !strings.HasPrefix(got, "@Article{") || !strings.HasSuffix(got, "}") {
+		t.Errorf("entry spans %q", got)
+	}
+	journal := knuth.Field("journal")
+	if got := text(journal.Pos(), journal.End()); got != `journal = cj # {, } # "vol. " # 27` {
+		t.Errorf("field spans %q", got)
+	}
+	var kinds []PartKind
+	for _, p := range journal.Parts {
+		kinds = append(kinds, p.Kind)
+	}
+	if fmt.Sprint(kinds) != fmt.Sprint([]PartKind{Macro, Braced, Quoted, Number}) {
+		t.Errorf("got part kinds %v", kinds)
+	}
+
+	lamport := f.Lookup("lamport94")
+	if got := lamport.Get("title"); got != `\LaTeX: A Document Preparation System` {
+		t.Errorf("title = %q", got)
+	}
+	if got := lamport.Names("author"); fmt.Sprint(got) != "[Leslie Lamport {Barnes and Noble}]" {
+		t.Errorf("authors = %q", got)
+	}
+	if got := file.Position(lamport.KeyPos); got.Line != 15 || got.Column != 7 {
+		t.Errorf("key at %v; want line 15, column 7", got)
+	}
+}
+
+func TestCrossrefs(t *testing.T) {
+	src := `@inproceedings{paper,
+  author   = {A. Author},
+  title    = {A Paper},
+  crossref = {proc},
+}
+@proceedings{proc,
+  title     = {Proceedings of the Conference},
+  year      = 2020,
+  publisher = {ACM},
+  ids       = {conf20},
+  crossref  = {series},
+}
+@mvproceedings{series,
+  title    = {Conference Series},
+  location = {Berlin},
+}
+@incollection{chapter, crossref = {nowhere}}`
+	f, _, err := parse(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paper := f.Lookup("paper")
+	if paper.Parent != f.Lookup("proc") {
+		t.Fatalf("got parent %v", paper.Parent)
+	}
+	for name, want := range map[string]string{
+		"title":     "A Paper",
+		"booktitle": "Proceedings of the Conference",
+		"maintitle": "Conference Series",
+		"year":      "2020",
+		"location":  "Berlin",
+		"ids":       "",
+		"crossref":  "proc",
+		"publisher": "ACM",
+	} {
+		if got := paper.Get(name); got != want {
+			t.Errorf("%s = %q; want %q", name, got, want)
+		}
+	}
+	if from := paper.Field("location").From; from != f.Lookup("series") {
+		t.Errorf("location inherited from %v", from)
+	}
+	if f.Lookup("chapter").Parent != nil {
+		t.Errorf("unresolved crossref has a parent")
+	}
+
+	// A parent in another file.
+	g, _, err := parse(t, `@book{book, title = {The Book}, year = 1999}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := append(append([]*Entry{}, f.Entries...), g.Entries...)
+	missing := ResolveCrossrefs(all)
+	if len(missing) != 1 || missing[0].Key != "chapter" {
+		t.Errorf("got missing %v", missing)
+	}
+	h, _, _ := parse(t, `@inbook{ch, crossref = {book}}`)
+	ResolveCrossrefs(append(h.Entries, g.Entries...))
+	if got := h.Entries[0].Get("booktitle"); got != "The Book" {
+		t.Errorf("booktitle = %q", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	src := `@article{good1, title = {One}}
+@article{bad1, title = {Two} year = 2000}
+@article{good2, journal = undefinedmacro, title = {T}, Title = {Again}}
+@article{good1, title = {Duplicate}}
+@article{bad2, title = {Unclosed
+@article{good3, title = "Three"}
+@{nokey}
+@article{bad3, note = "unterminated
+}
+@misc{good4}`
+	f, _, err := parse(t, src)
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got error %v; want scanner.ErrorList", err)
+	}
+	want := []string{
+		"refs.bib:2:30: expected ',' or '}', found name year",
+		"refs.bib:3:27: undefined string undefinedmacro",
+		"refs.bib:3:56: duplicate field title in entry good2",
+		"refs.bib:4:10: duplicate entry good1 (first defined at refs.bib:1:10)",
+		"refs.bib:5:24: missing '}' to close field value",
+		"refs.bib:7:2: expected entry type, found '{'",
+		"refs.bib:8:23: quoted string not terminated",
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var keys []string
+	for _, e := range f.Entries {
+		keys = append(keys, e.Key)
+	}
+	if fmt.Sprint(keys) != "[good1 good2 good1 good3 good4]" {
+		t.Errorf("got entries %v", keys)
+	}
+	if f.Lookup("good1").Get("title") != "One" {
+		t.Errorf("Lookup returned the duplicate entry")
+	}
+}
+
+func TestLarge(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("@string{pub = {Publisher}}\n")
+	for i := range 4000 {
+		fmt.Fprintf(&b, "@book{key%d,\n  author = {Author %d},\n  title = {Title %d},\n  publisher = pub,\n}\n\n", i, i, i)
+	}
+	f, _, err := parse(t, b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Entries) != 4000 || f.Lookup("key3999").Get("publisher") != "Publisher" {
+		t.Errorf("got %d entries", len(f.Entries))
+	}
+}
@@ -0,0 +1,115 @@
+package bib
+
+// ResolveCrossrefs sets the Parent of each entry with a crossref field to
+// the entry it names and adds the fields the entry inherits from its
+// parent. Parents are looked up among entries, so that a child and its
+// parent may come from different files; if a key occurs twice, the first
+// entry is used. ResolveCrossrefs returns the entries whose parent was not
+// found.
+//
+// Inheritance follows the defaults of biblatex: a field is inherited
+// unless the child has it, the title fields of a book, collection or
+// proceedings become the booktitle fields of the child (maintitle for
+// multi-volume works, journaltitle for periodicals), and fields
+// identifying the parent itself, like crossref and ids, are not
+// inherited. A parent with its own crossref passes on what it inherited.
+// Entries resolved before are left unchanged.
+func ResolveCrossrefs(entries []*Entry) (missing []*Entry) {
+	keys := make(map[string]*Entry, len(entries))
+	for _, e := range entries {
+		if keys[e.Key] == nil {
+			keys[e.Key] = e
+		}
+	}
+	visiting := make(map[*Entry]bool)
+	var resolve func(e *Entry)
+	resolve = func(e *Entry) {
+		if e.Parent != nil || visiting[e] {
+			return // resolved, or part of a cycle
+		}
+		ref := e.Field("crossref")
+		if ref == nil || ref.From != nil {
+			return
+		}
+		parent := keys[ref.Value]
+		if parent == nil {
+			missing = append(missing, e)
+			return
+		}
+		visiting[e] = true
+		resolve(parent)
+		delete(visiting, e)
+		e.inherit(parent)
+	}
+	for _, e := range entries {
+		resolve(e)
+	}
+	return missing
+}
+
+// noInherit are the fields never inherited from a parent.
+var noInherit = map[string]bool{
+	"crossref":       true,
+	"xref":           true,
+	"ids":            true,
+	"entryset":       true,
+	"entrysubtype":   true,
+	"execute":        true,
+	"label":          true,
+	"options":        true,
+	"presort":        true,
+	"related":        true,
+	"relatedoptions": true,
+	"relatedstring":  true,
+	"relatedtype":    true,
+	"shorthand":      true,
+	"shorthandintro": true,
+	"sortkey":        true,
+}
+
+// titlePrefix returns the prefix replacing "title" in the title fields
+// inherited from a parent of the given type, or "" if they keep their
+// names.
+func titlePrefix(parentType string) string {
+	switch parentType {
+	case "mvbook", "mvcollection", "mvproceedings", "mvreference":
+		return "main"
+	case "book", "collection", "proceedings", "reference":
+		return "book"
+	case "periodical":
+		return "journal"
+	}
+	return ""
+}
+
+// inherit sets the parent of e and adds the fields of parent missing in e.
+func (e *Entry) inherit(parent *Entry) {
+	e.Parent = parent
+	prefix := titlePrefix(parent.Type)
+	for _, f := range parent.Fields {
+		name := f.Name
+		if noInherit[name] {
+			continue
+		}
+		switch name {
+		case "title", "subtitle", "titleaddon":
+			// An explicit booktitle of the parent, as the BibTeX styles
+			// expect it, takes precedence over its mapped title.
+			if prefix != "" {
+				name = prefix + name
+				if parent.Field(name) != nil {
+					continue
+				}
+			}
+		}
+		if e.Field(name) != nil {
+			continue
+		}
+		g := *f
+		g.Name = name
+		if g.From == nil {
+			g.From = parent
+		}
+		e.Fields = append(e.Fields, &g)
+	}
+}
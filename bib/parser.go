@@ -0,0 +1,276 @@
+package bib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// Parse parses the source of a .bib file. The caller must provide a
+// token.FileSet and the token.File of the source; Parse sets its lines.
+//
+// Crossref fields are resolved among the entries of the file; see
+// [ResolveCrossrefs] for a bibliography spread over several files.
+//
+// Malformed entries are skipped up to the next @, as BibTeX does, and
+// reported together with undefined string macros and duplicate keys and
+// fields in a [scanner.ErrorList] sorted by source position. The other
+// entries are returned nonetheless.
+func Parse(fset *token.FileSet, file *token.File, src []byte) (*File, error) {
+	file.SetLinesForContent(src)
+	p := &parser{
+		fset:   fset,
+		macros: make(map[string]string),
+		f:      &File{Filename: file.Name(), Pos_: file.Pos(0), End_: file.Pos(len(src)), keys: make(map[string]*Entry)},
+		tok:    eof,
+	}
+	p.lx.init(file, src, p.error)
+	p.parseFile()
+	ResolveCrossrefs(p.f.Entries)
+	p.errors.Sort()
+	return p.f, p.errors.Err()
+}
+
+type parser struct {
+	fset   *token.FileSet
+	lx     lexer
+	errors scanner.ErrorList
+
+	// current token
+	pos token.Pos
+	tok kind
+	lit string
+
+	f      *File
+	macros map[string]string // @string macros by lower-case name
+}
+
+func (p *parser) next() {
+	p.pos, p.tok, p.lit = p.lx.next()
+}
+
+func (p *parser) error(pos token.Pos, msg string) {
+	p.errors.Add(p.fset.Position(pos), msg)
+}
+
+// errorExpected reports that the current token is not what. An illegal
+// token without text was reported by the lexer.
+func (p *parser) errorExpected(what string) {
+	found := p.tok.String()
+	switch p.tok {
+	case illegal:
+		if p.lit == "" {
+			return
+		}
+		found = fmt.Sprintf("%q", p.lit)
+	case ident, number:
+		found += " " + p.lit
+	}
+	p.error(p.pos, "expected "+what+", found "+found)
+}
+
+func (p *parser) parseFile() {
+	for {
+		// A malformed entry may end at the @ of the next one.
+		if p.tok != at {
+			if !p.lx.skipJunk() {
+				return
+			}
+			p.next()
+		}
+		p.parseEntry()
+	}
+}
+
+// parseEntry parses an entry starting at the current @.
+func (p *parser) parseEntry() {
+	pos := p.pos
+	p.next() // consume @
+	if p.tok != ident {
+		p.errorExpected("entry type")
+		return
+	}
+	typ := strings.ToLower(p.lit)
+	p.next()
+
+	var close kind
+	switch p.tok {
+	case lbrace:
+		close = rbrace
+	case lparen:
+		close = rparen
+	default:
+		if typ != "comment" {
+			p.errorExpected("'{' or '('")
+		}
+		return
+	}
+
+	switch typ {
+	case "comment":
+		p.parseComment(close)
+	case "preamble":
+		p.parsePreamble(pos, close)
+	case "string":
+		p.parseString(close)
+	default:
+		p.parseRegular(pos, typ, close)
+	}
+}
+
+// parseComment skips the body of a @comment entry.
+func (p *parser) parseComment(close kind) {
+	open, end := byte('{'), byte('}')
+	if close == rparen {
+		open, end = '(', ')'
+	}
+	if _, _, ok := p.lx.group(open, end); !ok {
+		p.error(p.pos, "missing "+close.String()+" to close @comment")
+	}
+}
+
+func (p *parser) parsePreamble(pos token.Pos, close kind) {
+	p.next() // consume opening delimiter
+	parts, value, ok := p.parseValue()
+	if !ok {
+		return
+	}
+	if p.tok != close {
+		p.errorExpected(close.String())
+		return
+	}
+	p.f.Preambles = append(p.f.Preambles, &Preamble{Value: value, Parts: parts, Pos_: pos, End_: p.pos + 1})
+}
+
+func (p *parser) parseString(close kind) {
+	p.next() // consume opening delimiter
+	f := p.parseField()
+	if f == nil {
+		return
+	}
+	if p.tok != close {
+		p.errorExpected(close.String())
+		return
+	}
+	p.macros[f.Name] = f.Value
+	p.f.Strings = append(p.f.Strings, f)
+}
+
+// parseRegular parses the key and fields of an entry of type typ.
+func (p *parser) parseRegular(pos token.Pos, typ string, close kind) {
+	p.next() // consume opening delimiter
+	if p.tok != ident && p.tok != number {
+		p.errorExpected("entry key")
+		return
+	}
+	e := &Entry{Type: typ, Key: p.lit, KeyPos: p.pos, Pos_: pos}
+	p.next()
+
+	for p.tok == comma {
+		p.next()
+		if p.tok == close {
+			break // trailing comma
+		}
+		f := p.parseField()
+		if f == nil {
+			return
+		}
+		if e.Field(f.Name) != nil {
+			p.error(f.NamePos, fmt.Sprintf("duplicate field %s in entry %s", f.Name, e.Key))
+			continue
+		}
+		e.Fields = append(e.Fields, f)
+	}
+	if p.tok != close {
+		p.errorExpected("',' or " + close.String())
+		return
+	}
+	e.End_ = p.pos + 1
+
+	if first := p.f.keys[e.Key]; first != nil {
+		p.error(e.KeyPos, fmt.Sprintf("duplicate entry %s (first defined at %s)", e.Key, p.fset.Position(first.KeyPos)))
+	} else {
+		p.f.keys[e.Key] = e
+	}
+	p.f.Entries = append(p.f.Entries, e)
+}
+
+// parseField parses name = value and returns nil if it is malformed.
+func (p *parser) parseField() *Field {
+	if p.tok != ident {
+		p.errorExpected("field name")
+		return nil
+	}
+	f := &Field{Name: strings.ToLower(p.lit), NamePos: p.pos, Pos_: p.pos}
+	p.next()
+	if p.tok != equals {
+		p.errorExpected("'='")
+		return nil
+	}
+	p.next()
+	var ok bool
+	if f.Parts, f.Value, ok = p.parseValue(); !ok {
+		return nil
+	}
+	f.End_ = f.Parts[len(f.Parts)-1].End_
+	return f
+}
+
+// parseValue parses the parts of a value joined by # and returns them
+// with the expanded value. It stops at the token following the value.
+func (p *parser) parseValue() (parts []*Part, value string, ok bool) {
+	var b strings.Builder
+	for {
+		part := &Part{Lit: p.lit, Pos_: p.pos, End_: p.pos + token.Pos(len(p.lit))}
+		switch p.tok {
+		case lbrace:
+			var closed bool
+			_, part.Lit, closed = p.lx.group('{', '}')
+			if !closed {
+				p.error(p.pos, "missing '}' to close field value")
+				return nil, "", false
+			}
+			part.Kind = Braced
+			part.End_ = p.pos + token.Pos(len(part.Lit)) + 2
+			b.WriteString(part.Lit)
+		case quoted:
+			part.Kind = Quoted
+			part.End_ += 2
+			b.WriteString(part.Lit)
+		case number:
+			part.Kind = Number
+			b.WriteString(part.Lit)
+		case ident:
+			part.Kind = Macro
+			name := strings.ToLower(part.Lit)
+			if text, ok := p.macros[name]; ok {
+				b.WriteString(text)
+			} else if text, ok := months[name]; ok {
+				b.WriteString(text)
+			} else {
+				p.error(part.Pos_, "undefined string "+part.Lit)
+			}
+		default:
+			p.errorExpected("field value")
+			return nil, "", false
+		}
+		parts = append(parts, part)
+		p.next()
+		if p.tok != hash {
+			return parts, collapse(b.String()), true
+		}
+		p.next()
+	}
+}
+
+// collapse replaces each run of white space in s by a single space and
+// removes leading and trailing white space, as BibTeX does.
+func collapse(s string) string {
+	return strings.Join(strings.FieldsFunc(s, isSpace), " ")
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' || r == '\v'
+}
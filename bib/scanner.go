@@ -0,0 +1,219 @@
+package bib
+
+import "github.com/neox5/gotex/token"
+
+// A kind is the lexical class of a token in a .bib file.
+type kind int
+
+const (
+	illegal kind = iota
+	eof
+	at     // @
+	ident  // article, key2020, jan
+	number // 1984
+	quoted // "..."
+	lbrace // {
+	rbrace // }
+	lparen // (
+	rparen // )
+	comma  // ,
+	equals // =
+	hash   // #
+)
+
+var kinds = [...]string{
+	illegal: "illegal character",
+	eof:     "EOF",
+	at:      "'@'",
+	ident:   "name",
+	number:  "number",
+	quoted:  "quoted string",
+	lbrace:  "'{'",
+	rbrace:  "'}'",
+	lparen:  "'('",
+	rparen:  "')'",
+	comma:   "','",
+	equals:  "'='",
+	hash:    "'#'",
+}
+
+func (k kind) String() string { return kinds[k] }
+
+// A lexer splits the source of a .bib file into tokens. It never reads
+// past the current token, so that the parser can read the content of a
+// braced value with group right after its opening brace, and skip the
+// text between entries with skipJunk.
+type lexer struct {
+	file   *token.File
+	src    []byte
+	err    func(pos token.Pos, msg string)
+	offset int // offset of the next unread byte
+}
+
+func (l *lexer) init(file *token.File, src []byte, err func(pos token.Pos, msg string)) {
+	l.file = file
+	l.src = src
+	l.err = err
+	l.offset = 0
+}
+
+// skipJunk skips the text up to the next @, which BibTeX ignores. It
+// reports whether an @ was found.
+func (l *lexer) skipJunk() bool {
+	for l.offset < len(l.src) {
+		if l.src[l.offset] == '@' {
+			return true
+		}
+		l.offset++
+	}
+	return false
+}
+
+// skipSpace skips white space and comments. Inside entries, a % starts a
+// comment running to the end of the line, as in biber.
+func (l *lexer) skipSpace() {
+	for l.offset < len(l.src) {
+		switch l.src[l.offset] {
+		case ' ', '\t', '\n', '\r', '\f', '\v':
+			l.offset++
+		case '%':
+			for l.offset < len(l.src) && l.src[l.offset] != '\n' {
+				l.offset++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// isName reports whether ch may be part of a name: an entry type, key,
+// field name or string macro. Like BibTeX, names may contain most
+// punctuation; bytes of UTF-8 sequences are accepted as well.
+func isName(ch byte) bool {
+	switch ch {
+	case '"', '#', '%', '\'', '(', ')', ',', '=', '{', '}', '@':
+		return false
+	}
+	return ch > ' ' && ch != 0x7f
+}
+
+// next returns the next token. For a quoted string, lit is the text
+// between the quotes; for a name or number, it is the source text. An
+// unterminated quoted string is reported and returned as an illegal
+// token with an empty lit.
+func (l *lexer) next() (pos token.Pos, tok kind, lit string) {
+	l.skipSpace()
+	start := l.offset
+	pos = l.file.Pos(start)
+	if start >= len(l.src) {
+		return pos, eof, ""
+	}
+	ch := l.src[start]
+	l.offset++
+	switch ch {
+	case '@':
+		tok = at
+	case '{':
+		tok = lbrace
+	case '}':
+		tok = rbrace
+	case '(':
+		tok = lparen
+	case ')':
+		tok = rparen
+	case ',':
+		tok = comma
+	case '=':
+		tok = equals
+	case '#':
+		tok = hash
+	case '"':
+		tok = quoted
+		var ok bool
+		if lit, ok = l.quoted(); !ok {
+			l.err(pos, "quoted string not terminated")
+			tok = illegal
+		}
+	default:
+		if !isName(ch) {
+			return pos, illegal, string(ch)
+		}
+		digits := ch >= '0' && ch <= '9'
+		for l.offset < len(l.src) && isName(l.src[l.offset]) {
+			ch := l.src[l.offset]
+			digits = digits && ch >= '0' && ch <= '9'
+			l.offset++
+		}
+		lit = string(l.src[start:l.offset])
+		tok = ident
+		if digits {
+			tok = number
+		}
+	}
+	return
+}
+
+// quoted reads a quoted string after its opening quote. A quote inside
+// braces does not end the string. It reports whether the closing quote
+// was found.
+func (l *lexer) quoted() (string, bool) {
+	start := l.offset
+	depth := 0
+	for ; l.offset < len(l.src); l.offset++ {
+		switch l.src[l.offset] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			if depth <= 0 {
+				l.offset++
+				return string(l.src[start : l.offset-1]), true
+			}
+		case '@':
+			if l.atLineStart() {
+				return "", false
+			}
+		}
+	}
+	return "", false
+}
+
+// group reads the content of a group after its opening delimiter, up to
+// the matching close delimiter, and returns its position. Nested pairs of
+// delimiters are balanced. As a hand-edited file may lack a brace, an @
+// at the start of a line ends the group unterminated: it is taken to
+// start the next entry. group reports whether close was found.
+func (l *lexer) group(open, close byte) (token.Pos, string, bool) {
+	start := l.offset
+	depth := 0
+	for ; l.offset < len(l.src); l.offset++ {
+		switch ch := l.src[l.offset]; {
+		case ch == open:
+			depth++
+		case ch == close && depth == 0:
+			l.offset++
+			return l.file.Pos(start), string(l.src[start : l.offset-1]), true
+		case ch == close:
+			depth--
+		case ch == '@' && l.atLineStart():
+			return l.file.Pos(start), string(l.src[start:l.offset]), false
+		}
+	}
+	return l.file.Pos(start), string(l.src[start:]), false
+}
+
+// atLineStart reports whether only spaces and tabs precede the current
+// byte on its line.
+func (l *lexer) atLineStart() bool {
+	for i := l.offset - 1; i >= 0; i-- {
+		switch l.src[i] {
+		case ' ', '\t':
+		case '\n', '\r':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
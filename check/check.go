@@ -0,0 +1,299 @@
+// Package check reports commands that are used in gotex sources but never
+// defined, and calls with fewer mandatory arguments than the command
+// takes.
+//
+// A command is defined if it is known to the command registry (see
+// package command), defined in the file or in one of its imports with
+// \newcommand, \def, \NewDocumentCommand and their variants, or declared
+// with \let, \newlength, \newif, \DeclareMathOperator and the like.
+// Control symbols like \, and \% are always defined.
+//
+// Unlike TeX, the checker does not care about the order of definitions
+// and uses: a command defined anywhere in the file counts as defined.
+package check
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// An Error is a problem found by the checker.
+type Error struct {
+	Pos        token.Position
+	Msg        string
+	Suggestion string // for an undefined command, a defined one with a similar name, or ""
+}
+
+// Error returns the position and message of e, followed by the
+// suggestion, if any.
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean \\%s?)", e.Suggestion)
+	}
+	if e.Pos.Filename != "" || e.Pos.Line > 0 {
+		return fmt.Sprintf("%s: %s", e.Pos, msg)
+	}
+	return msg
+}
+
+// A Checker checks the use of commands.
+type Checker struct {
+	Fset *token.FileSet
+
+	// Commands holds the signatures of the commands built into the
+	// engine. If nil, command.Default() is used.
+	Commands *command.Registry
+
+	// Imports holds the files whose definitions are visible in the
+	// checked file, like the modules it imports. Later files override
+	// earlier ones.
+	Imports []*ast.File
+}
+
+// File checks src, the source of file. The errors are returned in source
+// order, together with the syntax errors of src as a [scanner.ErrorList].
+func (c *Checker) File(file *token.File, src []byte) ([]*Error, error) {
+	ch := &checker{
+		Checker:  c,
+		registry: c.Commands,
+		macros:   make(map[string]*ast.MacroDef),
+		declared: make(map[string]bool),
+		suggest:  make(map[string]string),
+	}
+	if ch.registry == nil {
+		ch.registry = command.Default()
+	}
+	for _, imp := range c.Imports {
+		for name, d := range imp.Macros {
+			ch.macros[name] = d
+		}
+	}
+	cfg := parser.Config{Mode: parser.ParseFull, Commands: ch.registry}
+	f, err := cfg.Parse(c.Fset, file, src)
+	for name, d := range f.Macros {
+		ch.macros[name] = d
+	}
+
+	// Arguments are matched by the parser. Macros are defined anywhere,
+	// so the source is parsed again with the signatures of all of them.
+	if len(ch.macros) > 0 {
+		cfg.Commands = ch.registry.Clone()
+		for name, d := range ch.macros {
+			cfg.Commands.Register(&command.Signature{Name: name, Args: macroSpec(d).String(), Mode: command.AnyMode})
+		}
+		f, err = cfg.Parse(c.Fset, file, src)
+	}
+
+	ch.collect(f)
+	toks := ch.scan(file, src)
+	ch.declare(toks)
+	ch.check(toks)
+	slices.SortStableFunc(ch.errors, func(a, b *Error) int { return a.Pos.Offset - b.Pos.Offset })
+	return ch.errors, err
+}
+
+type checker struct {
+	*Checker
+	registry *command.Registry
+	macros   map[string]*ast.MacroDef // definitions of the file and its imports
+	declared map[string]bool          // commands declared by \let, \newif, ...
+
+	skip []span // source not to scan: verbatim text and heads of definitions
+
+	suggest map[string]string // suggestions by undefined name
+	names   []string          // defined names, for suggestions
+	errors  []*Error
+}
+
+// A span is a range [start, end) of the source.
+type span struct{ start, end token.Pos }
+
+func sortSpans(spans []span) {
+	slices.SortFunc(spans, func(a, b span) int { return int(a.start - b.start) })
+}
+
+// collect records the parts of the source that are not to be scanned and
+// reports calls with missing arguments. The bodies of definitions are
+// not parsed for calls, as they may leave arguments to the caller.
+func (c *checker) collect(f *ast.File) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Verbatim:
+			// Skipping starts after \begin or \verb, which are scanned.
+			c.skip = append(c.skip, span{n.Pos() + 1, n.ContentPos + token.Pos(len(n.Content))})
+		case *ast.MacroDef:
+			c.skip = append(c.skip, span{n.Pos() + 1, n.BodyPos - 1}) // up to the brace of the body
+		case *ast.Command:
+			verbatim := false
+			if sig := c.registry.Lookup(n.Name); sig != nil && c.macros[n.Name] == nil {
+				verbatim = sig.Verbatim
+			}
+			have, want := 0, 0
+			for _, arg := range n.Args {
+				if arg.Present && (arg.Kind == 'v' || arg.Kind == 'm' && verbatim) {
+					c.skip = append(c.skip, span{arg.LitPos, arg.LitPos + token.Pos(len(arg.Lit))})
+				}
+				if p := (command.Param{Type: arg.Kind}); !p.Optional() {
+					want++
+					if arg.Present {
+						have++
+					}
+				}
+			}
+			if have < want {
+				c.error(n.Pos(), fmt.Sprintf("not enough arguments in call to \\%s (have %d, want %d)", n.Name, have, want), "")
+			}
+		}
+		return true
+	})
+	sortSpans(c.skip)
+}
+
+// A tok is a token of the checked source.
+type tok struct {
+	pos token.Pos
+	tok token.Token
+	lit string
+}
+
+// scan returns the tokens of the source without comments and skipped
+// text. Category codes are tracked as by the parser.
+func (c *checker) scan(file *token.File, src []byte) []tok {
+	var s scanner.Scanner
+	s.Init(c.Fset, file, src, nil) // errors are reported by the parser
+	s.SetMode(scanner.TrackCatcodes)
+
+	var toks []tok
+	next := 0 // next span to skip
+	for {
+		pos, t, lit := s.Scan()
+		if t == token.EOF {
+			return toks
+		}
+		for next < len(c.skip) && c.skip[next].end <= s.Pos() {
+			next++
+		}
+		if next < len(c.skip) && c.skip[next].start <= s.Pos() {
+			s.SkipTo(c.skip[next].end)
+			next++
+		}
+
+		if t == token.COMMENT {
+			continue
+		}
+		toks = append(toks, tok{pos, t, lit})
+	}
+}
+
+// declarations lists the commands declaring the command that follows
+// them, like \let\a\b or \newlength{\len}.
+var declarations = map[string]bool{
+	"let": true, "futurelet": true, "newif": true, "DeclareMathOperator": true,
+	"newlength": true, "newsavebox": true, "newcount": true, "newdimen": true,
+	"newskip": true, "newtoks": true, "newbox": true, "chardef": true,
+	"mathchardef": true, "countdef": true, "dimendef": true, "skipdef": true,
+	"toksdef": true,
+}
+
+// declare records the commands declared in toks.
+func (c *checker) declare(toks []tok) {
+	for i, t := range toks {
+		if t.tok != token.COMMAND {
+			continue
+		}
+		switch {
+		case declarations[t.lit]:
+			// The name may follow a star or a brace.
+			for _, name := range toks[i+1 : min(i+4, len(toks))] {
+				if name.tok == token.COMMAND || name.tok == token.CONTROL_SYMBOL {
+					c.declared[name.lit] = true
+					if t.lit == "newif" && strings.HasPrefix(name.lit, "if") {
+						c.declared[name.lit[2:]+"true"] = true
+						c.declared[name.lit[2:]+"false"] = true
+					}
+					break
+				}
+			}
+		case t.lit == "newcounter" || t.lit == "newenvironment" || t.lit == "renewenvironment":
+			// \newcounter{c} defines \thec; \newenvironment{e} defines \e and \ende.
+			if i+2 < len(toks) && toks[i+1].tok == token.LBRACE && toks[i+2].tok == token.WORD {
+				name := toks[i+2].lit
+				if t.lit == "newcounter" {
+					c.declared["the"+name] = true
+				} else {
+					c.declared[name] = true
+					c.declared["end"+name] = true
+				}
+			}
+		}
+	}
+}
+
+// lookup returns the argument specification of the command name and
+// whether it is defined. The specification of a \def macro with a
+// delimited parameter text is nil.
+func (c *checker) lookup(name string) (command.Spec, bool) {
+	if d := c.macros[name]; d != nil {
+		return macroSpec(d), true
+	}
+	if sig := c.registry.Lookup(name); sig != nil {
+		return sig.Spec(), true
+	}
+	return nil, c.declared[name]
+}
+
+// macroSpec returns the argument specification of the macro d.
+func macroSpec(d *ast.MacroDef) command.Spec {
+	var spec command.Spec
+	switch {
+	case d.IsDocumentCommand():
+		spec, _ = command.ParseSpec(d.Spec)
+		return spec
+	case d.IsDef():
+		if !undelimited(d.Params) {
+			return nil
+		}
+	case d.Default != nil && d.NArgs > 0:
+		spec = append(spec, command.Param{Type: 'O', Open: "[", Close: "]", Default: *d.Default})
+	}
+	for len(spec) < d.NArgs {
+		spec = append(spec, command.Param{Type: 'm'})
+	}
+	return spec
+}
+
+// undelimited reports whether the parameter text of \def is #1#2...#n.
+func undelimited(params string) bool {
+	for i := 1; params != ""; i++ {
+		p := fmt.Sprintf("#%d", i)
+		if !strings.HasPrefix(params, p) {
+			return false
+		}
+		params = params[len(p):]
+	}
+	return true
+}
+
+// check reports undefined commands in toks.
+func (c *checker) check(toks []tok) {
+	for _, t := range toks {
+		if t.tok != token.COMMAND {
+			continue
+		}
+		if _, defined := c.lookup(t.lit); !defined {
+			c.error(t.pos, "undefined command \\"+t.lit, c.suggestion(t.lit))
+		}
+	}
+}
+
+func (c *checker) error(pos token.Pos, msg, suggestion string) {
+	c.errors = append(c.errors, &Error{Pos: c.Fset.Position(pos), Msg: msg, Suggestion: suggestion})
+}
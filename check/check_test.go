@@ -0,0 +1,141 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// checkSource parses and checks src with the definitions of imports and
+// returns the errors as strings.
+func checkSource(t *testing.T, src string, imports ...string) []string {
+	t.Helper()
+	fset := token.NewFileSet()
+	var mods []*ast.File
+	for i, imp := range imports {
+		file := fset.AddFile(fmt.Sprintf("mod%d.tex", i), fset.Base(), len(imp))
+		f, err := parser.Parse(fset, file, []byte(imp), parser.ParseFull)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mods = append(mods, f)
+	}
+
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	c := &Checker{Fset: fset, Imports: mods}
+	list, _ := c.File(file, []byte(src)) // the parser reports missing arguments too
+	var errs []string
+	for _, err := range list {
+		errs = append(errs, err.Error())
+	}
+	return errs
+}
+
+func TestUndefined(t *testing.T) {
+	src := `\newcommand{\R}{\mathbb{R}}
+\def\pair#1#2{<#1, #2>}
+\let\emphasize\emph
+\newif\ifdraft
+\newcounter{step}
+\sectoin{Intro} \R \pair a b \emphasize{x} \draftfalse \thestep
+\alpha \, \% \Alpha \frc{1}{2}
+\begin{verbatim}\undefined\end{verbatim} \verb|\nope| \url{http://\nope}
+\makeatletter\@internal\makeatother
+\imported \ss \c{c} \o \v{s} \H{o} \S \ae \t{oo} \P`
+	got := checkSource(t, src, `\newcommand{\imported}{x}`)
+	want := []string{
+		`doc.tex:6:1: undefined command \sectoin (did you mean \section?)`,
+		`doc.tex:7:14: undefined command \Alpha (did you mean \alpha?)`,
+		`doc.tex:7:21: undefined command \frc (did you mean \frac?)`,
+		`doc.tex:9:14: undefined command \@internal`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	src := "\\def\\R{x"
+	fset := token.NewFileSet()
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	c := &Checker{Fset: fset}
+	_, err := c.File(file, []byte(src))
+	if list, ok := err.(scanner.ErrorList); !ok || len(list) != 1 || list[0].Msg != `missing '}' to close the body of \R` {
+		t.Errorf("got syntax errors %v", err)
+	}
+}
+
+func TestArity(t *testing.T) {
+	src := `\newcommand{\two}[2]{#1#2}
+\newcommand{\opt}[2][x]{#1#2}
+\NewDocumentCommand{\doc}{s o m D<>{d} r||}{#3}
+\newcommand{\half}{\frac{1}}
+\frac{1}
+
+\frac 1 2 \sqrt[3]{x} \two{a}
+
+\two{a}
+{b}
+{\opt{a} \opt[b]}
+\doc*{x}<y> \half{2} \section*`
+	got := checkSource(t, src)
+	want := []string{
+		`doc.tex:5:1: not enough arguments in call to \frac (have 1, want 2)`,
+		`doc.tex:7:23: not enough arguments in call to \two (have 1, want 2)`,
+		`doc.tex:11:10: not enough arguments in call to \opt (have 0, want 1)`,
+		`doc.tex:12:1: not enough arguments in call to \doc (have 1, want 2)`,
+		`doc.tex:12:22: not enough arguments in call to \section (have 0, want 1)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNestedCalls(t *testing.T) {
+	src := `\usepackage{natbib}
+\DeclareMathOperator{\Tr}{Tr}
+\newcommand{\two}[2]{#1#2}
+As shown by \citet{knuth} and others \citep[p.~2]{lamport}, see \cref{s}.
+\section{Trace \two{a}}
+\footnote{$\Tr A$ or \frac{1}}
+\citep
+
+\DeclareMathOperator`
+	got := checkSource(t, src)
+	want := []string{
+		`doc.tex:5:16: not enough arguments in call to \two (have 1, want 2)`,
+		`doc.tex:6:22: not enough arguments in call to \frac (have 1, want 2)`,
+		`doc.tex:7:1: not enough arguments in call to \citep (have 0, want 1)`,
+		`doc.tex:9:1: not enough arguments in call to \DeclareMathOperator (have 0, want 2)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"section", "section", 0},
+		{"sectoin", "section", 1},
+		{"frc", "frac", 1},
+		{"alpha", "Alpha", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, c := range cases {
+		if got := distance(c.a, c.b, 10); got != c.want {
+			t.Errorf("distance(%q, %q) = %d; want %d", c.a, c.b, got, c.want)
+		}
+	}
+	if got := distance("kitten", "sitting", 2); got != 2 {
+		t.Errorf("limited distance = %d; want 2", got)
+	}
+}
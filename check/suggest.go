@@ -0,0 +1,82 @@
+package check
+
+import (
+	"maps"
+	"slices"
+)
+
+// suggestion returns the defined command whose name is closest to name,
+// or "" if none is close enough to be a likely typo.
+func (c *checker) suggestion(name string) string {
+	if s, ok := c.suggest[name]; ok {
+		return s
+	}
+	if c.names == nil {
+		seen := make(map[string]bool)
+		for _, n := range c.registry.Names() {
+			seen[n] = true
+		}
+		for n := range c.macros {
+			seen[n] = true
+		}
+		for n := range c.declared {
+			seen[n] = true
+		}
+		c.names = slices.Sorted(maps.Keys(seen))
+	}
+
+	// Allow one edit for short names and one more per three letters.
+	best, bestDist := "", max(1, len(name)/3)+1
+	for _, n := range c.names {
+		if d := distance(name, n, bestDist); d < bestDist && d < len(name) {
+			best, bestDist = n, d
+		}
+	}
+	c.suggest[name] = best
+	return best
+}
+
+// distance returns the Damerau-Levenshtein distance of a and b: the number
+// of insertions, deletions, substitutions and transpositions of adjacent
+// characters turning a into b. Distances of limit or more are returned
+// as limit.
+func distance(a, b string, limit int) int {
+	s, t := []rune(a), []rune(b)
+	if abs(len(s)-len(t)) >= limit {
+		return limit
+	}
+	// Rows i-2, i-1 and i of the distance matrix.
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin >= limit {
+			return limit
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(t)], limit)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
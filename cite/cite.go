@@ -0,0 +1,166 @@
+// Package cite checks the citations of gotex documents against their
+// bibliographies.
+//
+// [Check] resolves the citation keys of an [xref.Index] against the
+// entries of parsed .bib files and reports citations of missing entries,
+// entries that are never cited and keys defined in more than one file. A
+// [Loader] finds the bibliography files of a document spread over several
+// files, as named by \bibliography and \addbibresource, and checks them.
+//
+// The [Report] of a check can be written as JSON for continuous
+// integration.
+package cite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/neox5/gotex/bib"
+	"github.com/neox5/gotex/token"
+	"github.com/neox5/gotex/xref"
+)
+
+// ProblemKind classifies the problems found by [Check].
+type ProblemKind int
+
+const (
+	Missing   ProblemKind = iota // citation of a key without entry
+	Unused                       // entry never cited
+	Duplicate                    // key defined in more than one file
+	Malformed                    // syntax error in a bibliography file
+)
+
+var problemNames = [...]string{
+	Missing:   "missing",
+	Unused:    "unused",
+	Duplicate: "duplicate",
+	Malformed: "malformed",
+}
+
+func (k ProblemKind) String() string {
+	if 0 <= k && int(k) < len(problemNames) {
+		return problemNames[k]
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// A Problem is a missing citation, an unused or duplicate entry, or a
+// syntax error in a bibliography file.
+type Problem struct {
+	Kind ProblemKind
+	Key  string // citation key; "" for a syntax error
+	Pos  token.Position
+	Msg  string
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Pos, p.Msg)
+}
+
+// MarshalJSON encodes p as an object with the members kind, key, file,
+// line, column and message.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Kind    string `json:"kind"`
+		Key     string `json:"key,omitempty"`
+		File    string `json:"file"`
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Message string `json:"message"`
+	}{p.Kind.String(), p.Key, p.Pos.Filename, p.Pos.Line, p.Pos.Column, p.Msg})
+}
+
+// A Report is the result of a check.
+type Report struct {
+	Bibliographies []string   `json:"bibliographies"` // names of the .bib files checked
+	Citations      int        `json:"citations"`      // number of cited keys, including repetitions
+	Entries        int        `json:"entries"`        // number of bibliography entries
+	Problems       []*Problem `json:"problems"`       // sorted by position
+}
+
+// WriteJSON writes r to w as an indented JSON object.
+func (r *Report) WriteJSON(w io.Writer) error {
+	out := *r
+	if out.Bibliographies == nil {
+		out.Bibliographies = []string{}
+	}
+	if out.Problems == nil {
+		out.Problems = []*Problem{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&out)
+}
+
+// Check resolves the citations of x against the entries of files and
+// returns the report of the problems found. The crossref fields of the
+// entries should be resolved, so that the parent of a cited entry counts
+// as cited; see [bib.ResolveCrossrefs].
+//
+// A citation of a key without entry is reported at the citation, an entry
+// never cited at its key. \nocite{*} cites all entries. A key defined in
+// more than one file is reported at each definition but the first; keys
+// defined twice in the same file are reported by the bib parser.
+func Check(x *xref.Index, files []*bib.File) *Report {
+	r := &Report{Citations: len(x.Cites)}
+	add := func(kind ProblemKind, key string, pos token.Pos, msg string) {
+		r.Problems = append(r.Problems, &Problem{Kind: kind, Key: key, Pos: x.Fset.Position(pos), Msg: msg})
+	}
+
+	entries := make(map[string]*bib.Entry)
+	var all []*bib.Entry
+	for _, f := range files {
+		r.Bibliographies = append(r.Bibliographies, f.Filename)
+		for _, e := range f.Entries {
+			r.Entries++
+			first := entries[e.Key]
+			switch {
+			case first == nil:
+				entries[e.Key] = e
+				all = append(all, e)
+			case f.Lookup(e.Key) == e: // first of its file
+				add(Duplicate, e.Key, e.KeyPos, fmt.Sprintf("duplicate entry %s (first defined at %s)", e.Key, x.Fset.Position(first.KeyPos)))
+			}
+		}
+	}
+
+	cited := make(map[*bib.Entry]bool)
+	citeAll := false
+	for _, c := range x.Cites {
+		if c.Name == "*" && c.Cmd == "nocite" {
+			citeAll = true
+			continue
+		}
+		e := entries[c.Name]
+		if e == nil {
+			add(Missing, c.Name, c.Pos, fmt.Sprintf("no bibliography entry for citation %s", c.Name))
+			continue
+		}
+		for ; e != nil && !cited[e]; e = e.Parent {
+			cited[e] = true
+		}
+	}
+	if !citeAll {
+		for _, e := range all {
+			if !cited[e] {
+				add(Unused, e.Key, e.KeyPos, fmt.Sprintf("entry %s is never cited", e.Key))
+			}
+		}
+	}
+
+	sortProblems(r.Problems)
+	return r
+}
+
+// sortProblems sorts problems by position.
+func sortProblems(problems []*Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Pos, problems[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+}
@@ -0,0 +1,121 @@
+package cite
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+func load(t *testing.T, files map[string]string) (*Report, error) {
+	t.Helper()
+	dir := filepath.FromSlash("/doc")
+	l := &Loader{
+		Fset: token.NewFileSet(),
+		ReadFile: func(name string) ([]byte, error) {
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			if data, ok := files[filepath.ToSlash(rel)]; ok {
+				return []byte(data), nil
+			}
+			return nil, fs.ErrNotExist
+		},
+	}
+	return l.Load(filepath.Join(dir, "main.tex"))
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string]string{
+		"main.tex": `\input{intro}
+See \citep[p.~3]{knuth84, missing} and \parencite{paper}.
+\bibliography{refs,more}
+\addbibresource{more.bib}
+\addbibresource{absent.bib}
+`,
+		"intro.tex": `\cite{lamport94}`,
+		"refs.bib": `@book{knuth84, title = {The {\TeX}book}}
+@book{lamport94, title = {\LaTeX}}
+@inproceedings{paper, title = {A Paper}, crossref = {proc}}
+@misc{unused, note = {Never cited}}
+@misc{broken, title = {x} year = 1}
+`,
+		"more.bib": `@proceedings{proc, title = {Proceedings}}
+@book{knuth84, title = {Again}}
+`,
+	}
+	r, err := load(t, files)
+	if r == nil {
+		t.Fatal(err)
+	}
+	errs, ok := err.(scanner.ErrorList)
+	if !ok || len(errs) != 1 || errs[0].Msg != `cannot find bibliography "absent.bib"` || errs[0].Pos.Line != 5 {
+		t.Errorf("got error %v", err)
+	}
+
+	var got []string
+	for _, p := range r.Problems {
+		got = append(got, p.Kind.String()+" "+p.Error())
+	}
+	want := []string{
+		"missing /doc/main.tex:2:27: no bibliography entry for citation missing",
+		"duplicate /doc/more.bib:2:7: duplicate entry knuth84 (first defined at /doc/refs.bib:1:7)",
+		"unused /doc/refs.bib:4:7: entry unused is never cited",
+		"malformed /doc/refs.bib:5:27: expected ',' or '}', found name year",
+	}
+	if filepath.Separator != '/' {
+		t.Skip("positions use slash-separated file names")
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if r.Citations != 4 || r.Entries != 6 || len(r.Bibliographies) != 2 {
+		t.Errorf("got %d citations, %d entries, bibliographies %v", r.Citations, r.Entries, r.Bibliographies)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Bibliographies []string
+		Citations      int
+		Problems       []map[string]any
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	first := decoded.Problems[0]
+	if first["kind"] != "missing" || first["key"] != "missing" || first["file"] != "/doc/main.tex" || first["line"] != 2.0 || first["column"] != 27.0 {
+		t.Errorf("got JSON problem %v", first)
+	}
+	if _, ok := decoded.Problems[3]["key"]; ok {
+		t.Errorf("syntax error has a key: %v", decoded.Problems[3])
+	}
+}
+
+func TestNociteAll(t *testing.T) {
+	r, err := load(t, map[string]string{
+		"main.tex": `\nocite{*}\bibliography{refs}`,
+		"refs.bib": `@misc{a} @misc{b}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Problems) != 0 {
+		t.Errorf("got problems %v", r.Problems)
+	}
+
+	var buf bytes.Buffer
+	r, _ = load(t, map[string]string{"main.tex": `No citations.`})
+	r.WriteJSON(&buf)
+	if want := "{\n  \"bibliographies\": [],\n  \"citations\": 0,\n  \"entries\": 0,\n  \"problems\": []\n}\n"; buf.String() != want {
+		t.Errorf("got JSON %s; want %s", buf.String(), want)
+	}
+}
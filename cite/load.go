@@ -0,0 +1,81 @@
+package cite
+
+import (
+	"fmt"
+
+	"github.com/neox5/gotex/bib"
+	"github.com/neox5/gotex/loader"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+	"github.com/neox5/gotex/xref"
+)
+
+// A Loader checks the citations of a document spread over several files.
+// It loads the document with a [loader.Loader] and indexes it, reads the
+// bibliography files named by \bibliography and \addbibresource, and
+// checks the citations against their entries.
+type Loader struct {
+	Fset *token.FileSet
+
+	// ReadFile reads the named file. If nil, os.ReadFile is used.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// Load returns the report of the document whose main file is filename.
+// Bibliography files are resolved like included files, as described in
+// package loader; the extension .bib may be omitted, as it must be for
+// \bibliography. A file named twice is read once. Syntax errors in
+// bibliography files are reported as [Malformed] problems, and their
+// crossref fields are resolved across files.
+//
+// Files of the document and bibliography files that cannot be read or
+// parsed are reported in a [scanner.ErrorList] sorted by source position;
+// the report of the remaining files is returned nonetheless.
+func (l *Loader) Load(filename string) (*Report, error) {
+	ll := &loader.Loader{Fset: l.Fset, ReadFile: l.ReadFile}
+	doc, err := ll.Load(filename)
+	if doc == nil {
+		return nil, err
+	}
+	var errors scanner.ErrorList
+	if list, ok := err.(scanner.ErrorList); ok {
+		errors = list
+	}
+	x := xref.NewIndex(l.Fset)
+	x.AddDocument(doc)
+
+	var files []*bib.File
+	var malformed scanner.ErrorList
+	loaded := make(map[string]bool)
+	for _, r := range x.Bibs {
+		name, src := ll.Find(doc.Dirs, r.Name, ".bib")
+		switch {
+		case name == "":
+			errors.Add(l.Fset.Position(r.Pos), fmt.Sprintf("cannot find bibliography %q", r.Name))
+			continue
+		case loaded[name]:
+			continue
+		}
+		loaded[name] = true
+		file := l.Fset.AddFile(name, l.Fset.Base(), len(src))
+		f, err := bib.Parse(l.Fset, file, src)
+		if list, ok := err.(scanner.ErrorList); ok {
+			malformed = append(malformed, list...)
+		}
+		files = append(files, f)
+	}
+
+	var entries []*bib.Entry
+	for _, f := range files {
+		entries = append(entries, f.Entries...)
+	}
+	bib.ResolveCrossrefs(entries)
+
+	report := Check(x, files)
+	for _, e := range malformed {
+		report.Problems = append(report.Problems, &Problem{Kind: Malformed, Pos: e.Pos, Msg: e.Msg})
+	}
+	sortProblems(report.Problems)
+	errors.Sort()
+	return report, errors.Err()
+}
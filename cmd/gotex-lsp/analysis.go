@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/loader"
+	"github.com/neox5/gotex/outline"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// tokenInfo is a single scanned token.
+type tokenInfo struct {
+	offs int // byte offset of the token in the document
+	tok  token.Token
+	lit  string
+}
+
+// analysis holds the result of scanning and parsing a document.
+type analysis struct {
+	doc     *document
+	file    *token.File
+	imports []*ast.ImportSpec
+	dirs    []string // directories against which imports are resolved
+	errors  scanner.ErrorList
+	tokens  []tokenInfo
+}
+
+// analyze scans and parses doc.
+func analyze(doc *document) *analysis {
+	fset, file := doc.fset, doc.file
+	a := &analysis{doc: doc, file: file}
+
+	// The imports-only parse reports scanner errors and malformed imports.
+	f, err := parser.Parse(fset, file, doc.text, parser.ImportsOnly)
+	if f != nil {
+		a.imports = f.Imports
+		a.dirs = loader.Dirs(doc.path, f)
+	}
+	if list, ok := err.(scanner.ErrorList); ok {
+		a.errors = list
+	}
+
+	var s scanner.Scanner
+	s.Init(fset, file, doc.text, nil)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		a.tokens = append(a.tokens, tokenInfo{a.offset(pos), tok, lit})
+	}
+	return a
+}
+
+// offset returns the byte offset of p in the document.
+func (a *analysis) offset(p token.Pos) int {
+	return int(p) - a.file.Base()
+}
+
+// diagnostics returns the syntax errors of the document.
+func (a *analysis) diagnostics() []Diagnostic {
+	diags := []Diagnostic{} // never nil: an empty list clears the client's diagnostics
+	for _, e := range a.errors {
+		diags = append(diags, a.diagnostic(e.Pos.Offset, e.Msg))
+	}
+	return diags
+}
+
+func (a *analysis) diagnostic(offs int, msg string) Diagnostic {
+	end := offs
+	if end < len(a.doc.text) {
+		end++ // highlight at least one byte
+	}
+	return Diagnostic{
+		Range:    a.doc.rangeOf(offs, end),
+		Severity: SeverityError,
+		Source:   "gotex",
+		Message:  msg,
+	}
+}
+
+// commandEnd returns the end offset of the command token t, or -1 if the
+// token literal does not match the source.
+func (a *analysis) commandEnd(t tokenInfo) int {
+	end := t.offs + 1 + len(t.lit)
+	if end > len(a.doc.text) || !bytes.Equal(a.doc.text[t.offs+1:end], []byte(t.lit)) {
+		return -1
+	}
+	return end
+}
+
+// commandAt returns the command token at byte offset offs.
+func (a *analysis) commandAt(offs int) (tokenInfo, int, bool) {
+	for _, t := range a.tokens {
+		if t.offs > offs {
+			break
+		}
+		switch t.tok {
+		case token.COMMAND, token.CONTROL_SYMBOL, token.IMPORT, token.ENV, token.ENVEND:
+			if end := a.commandEnd(t); end >= 0 && offs < end {
+				return t, end, true
+			}
+		}
+	}
+	return tokenInfo{}, 0, false
+}
+
+// importAt returns the import spec enclosing byte offset offs, or nil.
+func (a *analysis) importAt(offs int) *ast.ImportSpec {
+	for _, imp := range a.imports {
+		if a.offset(imp.Pos()) <= offs && offs < a.offset(imp.End()) {
+			return imp
+		}
+	}
+	return nil
+}
+
+// resolveImport returns the file targeted by imp, or "" if it cannot be
+// found. Relative names are resolved against each of dirs in turn. Modules
+// resolve to their gotex.mod, or to their first .tex file if the module
+// has no gotex.mod.
+func resolveImport(dirs []string, imp *ast.ImportSpec) string {
+	if imp.Cmd != "usemodule" {
+		var l loader.Loader
+		target, _ := l.Resolve(dirs, imp)
+		return target
+	}
+	for _, dir := range dirs {
+		name := filepath.FromSlash(imp.Name)
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+			if target := moduleEntry(name); target != "" {
+				return target
+			}
+		}
+	}
+	return ""
+}
+
+func moduleEntry(dir string) string {
+	if mod := filepath.Join(dir, "gotex.mod"); fileExists(mod) {
+		return mod
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.tex"))
+	if len(matches) == 0 {
+		return ""
+	}
+	slices.Sort(matches)
+	return matches[0]
+}
+
+func fileExists(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && !fi.IsDir()
+}
+
+// ----------------------------------------------------------------------------
+// Document symbols
+
+// documentSymbols returns the section outline of the document.
+func (a *analysis) documentSymbols() []DocumentSymbol {
+	syms := a.symbols(outline.File(a.file, a.doc.text))
+	if syms == nil {
+		return []DocumentSymbol{}
+	}
+	return syms
+}
+
+func (a *analysis) symbols(list []*outline.Section) []DocumentSymbol {
+	var syms []DocumentSymbol
+	for _, sec := range list {
+		syms = append(syms, DocumentSymbol{
+			Name:           sec.Title,
+			Detail:         "\\" + sec.Cmd(),
+			Kind:           SymbolKindNamespace,
+			Range:          a.doc.rangeOf(a.offset(sec.Pos), a.offset(sec.End)),
+			SelectionRange: a.doc.rangeOf(a.offset(sec.TitlePos), a.offset(sec.TitleEnd)),
+			Children:       a.symbols(sec.Children),
+		})
+	}
+	return syms
+}
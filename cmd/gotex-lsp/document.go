@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/neox5/gotex/token"
+)
+
+// document is an open text document as seen by the client.
+type document struct {
+	uri     string
+	path    string // file system path derived from uri
+	version int
+	text    []byte
+
+	fset *token.FileSet
+	file *token.File // line table for text
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{
+		uri:     uri,
+		path:    uriToPath(uri),
+		version: version,
+	}
+	d.setText([]byte(text))
+	return d
+}
+
+// setText replaces the document content and recomputes its line table.
+func (d *document) setText(text []byte) {
+	d.text = text
+	d.fset = token.NewFileSet()
+	d.file = d.fset.AddFile(d.path, d.fset.Base(), len(text))
+	d.file.SetLinesForContent(text)
+}
+
+// applyChange applies a single content change event to the document.
+func (d *document) applyChange(change TextDocumentContentChangeEvent) error {
+	if change.Range == nil {
+		d.setText([]byte(change.Text))
+		return nil
+	}
+
+	start := d.offset(change.Range.Start)
+	end := d.offset(change.Range.End)
+	if start > end {
+		return fmt.Errorf("invalid range %v: start after end", *change.Range)
+	}
+
+	text := make([]byte, 0, len(d.text)-(end-start)+len(change.Text))
+	text = append(text, d.text[:start]...)
+	text = append(text, change.Text...)
+	text = append(text, d.text[end:]...)
+	d.setText(text)
+	return nil
+}
+
+// offset converts an LSP position into a byte offset in the document.
+// Positions past the end of a line are clamped to the line end, and
+// positions past the last line are clamped to the end of the document.
+func (d *document) offset(pos Position) int {
+	if pos.Line >= d.file.LineCount() {
+		return len(d.text)
+	}
+	line := max(pos.Line, 0) + 1
+	col := max(pos.Character, 0) + 1
+	return int(d.file.PosUTF16(line, col, d.text)) - d.file.Base()
+}
+
+// position converts a byte offset in the document into an LSP position.
+func (d *document) position(offs int) Position {
+	offs = min(max(offs, 0), len(d.text))
+	if offs == len(d.text) && offs > 0 && (d.text[offs-1] == '\n' || d.text[offs-1] == '\r') {
+		// The empty last line has no entry in the line table.
+		return Position{Line: d.file.LineCount(), Character: 0}
+	}
+	p := d.file.PositionUTF16(d.file.Pos(offs), d.text)
+	return Position{Line: p.Line - 1, Character: p.Column - 1}
+}
+
+// rangeOf converts the byte range [start, end) into an LSP range.
+func (d *document) rangeOf(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// uriToPath converts a file:// URI into a file system path. Other URIs
+// are returned unchanged.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathToURI converts a file system path into a file:// URI.
+func pathToURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
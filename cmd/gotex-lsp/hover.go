@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/token"
+)
+
+// commands holds the signatures shown on hover.
+var commands = command.Default()
+
+// commandDocs describes the commands known to the server.
+// The key is the command name without backslash.
+var commandDocs = map[string]string{
+	"import":        "Imports another gotex file.",
+	"input":         "Inserts the contents of file at this point.",
+	"include":       "Inserts the contents of file on a new page.",
+	"usemodule":     "Makes the definitions of a gotex module available.",
+	"begin":         "Opens the environment env.",
+	"end":           "Closes the environment env.",
+	"documentclass": "Selects the document class.",
+	"part":          "Starts a new part.",
+	"chapter":       "Starts a new chapter.",
+	"section":       "Starts a new section.",
+	"subsection":    "Starts a new subsection.",
+	"subsubsection": "Starts a new subsubsection.",
+	"paragraph":     "Starts a new run-in paragraph heading.",
+	"subparagraph":  "Starts a new run-in subparagraph heading.",
+	"label":         "Defines a cross-reference target.",
+	"ref":           "Prints the number of the target labelled key.",
+	"cite":          "Cites bibliography entries.",
+	"newline":       "Ends the current line without ending the paragraph.",
+	"\\":            "Ends the current line; a star prevents a page break after it, and an optional length adds vertical space.",
+	",":             "Thin space.",
+	":":             "Medium space.",
+	";":             "Thick space.",
+	"!":             "Negative thin space.",
+	" ":             "Interword space that does not stretch.",
+	"-":             "Hyphenation point.",
+	"/":             "Italic correction.",
+	"@":             "Makes a following period end a sentence.",
+	"'":             "Acute accent: ó.",
+	"`":             "Grave accent: ò.",
+	"\"":            "Umlaut: ö.",
+	"^":             "Circumflex: ô.",
+	"~":             "Tilde: õ.",
+	"=":             "Macron: ō.",
+	".":             "Dot accent: ȯ.",
+	"matrix":        "Built-in matrix primitive.",
+	"grid":          "Built-in grid layout primitive.",
+}
+
+// hover returns the hover text for the command at byte offset offs, or nil.
+func (a *analysis) hover(offs int) *Hover {
+	t, end, ok := a.commandAt(offs)
+	if !ok {
+		return nil
+	}
+	name := t.lit
+	if t.tok == token.CONTROL_SYMBOL && name == "\\*" {
+		name = "\\" // the star of \\ is its first argument
+	}
+
+	var b strings.Builder
+	b.WriteString("```latex\n")
+	sig := commands.Lookup(name)
+	if sig != nil {
+		b.WriteString(usage(sig))
+	} else {
+		b.WriteString("\\" + name)
+	}
+	b.WriteString("\n```\n")
+	switch doc, ok := commandDocs[name]; {
+	case ok:
+		b.WriteString(doc)
+	case sig != nil:
+		b.WriteString("Built-in command.")
+	default:
+		b.WriteString("User-defined or unknown command.")
+	}
+
+	r := a.doc.rangeOf(t.offs, end)
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: b.String()},
+		Range:    &r,
+	}
+}
+
+// usage returns the command of sig followed by a placeholder for each of
+// its arguments, like \section*[…]{…}.
+func usage(sig *command.Signature) string {
+	var b strings.Builder
+	b.WriteString("\\" + sig.Name)
+	for _, p := range sig.Spec() {
+		switch p.Type {
+		case 's':
+			b.WriteString("*")
+		case 't':
+			b.WriteString(p.Open)
+		case 'm', 'v':
+			b.WriteString("{…}")
+		default:
+			b.WriteString(p.Open + "…" + p.Close)
+		}
+	}
+	return b.String()
+}
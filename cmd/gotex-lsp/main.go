@@ -0,0 +1,49 @@
+// Gotex-lsp is a Language Server Protocol server for gotex sources.
+//
+// It speaks LSP over stdin/stdout and provides:
+//
+//   - diagnostics for scanner and import errors
+//   - go-to-definition on \import, \input, \include and \usemodule targets
+//   - document symbols for sectioning commands
+//   - hover information for commands
+//
+// Usage:
+//
+//	gotex-lsp [-log file]
+//
+// Log output goes to stderr unless -log is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+func main() {
+	logfile := flag.String("log", "", "write log output to `file`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gotex-lsp [-log file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var w io.Writer = os.Stderr
+	if *logfile != "" {
+		f, err := os.OpenFile(*logfile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gotex-lsp: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	logger := log.New(w, "gotex-lsp: ", log.LstdFlags)
+
+	if err := newServer(os.Stdin, os.Stdout, logger).run(); err != nil {
+		logger.Print(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// errExit is returned by handle when the client sent the exit notification.
+var errExit = errors.New("exit")
+
+// server is a language server for gotex sources. It handles one request at
+// a time; documents are re-analyzed on every change.
+type server struct {
+	conn   *conn
+	logger *log.Logger
+
+	docs     map[string]*document // open documents by URI
+	shutdown bool                 // shutdown request received
+}
+
+func newServer(r io.Reader, w io.Writer, logger *log.Logger) *server {
+	return &server{
+		conn:   newConn(r, w),
+		logger: logger,
+		docs:   make(map[string]*document),
+	}
+}
+
+// run serves requests until the client exits or the connection is closed.
+func (s *server) run() error {
+	for {
+		body, err := s.conn.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.conn.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+
+		if err := s.handle(&req); err != nil {
+			if err == errExit {
+				return nil
+			}
+			s.logger.Printf("%s: %v", req.Method, err)
+		}
+	}
+}
+
+// handle dispatches a single request or notification.
+func (s *server) handle(req *request) error {
+	if s.shutdown && req.Method != "exit" {
+		if !req.isNotification() {
+			return s.conn.replyError(req.ID, codeInvalidRequest, "server is shutting down")
+		}
+		return nil
+	}
+
+	var (
+		result any
+		err    error
+	)
+	switch req.Method {
+	case "initialize":
+		result = s.initialize()
+	case "initialized":
+	case "shutdown":
+		s.shutdown = true
+	case "exit":
+		return errExit
+
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err = unmarshalParams(req, &params); err == nil {
+			err = s.didOpen(&params)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err = unmarshalParams(req, &params); err == nil {
+			err = s.didChange(&params)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err = unmarshalParams(req, &params); err == nil {
+			err = s.didClose(&params)
+		}
+
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err = unmarshalParams(req, &params); err == nil {
+			result, err = s.definition(&params)
+		}
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err = unmarshalParams(req, &params); err == nil {
+			result, err = s.documentSymbol(&params)
+		}
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err = unmarshalParams(req, &params); err == nil {
+			result, err = s.hover(&params)
+		}
+
+	default:
+		if req.isNotification() {
+			return nil // unknown notifications are ignored
+		}
+		return s.conn.replyError(req.ID, codeMethodNotFound, "method not supported: "+req.Method)
+	}
+
+	if req.isNotification() {
+		return err
+	}
+	if err != nil {
+		code := codeInternalError
+		var rerr *responseError
+		if errors.As(err, &rerr) {
+			code = rerr.Code
+		}
+		return s.conn.replyError(req.ID, code, err.Error())
+	}
+	return s.conn.reply(req.ID, result)
+}
+
+func unmarshalParams(req *request, v any) error {
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return &responseError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+func (s *server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{codeInvalidParams, "document not open: " + uri}
+	}
+	return doc, nil
+}
+
+// ----------------------------------------------------------------------------
+// Lifecycle
+
+func (s *server) initialize() *InitializeResult {
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			PositionEncoding: "utf-16",
+			TextDocumentSync: TextDocumentSyncOptions{
+				OpenClose: true,
+				Change:    SyncIncremental,
+			},
+			DefinitionProvider:     true,
+			DocumentSymbolProvider: true,
+			HoverProvider:          true,
+		},
+		ServerInfo: ServerInfo{Name: "gotex-lsp"},
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Synchronization
+
+func (s *server) didOpen(params *DidOpenTextDocumentParams) error {
+	item := params.TextDocument
+	doc := newDocument(item.URI, item.Version, item.Text)
+	s.docs[item.URI] = doc
+	return s.publishDiagnostics(doc)
+}
+
+func (s *server) didChange(params *DidChangeTextDocumentParams) error {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return err
+	}
+	for _, change := range params.ContentChanges {
+		if err := doc.applyChange(change); err != nil {
+			return fmt.Errorf("%s: %v", doc.uri, err)
+		}
+	}
+	doc.version = params.TextDocument.Version
+	return s.publishDiagnostics(doc)
+}
+
+func (s *server) didClose(params *DidCloseTextDocumentParams) error {
+	uri := params.TextDocument.URI
+	delete(s.docs, uri)
+	// Clear diagnostics of the closed document.
+	return s.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+func (s *server) publishDiagnostics(doc *document) error {
+	return s.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: analyze(doc).diagnostics(),
+	})
+}
+
+// ----------------------------------------------------------------------------
+// Language features
+
+// definition resolves the \input, \include, \import or \usemodule target
+// under the cursor.
+func (s *server) definition(params *TextDocumentPositionParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	a := analyze(doc)
+	imp := a.importAt(doc.offset(params.Position))
+	if imp == nil {
+		return nil, nil
+	}
+	if target := resolveImport(a.dirs, imp); target != "" {
+		return &Location{URI: pathToURI(target)}, nil
+	}
+	return nil, nil
+}
+
+func (s *server) documentSymbol(params *DocumentSymbolParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return analyze(doc).documentSymbols(), nil
+}
+
+func (s *server) hover(params *TextDocumentPositionParams) (any, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	if h := analyze(doc).hover(doc.offset(params.Position)); h != nil {
+		return h, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// frame encodes msg as an LSP base protocol message.
+func frame(t *testing.T, msg any) string {
+	t.Helper()
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// runSession feeds msgs to a server and returns all messages it wrote.
+func runSession(t *testing.T, msgs ...any) []map[string]json.RawMessage {
+	t.Helper()
+	var in strings.Builder
+	for _, m := range msgs {
+		in.WriteString(frame(t, m))
+	}
+	var out bytes.Buffer
+	s := newServer(strings.NewReader(in.String()), &out, log.New(io.Discard, "", 0))
+	if err := s.run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var replies []map[string]json.RawMessage
+	c := newConn(&out, nil)
+	for {
+		body, err := c.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading reply: %v", err)
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(body, &m); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, m)
+	}
+	return replies
+}
+
+// result returns the result of the response with the given id.
+func result(t *testing.T, replies []map[string]json.RawMessage, id int, v any) {
+	t.Helper()
+	for _, m := range replies {
+		if string(m["id"]) == fmt.Sprint(id) {
+			if e, ok := m["error"]; ok {
+				t.Fatalf("request %d failed: %s", id, e)
+			}
+			if err := json.Unmarshal(m["result"], v); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response for request %d", id)
+}
+
+func req(id int, method string, params any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+func notif(method string, params any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+}
+
+func TestOffsetPositionUTF16(t *testing.T) {
+	doc := newDocument("file:///units.tex", 1, "a€b\n𝄞x\n")
+	cases := []struct {
+		offs int
+		pos  Position
+	}{
+		{0, Position{0, 0}},
+		{1, Position{0, 1}},  // €
+		{4, Position{0, 2}},  // b (€ is 3 bytes, 1 code unit)
+		{6, Position{1, 0}},  // 𝄞
+		{10, Position{1, 2}}, // x (𝄞 is 4 bytes, 2 code units)
+		{12, Position{2, 0}},
+	}
+	for _, c := range cases {
+		if got := doc.position(c.offs); got != c.pos {
+			t.Errorf("position(%d) = %v; want %v", c.offs, got, c.pos)
+		}
+		if got := doc.offset(c.pos); got != c.offs {
+			t.Errorf("offset(%v) = %d; want %d", c.pos, got, c.offs)
+		}
+	}
+
+	// Positions past the end of a line are clamped.
+	if got := doc.offset(Position{0, 99}); got != 5 {
+		t.Errorf("offset past line end = %d; want 5", got)
+	}
+}
+
+func TestIncrementalChange(t *testing.T) {
+	doc := newDocument("file:///a.tex", 1, "hello wörld\nsecond line\n")
+	changes := []TextDocumentContentChangeEvent{
+		{Range: &Range{Position{0, 6}, Position{0, 11}}, Text: "there"},
+		{Range: &Range{Position{1, 0}, Position{1, 6}}, Text: "2nd"},
+		{Range: &Range{Position{2, 0}, Position{2, 0}}, Text: "third\n"},
+	}
+	for _, c := range changes {
+		if err := doc.applyChange(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := "hello there\n2nd line\nthird\n"; string(doc.text) != want {
+		t.Errorf("got %q; want %q", doc.text, want)
+	}
+}
+
+func TestSession(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "intro.tex"), []byte("Intro\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mainPath := filepath.Join(dir, "main.tex")
+	uri := pathToURI(mainPath)
+	src := `\section{Über}
+\input{intro}
+\subsection*{Details}
+text
+\section{Next}
+`
+
+	replies := runSession(t,
+		req(1, "initialize", map[string]any{}),
+		notif("initialized", map[string]any{}),
+		notif("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "tex", "version": 1, "text": src},
+		}),
+		req(2, "textDocument/documentSymbol", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+		}),
+		req(3, "textDocument/definition", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     Position{1, 9},
+		}),
+		req(4, "textDocument/hover", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     Position{0, 3},
+		}),
+		req(5, "shutdown", nil),
+		notif("exit", nil),
+	)
+
+	var init InitializeResult
+	result(t, replies, 1, &init)
+	if init.Capabilities.TextDocumentSync.Change != SyncIncremental {
+		t.Errorf("got sync kind %d; want incremental", init.Capabilities.TextDocumentSync.Change)
+	}
+
+	var syms []DocumentSymbol
+	result(t, replies, 2, &syms)
+	if len(syms) != 2 || syms[0].Name != "Über" || syms[1].Name != "Next" {
+		t.Fatalf("got symbols %+v", syms)
+	}
+	if len(syms[0].Children) != 1 || syms[0].Children[0].Name != "Details" {
+		t.Errorf("got children %+v", syms[0].Children)
+	}
+	if want := (Range{Position{0, 0}, Position{4, 0}}); syms[0].Range != want {
+		t.Errorf("got section range %v; want %v", syms[0].Range, want)
+	}
+
+	var loc Location
+	result(t, replies, 3, &loc)
+	if want := pathToURI(filepath.Join(dir, "intro.tex")); loc.URI != want {
+		t.Errorf("got definition %q; want %q", loc.URI, want)
+	}
+
+	var hover Hover
+	result(t, replies, 4, &hover)
+	if !strings.Contains(hover.Contents.Value, `\section*[…]{…}`) {
+		t.Errorf("got hover %q", hover.Contents.Value)
+	}
+}
+
+func TestHoverControlSymbols(t *testing.T) {
+	doc := newDocument("file:///hover.tex", 1, "5\\,kg\\\\*[1ex] caf\\'e \\mine")
+	for _, test := range []struct {
+		offs int
+		want string
+	}{
+		{2, "```latex\n\\,\n```\nThin space."},
+		{6, "```latex\n\\\\*[…]\n```\nEnds the current line"},
+		{17, "```latex\n\\'{…}\n```\nAcute accent"},
+		{21, "```latex\n\\mine\n```\nUser-defined or unknown command."},
+	} {
+		h := analyze(doc).hover(test.offs)
+		if h == nil || !strings.HasPrefix(h.Contents.Value, test.want) {
+			t.Errorf("hover at %d: got %+v; want %q", test.offs, h, test.want)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	doc := newDocument("file:///bad.tex", 1, "ok\n\\input{broken\n")
+	diags := analyze(doc).diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("got %d diagnostics; want 1: %+v", len(diags), diags)
+	}
+	if diags[0].Range.Start.Line != 1 {
+		t.Errorf("got diagnostic at line %d; want 1", diags[0].Range.Start.Line)
+	}
+
+	// Punctuation is text; an illegal character is reported once, where
+	// it is.
+	doc = newDocument("file:///prose.tex", 1, "Is it (really) good?\n\"a\x7f\"\n")
+	diags = analyze(doc).diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("got %d diagnostics; want 1: %+v", len(diags), diags)
+	}
+	if start := diags[0].Range.Start; start.Line != 1 || start.Character != 2 {
+		t.Errorf("got diagnostic at %d:%d; want 1:2", start.Line, start.Character)
+	}
+}
+
+func TestDefinitionTeXRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "chapters"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Paths in a subfile are relative to the main document.
+	if err := os.WriteFile(filepath.Join(dir, "figures.tex"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uri := pathToURI(filepath.Join(dir, "chapters", "intro.tex"))
+	src := "% !TEX root = ../main.tex\n\\input{figures}\n"
+
+	replies := runSession(t,
+		notif("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "tex", "version": 1, "text": src},
+		}),
+		req(1, "textDocument/definition", map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     Position{1, 8},
+		}),
+	)
+
+	var loc Location
+	result(t, replies, 1, &loc)
+	if want := pathToURI(filepath.Join(dir, "figures.tex")); loc.URI != want {
+		t.Errorf("got definition %q; want %q", loc.URI, want)
+	}
+}
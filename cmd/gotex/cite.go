@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/neox5/gotex/cite"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+var citeCmd = &subcommand{
+	name:  "cite",
+	short: "check citations against the bibliography",
+	run:   runCite,
+}
+
+// runCite checks the citations of a document. The exit status is 1 if a
+// problem or an error was found, so that continuous integration can fail
+// on a broken citation; unused entries only count with -unused.
+func runCite(args []string) int {
+	flags := flag.NewFlagSet("cite", flag.ExitOnError)
+	jsonOut := flags.Bool("json", false, "write the report as JSON to standard output")
+	unused := flags.Bool("unused", false, "fail on bibliography entries that are never cited")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gotex cite [-json] [-unused] main.tex\n\n")
+		fmt.Fprintf(os.Stderr, "Cite resolves the citation keys of the document against the files\n")
+		fmt.Fprintf(os.Stderr, "named by \\bibliography and \\addbibresource.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	l := &cite.Loader{Fset: token.NewFileSet()}
+	report, err := l.Load(flags.Arg(0))
+	if report == nil {
+		fmt.Fprintf(os.Stderr, "gotex cite: %v\n", err)
+		return 1
+	}
+	status := 0
+	if err != nil {
+		scanner.PrintErrors(os.Stderr, err)
+		status = 1
+	}
+	if *jsonOut {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "gotex cite: %v\n", err)
+			return 1
+		}
+	}
+	for _, p := range report.Problems {
+		if !*jsonOut {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		if p.Kind != cite.Unused || *unused {
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCite(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.tex": "As shown (in 1984) by \\citet{knuth}, and by \\citep{missing}?\n" +
+			"\\bibliography{refs}\n",
+		"refs.bib": "@book{knuth, title = {TeX}}\n@book{unused, title = {Other}}\n",
+	})
+	name := filepath.Join(dir, "main.tex")
+
+	status, stdout, stderr := run(t, citeCmd, name)
+	if status != 1 || stdout != "" {
+		t.Errorf("got status %d and output %q; want 1 and no output", status, stdout)
+	}
+	lines := strings.Split(strings.TrimSuffix(stderr, "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "main.tex:1:") || !strings.Contains(lines[0], "missing") ||
+		!strings.Contains(lines[1], "refs.bib:2:") || !strings.Contains(lines[1], "unused") {
+		t.Errorf("got output\n%s", stderr)
+	}
+
+	// Unused entries only fail with -unused.
+	dir = writeFiles(t, map[string]string{
+		"main.tex": "By \\citet{knuth}.\n\\bibliography{refs}\n",
+		"refs.bib": "@book{knuth, title = {TeX}}\n@book{unused, title = {Other}}\n",
+	})
+	name = filepath.Join(dir, "main.tex")
+	if status, _, stderr := run(t, citeCmd, name); status != 0 || !strings.Contains(stderr, "unused") {
+		t.Errorf("got status %d and output %q; want 0 and the unused entry", status, stderr)
+	}
+	if status, _, _ := run(t, citeCmd, "-unused", name); status != 1 {
+		t.Errorf("got status %d with -unused; want 1", status)
+	}
+
+	status, stdout, stderr = run(t, citeCmd, "-json", name)
+	var report struct {
+		Citations int
+		Problems  []struct{ Kind, Key string }
+	}
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("%v in output %q", err, stdout)
+	}
+	if status != 0 || stderr != "" || report.Citations != 1 || len(report.Problems) != 1 || report.Problems[0].Key != "unused" {
+		t.Errorf("got status %d, errors %q and report %+v", status, stderr, report)
+	}
+}
+
+func TestCiteErrors(t *testing.T) {
+	if status, _, stderr := run(t, citeCmd, filepath.Join(t.TempDir(), "absent.tex")); status != 1 || !strings.HasPrefix(stderr, "gotex cite: ") {
+		t.Errorf("got status %d and output %q", status, stderr)
+	}
+	if status, _, _ := run(t, citeCmd); status != 2 {
+		t.Errorf("got status %d without arguments; want 2", status)
+	}
+}
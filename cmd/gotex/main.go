@@ -0,0 +1,54 @@
+// Gotex is a tool for managing gotex sources.
+//
+// Usage:
+//
+//	gotex <command> [arguments]
+//
+// The commands are:
+//
+//	cite    check citations against the bibliography
+//	vet     report likely mistakes in documents
+//
+// Use "gotex <command> -h" for more information about a command.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// A subcommand is a command of the gotex tool, like vet.
+type subcommand struct {
+	name  string
+	short string                  // one-line description
+	run   func(args []string) int // returns the exit status
+}
+
+var subcommands = []*subcommand{
+	citeCmd,
+	vetCmd,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gotex <command> [arguments]\n\nThe commands are:\n\n")
+	for _, c := range subcommands {
+		fmt.Fprintf(os.Stderr, "\t%-7s %s\n", c.name, c.short)
+	}
+	fmt.Fprintf(os.Stderr, "\nUse \"gotex <command> -h\" for more information about a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	for _, c := range subcommands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "gotex %s: unknown command\n", name)
+	usage()
+	os.Exit(2)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/neox5/gotex/analysis"
+	"github.com/neox5/gotex/analysis/passes/commands"
+	"github.com/neox5/gotex/analysis/passes/labels"
+	"github.com/neox5/gotex/analysis/passes/typography"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/loader"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+var vetCmd = &subcommand{
+	name:  "vet",
+	short: "report likely mistakes in documents",
+	run:   runVet,
+}
+
+// analyzers are the analyzers run by gotex vet.
+var analyzers = append([]*analysis.Analyzer{
+	commands.Analyzer,
+	labels.Analyzer,
+}, typography.Analyzers...)
+
+// runVet runs the analyzers on the documents named by args. The exit
+// status is 1 if a diagnostic or an error was reported.
+func runVet(args []string) int {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "apply the suggested fixes to the files")
+	list := flags.Bool("list", false, "list the analyzers and exit")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: gotex vet [-fix] [-list] main.tex...\n\n")
+		fmt.Fprintf(os.Stderr, "Vet checks each document and the files it includes. Analyzers are\n")
+		fmt.Fprintf(os.Stderr, "enabled and disabled in the [vet] table of gotex.mod and silenced\n")
+		fmt.Fprintf(os.Stderr, "by %%gotex:ignore comments.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if err := analysis.Validate(analyzers); err != nil {
+		fmt.Fprintf(os.Stderr, "gotex vet: %v\n", err)
+		return 1
+	}
+	if *list {
+		for _, a := range analyzers {
+			summary, _, _ := strings.Cut(a.Doc, "\n")
+			fmt.Printf("%-24s %s\n", a.Name, summary)
+		}
+		return 0
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	status := 0
+	fset := token.NewFileSet()
+	ld := &loader.Loader{Fset: fset, Mode: parser.ParseFull}
+	checked := make(map[string]bool) // files of documents vetted before
+	for _, main := range flags.Args() {
+		if checked[main] {
+			continue
+		}
+		checker, err := newChecker(filepath.Dir(main))
+		if err != nil {
+			scanner.PrintErrors(os.Stderr, err)
+			status = 1
+		}
+		doc, err := ld.Load(main)
+		if doc == nil {
+			fmt.Fprintf(os.Stderr, "gotex vet: %v\n", err)
+			status = 1
+			continue
+		}
+		if err != nil {
+			scanner.PrintErrors(os.Stderr, err)
+			status = 1
+		}
+		for _, vf := range doc.Files {
+			if checked[vf.Name] {
+				continue
+			}
+			checked[vf.Name] = true
+			checker.Imports = checker.Imports[:0]
+			for _, other := range doc.Files {
+				if other != vf {
+					checker.Imports = append(checker.Imports, other.AST)
+				}
+			}
+			diags, err := checker.File(fset, vf.AST, vf.File, vf.Src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "gotex vet: %s: %v\n", vf.Name, err)
+				status = 1
+			}
+			if *fix {
+				src, n := analysis.ApplyFixes(vf.File, vf.Src, diags)
+				if n > 0 {
+					if err := os.WriteFile(vf.Name, src, 0o666); err != nil {
+						fmt.Fprintf(os.Stderr, "gotex vet: %v\n", err)
+						status = 1
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "%s: applied %d fixes\n", vf.Name, n)
+				}
+			}
+			for _, d := range diags {
+				if *fix && len(d.SuggestedFixes) > 0 {
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "%s: %s: %s\n", fset.Position(d.Pos), d.Analyzer.Name, d.Message)
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// newChecker returns a checker configured by the gotex.mod file in dir
+// or the closest directory above it: the [vet] table enables and disables
+// analyzers, and the [commands] table declares the commands of the
+// module.
+func newChecker(dir string) (*analysis.Checker, error) {
+	c := &analysis.Checker{Analyzers: analyzers, Commands: command.Default()}
+	name := findMod(dir)
+	if name == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return c, err
+	}
+	var errs scanner.ErrorList
+	if c.Config, err = analysis.ParseConfig(name, data); err != nil {
+		errs = append(errs, err.(scanner.ErrorList)...)
+	}
+	sigs, err := command.ParseMod(name, data)
+	if err != nil {
+		errs = append(errs, err.(scanner.ErrorList)...)
+	}
+	for _, sig := range sigs {
+		c.Commands.Register(sig)
+	}
+	return c, errs.Err()
+}
+
+// findMod returns the name of the gotex.mod file in dir or the closest
+// directory above it, or "".
+func findMod(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		name := filepath.Join(dir, "gotex.mod")
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	// Prose punctuation is text, not an error.
+	dir := writeFiles(t, map[string]string{
+		"main.tex": "\\section{Intro}\\label{sec:intro}\n" +
+			"Is it (really) good? Yes: see Section~\\ref{sec:intro}; 50% off! #1 & more.\n" +
+			"\\input{chapters/one}\n",
+		"chapters/one.tex": "A chapter [with brackets] and a \"quote\".\n",
+	})
+	status, stdout, stderr := run(t, vetCmd, filepath.Join(dir, "main.tex"))
+	if status != 1 || stdout != "" {
+		t.Errorf("got status %d and output %q; want 1 and no output", status, stdout)
+	}
+	want := []string{
+		"one.tex:1:33: typography/quotes: straight double quote; use `` for an opening quote",
+		"one.tex:1:39: typography/quotes: straight double quote; use '' for a closing quote",
+	}
+	lines := strings.Split(strings.TrimSuffix(stderr, "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got diagnostics\n%s\nwant\n%s", stderr, strings.Join(want, "\n"))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("got diagnostic %q; want %q", line, want[i])
+		}
+	}
+}
+
+func TestVetFix(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.tex": "He said \"so\"... \\qzxw\n",
+	})
+	name := filepath.Join(dir, "main.tex")
+	status, _, stderr := run(t, vetCmd, "-fix", name)
+	if status != 1 {
+		t.Errorf("got status %d; want 1 for the diagnostic without fix", status)
+	}
+	if !strings.Contains(stderr, "main.tex: applied 3 fixes") || !strings.Contains(stderr, "commands: undefined command \\qzxw") {
+		t.Errorf("got output\n%s", stderr)
+	}
+	if strings.Contains(stderr, "typography/") {
+		t.Errorf("fixed diagnostics were reported:\n%s", stderr)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "He said ``so''\\dots{} \\qzxw\n"; got != want {
+		t.Errorf("got fixed file %q; want %q", got, want)
+	}
+
+	// Nothing is left to fix.
+	if status, _, stderr := run(t, vetCmd, "-fix", name); status != 1 || strings.Contains(stderr, "applied") {
+		t.Errorf("second run: got status %d and output\n%s", status, stderr)
+	}
+}
+
+func TestVetErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.tex": "\\input{missing}\n",
+	})
+	status, _, stderr := run(t, vetCmd, filepath.Join(dir, "main.tex"), filepath.Join(dir, "absent.tex"))
+	if status != 1 {
+		t.Errorf("got status %d; want 1", status)
+	}
+	for _, want := range []string{`main.tex:1:1: cannot find file "missing"`, "gotex vet: open "} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("got output\n%s\nwant %q", stderr, want)
+		}
+	}
+	if status, _, _ := run(t, vetCmd); status != 2 {
+		t.Errorf("got status %d without arguments; want 2", status)
+	}
+}
@@ -0,0 +1,364 @@
+// Package command describes the signatures of known commands: the
+// arguments they take, the mode they are used in, and whether their
+// arguments are read verbatim.
+//
+// Argument specifications use the notation of the LaTeX xparse package,
+// one letter per argument, optionally separated by spaces; see
+// [ParseSpec]. The most common types are
+//
+//	s	an optional star, as in \section*
+//	o	an optional argument in brackets: [...]
+//	m	a mandatory argument: a group {...} or a single token
+//
+// A [Registry] maps command names to signatures. [Default] returns one
+// holding the primitives built into the engine and the common LaTeX
+// commands; modules add their own with [ParseMod].
+package command
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Mode tells where a command may be used.
+type Mode uint8
+
+const (
+	TextMode Mode = 1 << iota // in running text
+	MathMode                  // in formulas
+	AnyMode  = TextMode | MathMode
+)
+
+var modeNames = map[Mode]string{
+	TextMode: "text",
+	MathMode: "math",
+	AnyMode:  "any",
+}
+
+func (m Mode) String() string {
+	if s, ok := modeNames[m]; ok {
+		return s
+	}
+	return fmt.Sprintf("Mode(%d)", m)
+}
+
+// LookupMode returns the mode named s: "text", "math" or "any".
+func LookupMode(s string) (Mode, bool) {
+	for m, name := range modeNames {
+		if name == s {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+// Xref tells how a command takes part in cross references. The last
+// mandatory argument of such a command holds a label, or a
+// comma-separated list of labels, citation keys or file names.
+type Xref uint8
+
+const (
+	NoXref Xref = iota
+	Label       // defines a label, like \label
+	Ref         // refers to labels, like \ref
+	Cite        // cites bibliography entries, like \cite
+	Bib         // names bibliography files, like \bibliography
+)
+
+var xrefNames = map[Xref]string{
+	NoXref: "",
+	Label:  "label",
+	Ref:    "ref",
+	Cite:   "cite",
+	Bib:    "bib",
+}
+
+func (x Xref) String() string {
+	if s, ok := xrefNames[x]; ok {
+		return s
+	}
+	return fmt.Sprintf("Xref(%d)", x)
+}
+
+// LookupXref returns the cross reference kind named s: "label", "ref",
+// "cite" or "bib".
+func LookupXref(s string) (Xref, bool) {
+	for x, name := range xrefNames {
+		if name == s && x != NoXref {
+			return x, true
+		}
+	}
+	return NoXref, false
+}
+
+// A Signature describes the arguments of a command.
+type Signature struct {
+	Name     string // command name without backslash
+	Args     string // argument specification, like "s o m"
+	Mode     Mode
+	Verbatim bool // mandatory arguments are read verbatim, as for \url
+	Xref     Xref // role in cross references, like Cite for \cite
+
+	// Content is the mode in which the mandatory arguments of the
+	// command, or the body of the environment it begins, are typeset as
+	// running text: TextMode for \emph and \text, MathMode for the
+	// equation environment. It is 0 for arguments that are not running
+	// text, like the key of \ref, and for environments typeset like the
+	// surrounding text.
+	Content Mode
+
+	spec   Spec // parsed Args, set by Registry.Register
+	parsed bool
+}
+
+// Validate reports whether the argument specification of sig is valid.
+func (sig *Signature) Validate() error {
+	if _, err := ParseSpec(sig.Args); err != nil {
+		return fmt.Errorf("\\%s: %v", sig.Name, err)
+	}
+	return nil
+}
+
+// Spec returns the parsed argument specification of sig. If it is not
+// valid, Spec returns the arguments preceding the error.
+func (sig *Signature) Spec() Spec {
+	if sig.parsed {
+		return sig.spec
+	}
+	spec, _ := ParseSpec(sig.Args)
+	return spec
+}
+
+// A Registry maps command names to signatures. The zero value is an
+// empty registry ready to use.
+type Registry struct {
+	sigs map[string]*Signature
+}
+
+// NewRegistry returns a registry holding the given signatures.
+func NewRegistry(sigs ...*Signature) *Registry {
+	r := new(Registry)
+	for _, sig := range sigs {
+		r.Register(sig)
+	}
+	return r
+}
+
+// Default returns a new registry holding the [Builtins].
+func Default() *Registry {
+	return NewRegistry(Builtins...)
+}
+
+// Register adds a copy of sig to the registry, replacing an earlier
+// signature of the same command.
+func (r *Registry) Register(sig *Signature) {
+	if r.sigs == nil {
+		r.sigs = make(map[string]*Signature)
+	}
+	c := *sig
+	c.spec, _ = ParseSpec(c.Args)
+	c.parsed = true
+	r.sigs[sig.Name] = &c
+}
+
+// Clone returns a copy of r that can be changed without affecting r.
+func (r *Registry) Clone() *Registry {
+	c := &Registry{sigs: make(map[string]*Signature, len(r.sigs))}
+	for name, sig := range r.sigs {
+		c.sigs[name] = sig
+	}
+	return c
+}
+
+// Lookup returns the signature of the command name, or nil.
+func (r *Registry) Lookup(name string) *Signature {
+	if r == nil {
+		return nil
+	}
+	return r.sigs[name]
+}
+
+// Names returns the names of the registered commands in sorted order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.sigs))
+	for name := range r.sigs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Builtins lists the signatures of the engine primitives and of common
+// LaTeX commands, including the symbols and declarations without
+// arguments.
+var Builtins = []*Signature{
+	// Engine primitives
+	{Name: "matrix", Args: "o m", Mode: AnyMode},
+	{Name: "grid", Args: "o m", Mode: TextMode},
+
+	// Document structure
+	{Name: "documentclass", Args: "o m", Mode: TextMode},
+	{Name: "usepackage", Args: "o m", Mode: TextMode},
+	{Name: "input", Args: "m", Mode: AnyMode},
+	{Name: "include", Args: "m", Mode: TextMode},
+	{Name: "usemodule", Args: "m", Mode: TextMode},
+	{Name: "import", Args: "m", Mode: TextMode},
+	{Name: "begin", Args: "m", Mode: AnyMode},
+	{Name: "end", Args: "m", Mode: AnyMode},
+	{Name: "title", Args: "o m", Mode: TextMode, Content: TextMode},
+	{Name: "author", Args: "o m", Mode: TextMode},
+	{Name: "date", Args: "m", Mode: TextMode},
+	{Name: "maketitle", Mode: TextMode},
+	{Name: "tableofcontents", Mode: TextMode},
+	{Name: "part", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "chapter", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "section", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "subsection", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "subsubsection", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "paragraph", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "subparagraph", Args: "s o m", Mode: TextMode, Content: TextMode},
+	{Name: "appendix", Mode: TextMode},
+
+	// Cross references and citations
+	{Name: "label", Args: "m", Mode: AnyMode, Xref: Label},
+	{Name: "ref", Args: "m", Mode: AnyMode, Xref: Ref},
+	{Name: "eqref", Args: "m", Mode: AnyMode, Xref: Ref},
+	{Name: "pageref", Args: "m", Mode: AnyMode, Xref: Ref},
+	{Name: "cite", Args: "o o m", Mode: TextMode, Xref: Cite},
+	{Name: "nocite", Args: "m", Mode: TextMode, Xref: Cite},
+	{Name: "bibliography", Args: "m", Mode: TextMode, Xref: Bib},
+	{Name: "bibliographystyle", Args: "m", Mode: TextMode},
+	{Name: "addbibresource", Args: "o m", Mode: TextMode, Xref: Bib},
+	{Name: "url", Args: "m", Mode: TextMode, Verbatim: true},
+	{Name: "href", Args: "m m", Mode: TextMode},
+	{Name: "autoref", Args: "s m", Mode: AnyMode, Xref: Ref}, // hyperref
+	{Name: "nameref", Args: "s m", Mode: AnyMode, Xref: Ref},
+	{Name: "vref", Args: "s m", Mode: AnyMode, Xref: Ref}, // varioref
+	{Name: "cref", Args: "s m", Mode: AnyMode, Xref: Ref}, // cleveref
+	{Name: "Cref", Args: "s m", Mode: AnyMode, Xref: Ref},
+	{Name: "cpageref", Args: "s m", Mode: AnyMode, Xref: Ref},
+	{Name: "Cpageref", Args: "s m", Mode: AnyMode, Xref: Ref},
+	{Name: "citep", Args: "s o o m", Mode: TextMode, Xref: Cite}, // natbib
+	{Name: "citet", Args: "s o o m", Mode: TextMode, Xref: Cite},
+	{Name: "citealp", Args: "s o o m", Mode: TextMode, Xref: Cite},
+	{Name: "citealt", Args: "s o o m", Mode: TextMode, Xref: Cite},
+	{Name: "citeauthor", Args: "s m", Mode: TextMode, Xref: Cite},
+	{Name: "citeyear", Args: "m", Mode: TextMode, Xref: Cite},
+	{Name: "parencite", Args: "s o o m", Mode: TextMode, Xref: Cite}, // biblatex
+	{Name: "Parencite", Args: "s o o m", Mode: TextMode, Xref: Cite},
+	{Name: "textcite", Args: "o o m", Mode: TextMode, Xref: Cite},
+	{Name: "Textcite", Args: "o o m", Mode: TextMode, Xref: Cite},
+	{Name: "autocite", Args: "s o o m", Mode: TextMode, Xref: Cite},
+	{Name: "Autocite", Args: "s o o m", Mode: TextMode, Xref: Cite},
+	{Name: "footcite", Args: "o o m", Mode: TextMode, Xref: Cite},
+	{Name: "fullcite", Args: "o o m", Mode: TextMode, Xref: Cite},
+
+	// Control symbols
+	{Name: "\\", Args: "s o", Mode: AnyMode},
+	{Name: ",", Mode: AnyMode},
+	{Name: ":", Mode: MathMode},
+	{Name: ";", Mode: AnyMode},
+	{Name: "!", Mode: AnyMode},
+	{Name: " ", Mode: AnyMode},
+	{Name: "-", Mode: TextMode},
+	{Name: "/", Mode: TextMode},
+	{Name: "@", Mode: TextMode},
+	{Name: "'", Args: "m", Mode: TextMode},
+	{Name: "`", Args: "m", Mode: TextMode},
+	{Name: "\"", Args: "m", Mode: TextMode},
+	{Name: "^", Args: "m", Mode: TextMode},
+	{Name: "~", Args: "m", Mode: TextMode},
+	{Name: "=", Args: "m", Mode: TextMode},
+	{Name: ".", Args: "m", Mode: TextMode},
+
+	// Accents
+	{Name: "u", Args: "m", Mode: TextMode},
+	{Name: "v", Args: "m", Mode: TextMode},
+	{Name: "H", Args: "m", Mode: TextMode},
+	{Name: "r", Args: "m", Mode: TextMode},
+	{Name: "c", Args: "m", Mode: TextMode},
+	{Name: "k", Args: "m", Mode: TextMode},
+	{Name: "d", Args: "m", Mode: TextMode},
+	{Name: "b", Args: "m", Mode: TextMode},
+	{Name: "t", Args: "m", Mode: TextMode},
+
+	// Text
+	{Name: "emph", Args: "m", Mode: TextMode, Content: TextMode},
+	{Name: "textbf", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textit", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "texttt", Args: "m", Mode: AnyMode},
+	{Name: "textsc", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textrm", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textsf", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textsl", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textmd", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "underline", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "footnote", Args: "o m", Mode: TextMode, Content: TextMode},
+	{Name: "footnotetext", Args: "o m", Mode: TextMode, Content: TextMode},
+	{Name: "thanks", Args: "m", Mode: TextMode, Content: TextMode},
+	{Name: "caption", Args: "o m", Mode: TextMode, Content: TextMode},
+	{Name: "item", Args: "o", Mode: TextMode},
+	{Name: "includegraphics", Args: "s o m", Mode: TextMode},
+	{Name: "hspace", Args: "s m", Mode: AnyMode},
+	{Name: "vspace", Args: "s m", Mode: TextMode},
+	{Name: "noindent", Mode: TextMode},
+	{Name: "centering", Mode: TextMode},
+	{Name: "newpage", Mode: TextMode},
+	{Name: "clearpage", Mode: TextMode},
+
+	// Math
+	{Name: "frac", Args: "m m", Mode: MathMode},
+	{Name: "sqrt", Args: "o m", Mode: MathMode},
+	{Name: "text", Args: "m", Mode: MathMode, Content: TextMode},
+	{Name: "intertext", Args: "m", Mode: MathMode, Content: TextMode},
+	{Name: "mathbb", Args: "m", Mode: MathMode},
+	{Name: "mathrm", Args: "m", Mode: MathMode},
+	{Name: "mathcal", Args: "m", Mode: MathMode},
+	{Name: "mathbf", Args: "m", Mode: MathMode},
+	{Name: "mathit", Args: "m", Mode: MathMode},
+	{Name: "mathsf", Args: "m", Mode: MathMode},
+	{Name: "mathtt", Args: "m", Mode: MathMode},
+	{Name: "boldsymbol", Args: "m", Mode: MathMode},
+	{Name: "operatorname", Args: "s m", Mode: MathMode},
+	{Name: "DeclareMathOperator", Args: "s m m", Mode: AnyMode},
+	{Name: "hat", Args: "m", Mode: MathMode},
+	{Name: "bar", Args: "m", Mode: MathMode},
+	{Name: "vec", Args: "m", Mode: MathMode},
+	{Name: "tilde", Args: "m", Mode: MathMode},
+	{Name: "dot", Args: "m", Mode: MathMode},
+	{Name: "ddot", Args: "m", Mode: MathMode},
+	{Name: "overline", Args: "m", Mode: MathMode},
+	{Name: "widehat", Args: "m", Mode: MathMode},
+	{Name: "widetilde", Args: "m", Mode: MathMode},
+
+	// Registers, counters and environments
+	{Name: "setlength", Args: "m m", Mode: AnyMode},
+	{Name: "addtolength", Args: "m m", Mode: AnyMode},
+	{Name: "newcounter", Args: "m o", Mode: AnyMode},
+	{Name: "setcounter", Args: "m m", Mode: AnyMode},
+	{Name: "addtocounter", Args: "m m", Mode: AnyMode},
+	{Name: "stepcounter", Args: "m", Mode: AnyMode},
+	{Name: "value", Args: "m", Mode: AnyMode},
+	{Name: "newenvironment", Args: "s m o o m m", Mode: AnyMode},
+	{Name: "renewenvironment", Args: "s m o o m m", Mode: AnyMode},
+	{Name: "newtheorem", Args: "s m o m o", Mode: AnyMode},
+
+	// Tests of xparse on argument values
+	{Name: "IfBooleanTF", Args: "m m m", Mode: AnyMode},
+	{Name: "IfBooleanT", Args: "m m", Mode: AnyMode},
+	{Name: "IfBooleanF", Args: "m m", Mode: AnyMode},
+	{Name: "IfNoValueTF", Args: "m m m", Mode: AnyMode},
+	{Name: "IfNoValueT", Args: "m m", Mode: AnyMode},
+	{Name: "IfNoValueF", Args: "m m", Mode: AnyMode},
+	{Name: "IfValueTF", Args: "m m m", Mode: AnyMode},
+	{Name: "IfValueT", Args: "m m", Mode: AnyMode},
+	{Name: "IfValueF", Args: "m m", Mode: AnyMode},
+
+	// Others
+	{Name: "mbox", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "fbox", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textup", Args: "m", Mode: AnyMode, Content: TextMode},
+	{Name: "textnormal", Args: "m", Mode: AnyMode},
+	{Name: "textcolor", Args: "o m m", Mode: AnyMode},
+	{Name: "color", Args: "o m", Mode: AnyMode},
+}
@@ -0,0 +1,193 @@
+package command
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/neox5/gotex/scanner"
+)
+
+func TestBuiltins(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, sig := range Builtins {
+		if err := sig.Validate(); err != nil {
+			t.Error(err)
+		}
+		if seen[sig.Name] {
+			t.Errorf("duplicate signature for \\%s", sig.Name)
+		}
+		seen[sig.Name] = true
+	}
+
+	r := Default()
+	if sig := r.Lookup("section"); sig == nil || sig.Args != "s o m" {
+		t.Errorf("got section signature %+v", sig)
+	}
+	if sig := r.Lookup("url"); sig == nil || !sig.Verbatim {
+		t.Errorf("got url signature %+v", sig)
+	}
+	if r.Lookup("unknown") != nil {
+		t.Error("found signature for unknown command")
+	}
+	var nilReg *Registry
+	if nilReg.Lookup("section") != nil {
+		t.Error("nil registry found a signature")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var r Registry
+	r.Register(&Signature{Name: "b", Args: "m"})
+	r.Register(&Signature{Name: "a"})
+	r.Register(&Signature{Name: "b", Args: "o m"})
+	if got := r.Names(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("got names %q", got)
+	}
+	if got := r.Lookup("b").Spec().String(); got != "o m" {
+		t.Errorf("got args %q; want later signature", got)
+	}
+}
+
+func TestClone(t *testing.T) {
+	r := NewRegistry(&Signature{Name: "a", Args: "m"})
+	c := r.Clone()
+	c.Register(&Signature{Name: "a", Args: "o m"})
+	c.Register(&Signature{Name: "b"})
+	if got := r.Names(); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("got names %q after changing the clone", got)
+	}
+	if got := r.Lookup("a").Args; got != "m" {
+		t.Errorf("got args %q after changing the clone", got)
+	}
+	if got := c.Lookup("a").Args; got != "o m" {
+		t.Errorf("got clone args %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, args := range []string{"", "m", "s o m", " o  o m ", "som", "+m !O{a}"} {
+		if err := (&Signature{Name: "x", Args: args}).Validate(); err != nil {
+			t.Errorf("%q: %v", args, err)
+		}
+	}
+	for _, args := range []string{"x", "O", "D<", "e{^_}", "+"} {
+		if err := (&Signature{Name: "x", Args: args}).Validate(); err == nil {
+			t.Errorf("%q: no error", args)
+		}
+	}
+}
+
+func TestParseMod(t *testing.T) {
+	src := `module = "example.org/notes" # other tables are ignored
+
+[commands]
+highlight = "o m"
+"\\norm" = { args = "m", mode = "math" }  # quoted key
+code = { args = "m", verbatim = true }
+hash = { args = "m", mode = "any" } # "#" in comment
+citebook = { args = "o m", xref = "cite" }
+
+[other]
+ignored = "x y z"
+`
+	sigs, err := ParseMod("gotex.mod", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Signature{
+		{Name: "highlight", Args: "o m", Mode: TextMode},
+		{Name: "norm", Args: "m", Mode: MathMode},
+		{Name: "code", Args: "m", Mode: TextMode, Verbatim: true},
+		{Name: "hash", Args: "m", Mode: AnyMode},
+		{Name: "citebook", Args: "o m", Mode: TextMode, Xref: Cite},
+	}
+	if len(sigs) != len(want) {
+		t.Fatalf("got %d signatures; want %d", len(sigs), len(want))
+	}
+	for i, w := range want {
+		if got := sigs[i]; got.Name != w.Name || got.Args != w.Args || got.Mode != w.Mode || got.Verbatim != w.Verbatim || got.Xref != w.Xref {
+			t.Errorf("got %+v; want %+v", *got, w)
+		}
+	}
+}
+
+func TestParseModErrors(t *testing.T) {
+	src := `[commands]
+a = "o x"
+b = { args = "m", mode = "display" }
+c = { args = "m"
+d
+e = { size = 1 }
+f = { args = "m", xref = "link" }
+`
+	_, err := ParseMod("gotex.mod", []byte(src))
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("got error %v", err)
+	}
+	want := []string{
+		`\a: unsupported argument type "x"`,
+		`\b: unknown mode "display"`,
+		`\c: expected '}' to close inline table`,
+		`expected name = value`,
+		`\e: unknown key "size"`,
+		`\f: unknown cross reference kind "link"`,
+	}
+	if len(list) != len(want) {
+		t.Fatalf("got %d errors; want %d: %v", len(list), len(want), list)
+	}
+	for i, msg := range want {
+		if list[i].Msg != msg || list[i].Pos.Line != i+2 {
+			t.Errorf("got %s; want %d: %s", list[i], i+2, msg)
+		}
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	cases := []struct {
+		spec string
+		want Spec
+	}{
+		{"", nil},
+		{"s o m", Spec{{Type: 's'}, {Type: 'o', Open: "[", Close: "]"}, {Type: 'm'}}},
+		{"somO{x}", Spec{{Type: 's'}, {Type: 'o', Open: "[", Close: "]"}, {Type: 'm'}, {Type: 'O', Open: "[", Close: "]", Default: "x"}}},
+		{"O{a {b} c}", Spec{{Type: 'O', Open: "[", Close: "]", Default: "a {b} c"}}},
+		{"D<>{x} d||", Spec{{Type: 'D', Open: "<", Close: ">", Default: "x"}, {Type: 'd', Open: "|", Close: "|"}}},
+		{"r<> R{[}{]}{0}", Spec{{Type: 'r', Open: "<", Close: ">"}, {Type: 'R', Open: "[", Close: "]", Default: "0"}}},
+		{`t+ t\foo v`, Spec{{Type: 't', Open: "+"}, {Type: 't', Open: `\foo`}, {Type: 'v'}}},
+		{`+m !o >{\SplitList{;}}m`, Spec{{Type: 'm', Long: true}, {Type: 'o', Open: "[", Close: "]"}, {Type: 'm'}}},
+	}
+	for _, c := range cases {
+		got, err := ParseSpec(c.spec)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%q: got %+v; want %+v", c.spec, got, c.want)
+		}
+	}
+
+	spec := Spec{{Type: 'D', Open: "<", Close: ">", Default: "x"}, {Type: 'm', Long: true}}
+	if got := spec.String(); got != "D<>{x} +m" {
+		t.Errorf("got %q", got)
+	}
+
+	errs := []struct{ spec, msg string }{
+		{"m e{^_}", `unsupported argument type "e"`},
+		{"O", "expected {default} after O in argument specification"},
+		{"O{x", "expected {default} after O in argument specification"},
+		{"d<", "expected delimiters after d in argument specification"},
+		{"t", "expected token after t in argument specification"},
+		{"m +", "missing argument type after prefix"},
+	}
+	for _, c := range errs {
+		spec, err := ParseSpec(c.spec)
+		if err == nil || err.Error() != c.msg {
+			t.Errorf("%q: got error %v; want %q", c.spec, err, c.msg)
+		}
+		if c.spec[0] == 'm' && len(spec) != 1 {
+			t.Errorf("%q: got %v; want arguments before the error", c.spec, spec)
+		}
+	}
+}
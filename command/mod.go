@@ -0,0 +1,186 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// ParseMod returns the signatures declared in the [commands] table of a
+// gotex.mod file. Each entry maps a command name to its argument
+// specification, or to an inline table with the keys args, mode ("text",
+// "math" or "any"), verbatim and xref ("label", "ref", "cite" or "bib"):
+//
+//	[commands]
+//	highlight = "o m"
+//	norm = { args = "m", mode = "math" }
+//	code = { args = "m", verbatim = true }
+//	citebook = { args = "o m", xref = "cite" }
+//
+// Commands are used in text mode unless stated otherwise. Other tables
+// are ignored. Errors are returned as a [scanner.ErrorList].
+func ParseMod(filename string, data []byte) ([]*Signature, error) {
+	var sigs []*Signature
+	err := ReadMod(filename, data, "commands", func(name, value string) error {
+		sig, err := parseEntry(name, value)
+		if err == nil {
+			err = sig.Validate()
+		}
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, sig)
+		return nil
+	})
+	return sigs, err
+}
+
+// ReadMod calls f for each entry name = value of the table named table
+// in a gotex.mod file, with the name unquoted and both trimmed of white
+// space and # comments. An error returned by f is reported at the line
+// of the entry, as are lines that are not entries. Errors are returned
+// as a [scanner.ErrorList].
+func ReadMod(filename string, data []byte, table string, f func(name, value string) error) error {
+	var (
+		errs   scanner.ErrorList
+		inside bool // in the table
+	)
+	for i, line := range strings.Split(string(data), "\n") {
+		pos := token.Position{Filename: filename, Line: i + 1, Column: 1}
+		line = strings.TrimSpace(stripComment(line))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "["):
+			inside = line == "["+table+"]"
+			continue
+		case !inside:
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			errs.Add(pos, "expected name = value")
+			continue
+		}
+		if err := f(unquote(strings.TrimSpace(name)), strings.TrimSpace(value)); err != nil {
+			errs.Add(pos, err.Error())
+		}
+	}
+	return errs.Err()
+}
+
+// parseEntry parses the entry name = value of a command.
+func parseEntry(name, value string) (*Signature, error) {
+	sig := &Signature{Name: strings.TrimPrefix(name, "\\"), Mode: TextMode}
+	if sig.Name == "" {
+		return nil, fmt.Errorf("missing command name")
+	}
+
+	if !strings.HasPrefix(value, "{") {
+		args, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("\\%s: expected quoted argument specification", sig.Name)
+		}
+		sig.Args = args
+		return sig, nil
+	}
+
+	if !strings.HasSuffix(value, "}") {
+		return nil, fmt.Errorf("\\%s: expected '}' to close inline table", sig.Name)
+	}
+	for _, field := range splitFields(value[1 : len(value)-1]) {
+		key, val, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("\\%s: expected key = value", sig.Name)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		var err error
+		switch key {
+		case "args":
+			sig.Args, err = strconv.Unquote(val)
+		case "mode":
+			var s string
+			if s, err = strconv.Unquote(val); err == nil {
+				var ok bool
+				if sig.Mode, ok = LookupMode(s); !ok {
+					return nil, fmt.Errorf("\\%s: unknown mode %q", sig.Name, s)
+				}
+			}
+		case "verbatim":
+			sig.Verbatim, err = strconv.ParseBool(val)
+		case "xref":
+			var s string
+			if s, err = strconv.Unquote(val); err == nil {
+				var ok bool
+				if sig.Xref, ok = LookupXref(s); !ok {
+					return nil, fmt.Errorf("\\%s: unknown cross reference kind %q", sig.Name, s)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("\\%s: unknown key %q", sig.Name, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("\\%s: invalid value for %s: %s", sig.Name, key, val)
+		}
+	}
+	return sig, nil
+}
+
+// splitFields splits the body of an inline table at commas outside of
+// quoted strings.
+func splitFields(s string) []string {
+	var fields []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		fields = append(fields, s[start:])
+	}
+	return fields
+}
+
+// stripComment removes a # comment outside of quoted strings.
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case '#':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// unquote removes the quotes of a quoted key.
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,218 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Param describes one argument of an xparse argument specification.
+type Param struct {
+	Type    byte   // argument type: one of "mrRvoOdDst"
+	Open    string // opening delimiter of r, R, d and D, "[" for o and O, the token of t
+	Close   string // closing delimiter of r, R, d and D, "]" for o and O
+	Default string // default value of O, D and R
+	Long    bool   // + prefix: the argument may contain \par
+}
+
+// Optional reports whether the argument may be omitted without error.
+func (p Param) Optional() bool {
+	return strings.IndexByte("oOdDst", p.Type) >= 0
+}
+
+// HasDefault reports whether an omitted argument takes p.Default.
+func (p Param) HasDefault() bool {
+	return p.Type == 'O' || p.Type == 'D' || p.Type == 'R'
+}
+
+// String returns p in the notation of xparse, like "D<>{x}".
+func (p Param) String() string {
+	var b strings.Builder
+	if p.Long {
+		b.WriteByte('+')
+	}
+	b.WriteByte(p.Type)
+	switch p.Type {
+	case 't':
+		b.WriteString(p.Open)
+	case 'r', 'R', 'd', 'D':
+		b.WriteString(p.Open)
+		b.WriteString(p.Close)
+	}
+	if p.HasDefault() {
+		b.WriteString("{" + p.Default + "}")
+	}
+	return b.String()
+}
+
+// A Spec is a parsed argument specification.
+type Spec []Param
+
+// String returns s in the notation of xparse, with the arguments
+// separated by spaces.
+func (s Spec) String() string {
+	parts := make([]string, len(s))
+	for i, p := range s {
+		parts[i] = p.String()
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseSpec parses an argument specification in the notation of xparse,
+// as used by \NewDocumentCommand:
+//
+//	m	a mandatory argument: a group {...} or a single token
+//	r<>	a mandatory argument delimited by < and >
+//	R<>{x}	like r, with a default used if the argument is missing
+//	v	a mandatory argument read verbatim, between braces or two equal characters
+//	o	an optional argument [...]
+//	O{x}	like o, with the default x
+//	d<>	an optional argument delimited by < and >
+//	D<>{x}	like d, with the default x
+//	s	an optional star
+//	t+	an optional token, here +
+//
+// Arguments may be separated by spaces. The prefix + marks a long
+// argument; the prefix ! and argument processors >{...} are accepted and
+// ignored. Other argument types are not supported. The parsed arguments
+// are returned even if there is an error.
+func ParseSpec(s string) (Spec, error) {
+	var spec Spec
+	r := &specReader{s: s}
+	for {
+		r.skipSpace()
+		if r.eof() {
+			return spec, nil
+		}
+		var p Param
+	prefix:
+		for {
+			switch r.peek() {
+			case '+':
+				p.Long = true
+			case '!':
+				// trailing optional arguments may not follow a space
+			case '>':
+				r.next()
+				r.skipSpace()
+				if _, ok := r.group(); !ok {
+					return spec, fmt.Errorf("expected {...} after > in argument specification")
+				}
+				r.skipSpace()
+				continue
+			default:
+				break prefix
+			}
+			r.next()
+		}
+
+		c := r.next()
+		p.Type = byte(c)
+		switch c {
+		case 'm', 'v', 's':
+		case 'o', 'O':
+			p.Open, p.Close = "[", "]"
+		case 't':
+			if p.Open = r.token(); p.Open == "" {
+				return spec, fmt.Errorf("expected token after t in argument specification")
+			}
+		case 'r', 'R', 'd', 'D':
+			p.Open, p.Close = r.token(), r.token()
+			if p.Close == "" {
+				return spec, fmt.Errorf("expected delimiters after %c in argument specification", c)
+			}
+		case -1:
+			return spec, fmt.Errorf("missing argument type after prefix")
+		default:
+			return spec, fmt.Errorf("unsupported argument type %q", string(c))
+		}
+		if p.HasDefault() {
+			r.skipSpace()
+			var ok bool
+			if p.Default, ok = r.group(); !ok {
+				return spec, fmt.Errorf("expected {default} after %c in argument specification", c)
+			}
+		}
+		spec = append(spec, p)
+	}
+}
+
+// specReader reads the characters of an argument specification.
+type specReader struct {
+	s    string
+	offs int
+}
+
+func (r *specReader) eof() bool { return r.offs >= len(r.s) }
+
+func (r *specReader) peek() rune {
+	if r.eof() {
+		return -1
+	}
+	c, _ := utf8.DecodeRuneInString(r.s[r.offs:])
+	return c
+}
+
+func (r *specReader) next() rune {
+	if r.eof() {
+		return -1
+	}
+	c, n := utf8.DecodeRuneInString(r.s[r.offs:])
+	r.offs += n
+	return c
+}
+
+func (r *specReader) skipSpace() {
+	for unicode.IsSpace(r.peek()) {
+		r.next()
+	}
+}
+
+// token reads a delimiter: a character, a command like \foo, or a single
+// character in braces.
+func (r *specReader) token() string {
+	switch c := r.peek(); {
+	case c == -1 || unicode.IsSpace(c):
+		return ""
+	case c == '\\':
+		start := r.offs
+		r.next()
+		for unicode.IsLetter(r.peek()) {
+			r.next()
+		}
+		if r.offs == start+1 {
+			r.next() // control symbol
+		}
+		return r.s[start:r.offs]
+	case c == '{':
+		start := r.offs
+		if g, ok := r.group(); ok && utf8.RuneCountInString(g) == 1 {
+			return g
+		}
+		r.offs = start
+		return ""
+	}
+	return string(r.next())
+}
+
+// group reads a brace group and returns its content.
+func (r *specReader) group() (string, bool) {
+	if r.peek() != '{' {
+		return "", false
+	}
+	start := r.offs + 1
+	depth := 0
+	for !r.eof() {
+		switch r.next() {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return r.s[start : r.offs-1], true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,67 @@
+package command
+
+import "strings"
+
+// Commands without arguments that are known to the engine, by mode. They
+// are added to Builtins.
+var symbols = []struct {
+	mode  Mode
+	names string
+}{
+	{TextMode, `
+		par indent newline linebreak pagebreak nopagebreak
+		hfill vfill hfil vfil smallskip medskip bigskip
+		raggedright raggedleft
+		tiny scriptsize footnotesize small normalsize large Large LARGE huge Huge
+		bfseries mdseries itshape upshape slshape scshape rmfamily sffamily ttfamily normalfont em
+		hline toprule midrule bottomrule tabularnewline
+		LaTeX TeX today textbackslash ldots verb
+		ss SS ae AE oe OE o O aa AA l L i j dh DH th TH ng NG S P
+	`},
+	{MathMode, `
+		alpha beta gamma delta epsilon varepsilon zeta eta theta vartheta iota kappa
+		lambda mu nu xi pi varpi rho varrho sigma varsigma tau upsilon phi varphi chi
+		psi omega Gamma Delta Theta Lambda Xi Pi Sigma Upsilon Phi Psi Omega
+		infty partial nabla sum prod coprod int iint oint lim limsup liminf sup inf max min
+		log ln exp sin cos tan arcsin arccos arctan sinh cosh tanh det dim ker deg gcd Pr
+		cdot cdots vdots ddots times div pm mp ast star circ bullet oplus otimes
+		leq geq neq le ge ne ll gg approx equiv sim simeq cong propto
+		subset subseteq supset supseteq in notin ni cup cap setminus emptyset varnothing
+		forall exists nexists neg lnot land lor wedge vee
+		to gets rightarrow leftarrow Rightarrow Leftarrow leftrightarrow Leftrightarrow
+		mapsto implies iff uparrow downarrow
+		left right middle big Big bigg Bigg
+		langle rangle lvert rvert lVert rVert vert Vert lfloor rfloor lceil rceil mid
+		prime ell hbar Re Im aleph dagger perp parallel angle triangle
+		displaystyle textstyle scriptstyle
+	`},
+	{AnyMode, `
+		relax protect quad qquad dots
+		makeatletter makeatother
+		newcommand renewcommand providecommand DeclareRobustCommand def gdef edef xdef
+		NewDocumentCommand RenewDocumentCommand ProvideDocumentCommand DeclareDocumentCommand
+		let futurelet newif newlength newsavebox newcount newdimen newskip newtoks newbox
+		chardef mathchardef countdef dimendef skipdef toksdef
+		BooleanTrue BooleanFalse
+		parindent parskip textwidth linewidth columnwidth textheight baselineskip
+	`},
+}
+
+// mathEnvironments are the environments whose body is typeset in math
+// mode, by the name of the command \begin{name} executes. They are added
+// to Builtins.
+const mathEnvironments = `
+	math displaymath equation equation* eqnarray eqnarray*
+	align align* gather gather* multline multline* flalign flalign* alignat alignat*
+`
+
+func init() {
+	for _, s := range symbols {
+		for _, name := range strings.Fields(s.names) {
+			Builtins = append(Builtins, &Signature{Name: name, Mode: s.mode})
+		}
+	}
+	for _, name := range strings.Fields(mathEnvironments) {
+		Builtins = append(Builtins, &Signature{Name: name, Mode: TextMode, Content: MathMode})
+	}
+}
@@ -0,0 +1,369 @@
+// Package expand expands user-defined macros in gotex sources.
+//
+// An [Expander] replaces each use of a macro defined with \newcommand,
+// \def and their variants (see [ast.MacroDef]) by its body, substituting
+// the arguments for the parameters #1 ... #9, until only primitives and
+// unknown commands remain. Macros are expanded in the order TeX would
+// expand them: a definition takes effect where it appears in the source,
+// and the result of an expansion is expanded again.
+//
+// Macros defined with \NewDocumentCommand and its variants take their
+// arguments as described by their xparse argument specification. As in
+// xparse, a star is passed as \BooleanTrue or \BooleanFalse and an omitted
+// optional argument without default as -NoValue-; the tests \IfBooleanTF,
+// \IfNoValueTF, \IfValueTF and their T and F forms are evaluated when
+// their outcome is known.
+//
+// Every token of the result records where it was written, in the source or
+// in the body of a definition, and the chain of expansions that produced
+// it; see [Token] and [Expansion].
+//
+// Unlike TeX, the expander works on the tokens of the gotex scanner, in
+// which a run of letters is a single word. Delimiters in the parameter text
+// of \def therefore only match whole words.
+package expand
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// A Token is a token of the expanded stream.
+type Token struct {
+	Pos   token.Pos // where the token was written: in the source or in a definition
+	Tok   token.Token
+	Lit   string
+	Space bool       // preceded by white space
+	Exp   *Expansion // expansion that produced the token, or nil for source tokens
+}
+
+// String returns the source form of t, like "\section" for a command.
+func (t Token) String() string {
+	switch t.Tok {
+	case token.COMMAND, token.CONTROL_SYMBOL, token.IMPORT, token.ENV, token.ENVEND:
+		return "\\" + t.Lit
+	case token.WORD:
+		// The scanner drops the backslash of the special characters of a
+		// word, like \% in 50\%; they do not appear in words otherwise.
+		return escaper.Replace(t.Lit)
+	}
+	return t.Lit
+}
+
+var escaper = strings.NewReplacer("$", `\$`, "%", `\%`, "&", `\&`, "#", `\#`, "_", `\_`, "{", `\{`, "}", `\}`)
+
+// An Expansion is a single use of a macro.
+type Expansion struct {
+	Macro  *ast.MacroDef
+	Call   token.Pos  // position of the macro name at the call site
+	Parent *Expansion // expansion that produced the call, or nil for calls in the source
+	depth  int
+}
+
+// Depth returns the number of expansions x is nested in, plus 1.
+func (x *Expansion) Depth() int {
+	if x == nil {
+		return 0
+	}
+	return x.depth
+}
+
+// Root returns the outermost expansion of the chain, whose call appears
+// in the source.
+func (x *Expansion) Root() *Expansion {
+	for x.Parent != nil {
+		x = x.Parent
+	}
+	return x
+}
+
+// Default limits of an Expander.
+const (
+	DefaultMaxDepth      = 100
+	DefaultMaxExpansions = 100000
+)
+
+// An Expander expands macros.
+type Expander struct {
+	Fset *token.FileSet
+
+	// Macros holds the definitions known before the expanded file, like
+	// those of imported modules. The definitions of the file itself are
+	// added as they appear.
+	Macros map[string]*ast.MacroDef
+
+	// MaxDepth limits the nesting of expansions, so that recursive
+	// macros like \def\a{\a} stop; MaxExpansions limits their total
+	// number. Zero values select the defaults.
+	MaxDepth      int
+	MaxExpansions int
+
+	active   map[string]*ast.MacroDef
+	atLetter map[*ast.MacroDef]bool // definitions read with @ as a letter
+	macros   map[*ast.MacroDef]*macro
+	defAt    map[token.Pos]*ast.MacroDef // source definitions by position
+	verbatim [][2]token.Pos              // source ranges not to expand
+
+	input  []Token             // pending tokens; the next one is last
+	count  int                 // number of expansions so far
+	deep   map[*Expansion]bool // root expansions that exceeded MaxDepth
+	errors scanner.ErrorList
+}
+
+// New returns an expander for the definitions of the given files, like
+// the modules imported by a document. Later files override earlier ones.
+func New(fset *token.FileSet, imports ...*ast.File) *Expander {
+	e := &Expander{Fset: fset, Macros: make(map[string]*ast.MacroDef)}
+	for _, f := range imports {
+		for name, d := range f.Macros {
+			e.Macros[name] = d
+		}
+	}
+	return e
+}
+
+// File expands the macros in the source of f. The source must be the one
+// f was parsed from, and file its token.File. Definitions are removed
+// from the result, comments are dropped, and the content of verbatim
+// environments is passed through unexpanded.
+//
+// Errors, such as missing arguments or expansions exceeding the limits,
+// are returned as a [scanner.ErrorList] together with the result; a
+// macro that cannot be expanded is kept as is.
+func (e *Expander) File(f *ast.File, file *token.File, src []byte) ([]Token, error) {
+	e.init()
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.MacroDef:
+			e.defAt[n.Pos()] = n
+		case *ast.Verbatim:
+			e.verbatim = append(e.verbatim, [2]token.Pos{n.Pos(), n.End()})
+		}
+		return true
+	})
+	slices.SortFunc(e.verbatim, func(a, b [2]token.Pos) int { return int(a[0] - b[0]) })
+
+	toks := e.scanSource(file, src)
+	return e.expand(toks)
+}
+
+// Tokens expands the macros in toks, using the definitions in e.Macros.
+func (e *Expander) Tokens(toks []Token) ([]Token, error) {
+	e.init()
+	return e.expand(toks)
+}
+
+func (e *Expander) init() {
+	e.active = make(map[string]*ast.MacroDef, len(e.Macros))
+	e.atLetter = make(map[*ast.MacroDef]bool)
+	for name, d := range e.Macros {
+		e.active[name] = d
+		e.atLetter[d] = true // LaTeX reads packages with @ as a letter
+	}
+	e.macros = make(map[*ast.MacroDef]*macro)
+	e.defAt = make(map[token.Pos]*ast.MacroDef)
+	e.verbatim = nil
+	e.input = nil
+	e.count = 0
+	e.deep = make(map[*Expansion]bool)
+	e.errors = nil
+}
+
+// scanSource returns the tokens of the source. Each definition is
+// replaced by a single token at its position that activates it when read.
+func (e *Expander) scanSource(file *token.File, src []byte) []Token {
+	var s scanner.Scanner
+	s.Init(e.Fset, file, src, nil) // errors are reported by the parser
+
+	var toks []Token
+	for {
+		prev := s.Pos()
+		// The content of verbatim environments changes no category codes.
+		mode := scanner.TrackCatcodes
+		if e.inVerbatim(prev) {
+			mode = 0
+		}
+		s.SetMode(mode)
+
+		pos, tok, lit := s.Scan()
+		space := pos > prev
+		switch {
+		case tok == token.EOF:
+			return toks
+		case e.defAt[pos] != nil:
+			def := e.defAt[pos]
+			e.atLetter[def] = s.Catcodes().Lookup('@') == scanner.CatLetter
+			toks = append(toks, Token{Pos: pos, Tok: tok, Lit: lit, Space: space})
+			s.SkipTo(def.End()) // the body is read when the macro is used
+			continue
+		case tok == token.COMMENT:
+			continue
+		}
+		toks = append(toks, Token{Pos: pos, Tok: tok, Lit: lit, Space: space})
+	}
+}
+
+// inVerbatim reports whether pos lies in a verbatim environment.
+func (e *Expander) inVerbatim(pos token.Pos) bool {
+	i := sort.Search(len(e.verbatim), func(i int) bool { return e.verbatim[i][1] > pos })
+	return i < len(e.verbatim) && e.verbatim[i][0] <= pos
+}
+
+func (e *Expander) expand(toks []Token) ([]Token, error) {
+	maxDepth, maxCount := e.MaxDepth, e.MaxExpansions
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if maxCount <= 0 {
+		maxCount = DefaultMaxExpansions
+	}
+
+	e.push(toks)
+	var out []Token
+	for len(e.input) > 0 {
+		t := e.pop()
+		if t.Exp == nil {
+			if d := e.defAt[t.Pos]; d != nil {
+				e.define(d)
+				continue
+			}
+			if e.inVerbatim(t.Pos) {
+				out = append(out, t)
+				continue
+			}
+		}
+
+		if e.conditional(t) {
+			continue
+		}
+
+		d := e.lookup(t)
+		switch {
+		case d == nil || e.count > maxCount:
+			out = append(out, t)
+			continue
+		case e.count == maxCount:
+			e.error(t, fmt.Sprintf("too many macro expansions (more than %d)", maxCount))
+			e.count++
+			out = append(out, t)
+			continue
+		case t.Exp.Depth() >= maxDepth:
+			// Report each runaway recursion once.
+			if root := t.Exp.Root(); !e.deep[root] {
+				e.deep[root] = true
+				e.error(t, fmt.Sprintf("expansion of \\%s exceeds maximum depth %d", t.Lit, maxDepth))
+			}
+			out = append(out, t)
+			continue
+		}
+
+		x := &Expansion{Macro: d, Call: t.Pos, Parent: t.Exp, depth: t.Exp.Depth() + 1}
+		result, ok := e.call(t, x)
+		if !ok {
+			out = append(out, t)
+			continue
+		}
+		e.count++
+		if len(result) > 0 {
+			result[0].Space = t.Space // the expansion replaces the call
+		}
+		e.push(result)
+	}
+	return out, e.errors.Err()
+}
+
+// define activates the definition d.
+func (e *Expander) define(d *ast.MacroDef) {
+	if _, defined := e.active[d.Name]; defined && d.Provides() {
+		return
+	}
+	e.active[d.Name] = d
+}
+
+// lookup returns the definition of the macro t, or nil.
+func (e *Expander) lookup(t Token) *ast.MacroDef {
+	switch t.Tok {
+	case token.COMMAND, token.CONTROL_SYMBOL:
+		return e.active[t.Lit]
+	}
+	return nil
+}
+
+// push inserts toks in front of the pending input.
+func (e *Expander) push(toks []Token) {
+	for i := len(toks) - 1; i >= 0; i-- {
+		e.input = append(e.input, toks[i])
+	}
+}
+
+func (e *Expander) pop() Token {
+	t := e.input[len(e.input)-1]
+	e.input = e.input[:len(e.input)-1]
+	return t
+}
+
+// peek returns the i-th pending token, starting at 0.
+func (e *Expander) peek(i int) (Token, bool) {
+	if i >= len(e.input) {
+		return Token{}, false
+	}
+	return e.input[len(e.input)-1-i], true
+}
+
+// error reports an error for the call t at the position in the source
+// where the expansion chain of t starts.
+func (e *Expander) error(t Token, msg string) {
+	pos := t.Pos
+	if t.Exp != nil {
+		pos = t.Exp.Root().Call
+		msg += fmt.Sprintf(" (in expansion of \\%s)", t.Exp.Root().Macro.Name)
+	}
+	e.errors.Add(e.Fset.Position(pos), msg)
+}
+
+// scan returns the tokens of text, a part of the source starting at pos.
+func scan(text string, pos token.Pos, atLetter bool) []Token {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(text))
+	var s scanner.Scanner
+	s.Init(fset, file, []byte(text), nil)
+	if atLetter {
+		s.Catcodes().MakeAtLetter()
+	}
+
+	var toks []Token
+	for {
+		prev := s.Pos()
+		p, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return toks
+		}
+		if tok == token.COMMENT {
+			continue
+		}
+		t := Token{Tok: tok, Lit: lit, Space: p > prev}
+		if pos != token.NoPos {
+			t.Pos = pos + p - token.Pos(file.Base())
+		}
+		toks = append(toks, t)
+	}
+}
+
+// Text returns the source form of toks, with a space before each token
+// that was preceded by white space.
+func Text(toks []Token) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if t.Space && i > 0 && toks[i-1].Tok != token.NEWLINE {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.String())
+	}
+	return b.String()
+}
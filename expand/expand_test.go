@@ -0,0 +1,208 @@
+package expand
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// expandSource parses and expands src with the definitions of imports.
+func expandSource(t *testing.T, src string, imports ...string) ([]Token, *token.FileSet, *token.File, error) {
+	t.Helper()
+	fset := token.NewFileSet()
+	var mods []*ast.File
+	for i, imp := range imports {
+		file := fset.AddFile("mod"+string(rune('a'+i))+".tex", fset.Base(), len(imp))
+		f, err := parser.Parse(fset, file, []byte(imp), parser.ParseFull)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mods = append(mods, f)
+	}
+
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	f, err := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New(fset, mods...)
+	e.MaxDepth = 10
+	toks, err := e.File(f, file, []byte(src))
+	return toks, fset, file, err
+}
+
+func TestExpand(t *testing.T) {
+	cases := []struct {
+		src, want string
+	}{
+		{`\R is real`, `\R is real`}, // not defined yet
+		{`\newcommand{\R}{\mathbb{R}}\R`, `\mathbb{R}`},
+		{`\newcommand{\pair}[2]{<#1, #2>}\pair{a}{b c}`, `<a, b c>`},
+		{`\newcommand{\pair}[2]{<#1, #2>}\pair x y`, `<x, y>`},
+		{"\\newcommand{\\pair}[2]{<#1, #2>}\\pair{x}\n{y}", `<x, y>`},
+		{`\newcommand{\vec}[2][n]{#1_{#2}}\vec{x} \vec[m]{y}`, `n_{x} m_{y}`},
+		{`\newcommand{\opt}[1][{[}]{#1}\opt[{]}]`, `]`},
+		{`\newcommand{\a}{\b}\newcommand{\b}{b}\a`, `b`}, // expanded again
+		{`\newcommand{\a}{A}\renewcommand{\a}{B}\a`, `B`},
+		{`\newcommand{\a}{A}\providecommand{\a}{B}\a`, `A`},
+		{`\def\hash{##}\hash`, `#`},
+		{`\def\pair#1#2{<#1,#2>}\pair x y`, `<x,y>`},
+		{`\def\range#1..#2.{[#1, #2]}\range 1..10.`, `[1, 10]`},
+		{`\def\range#1..#2.{[#1, #2]}\range {1.5}..2.`, `[1.5, 2]`},
+		{`\def\stop#1\end{<#1>}\stop a b\end`, `<a b>`},
+		{`\def\m<#1>{[#1]}`, ``},
+		{`\newcommand{\price}[1]{\$#1 and 50\%}\price{5}`, `\$5 and 50\%`},
+		{`\makeatletter\newcommand{\at}{\@foo}\makeatother\at \@foo`, `\makeatletter\makeatother\@foo \@foo`},
+		{`AT\&T\@. \#1 \_x \{\}`, `AT\&T\@. \#1 \_x \{\}`}, // escapes round-trip
+		{`\newcommand{\x}{y}\begin{verbatim}\x\end{verbatim}\x`, `\begin{verbatim}\x\end{verbatim}y`},
+
+		// Document commands
+		{`\NewDocumentCommand{\pair}{m m}{<#1, #2>}\pair{a}{b c}`, `<a, b c>`},
+		{`\NewDocumentCommand\opt{O{d} m}{#1/#2}\opt{x} \opt[y]{x}`, `d/x y/x`},
+		{`\NewDocumentCommand{\ang}{D<>{0} m}{#1:#2}\ang{x} \ang<1>{x}`, `0:x 1:x`},
+		{`\NewDocumentCommand{\st}{s m}{\IfBooleanTF{#1}{S}{N}#2}\st{a} \st*{b}`, `Na Sb`},
+		{`\NewDocumentCommand{\pl}{t! m}{\IfBooleanT{#1}{!}#2}\pl!x \pl y`, `!x y`},
+		{`\NewDocumentCommand{\nv}{o m}{\IfNoValueTF{#1}{-}{#1}#2}\nv{a} \nv[b]{c}`, `-a bc`},
+		{`\NewDocumentCommand{\v}{o}{\IfValueT{#1}{<#1>}.}\v \v[x]`, `. <x>.`},
+		{`\NewDocumentCommand{\r}{r<> m}{#1#2}\r<a>b`, `ab`},
+		{`\NewDocumentCommand{\a}{m}{A}\RenewDocumentCommand{\a}{}{B}\a{x}`, `B{x}`},
+		{`\NewDocumentCommand{\a}{}{A}\ProvideDocumentCommand{\a}{}{B}\a`, `A`},
+		{`\IfBooleanTF{\x}{a}{b}`, `\IfBooleanTF{\x}{a}{b}`}, // not known
+	}
+	for _, c := range cases {
+		toks, _, _, err := expandSource(t, c.src)
+		if err != nil {
+			t.Errorf("%s: %v", c.src, err)
+			continue
+		}
+		if got := Text(toks); got != c.want {
+			t.Errorf("%s: got %q; want %q", c.src, got, c.want)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	mod := `\makeatletter
+\newcommand{\@name}{gotex}
+\newcommand{\name}{\@name}
+\makeatother`
+	over := `\renewcommand{\name}{TeX}`
+
+	toks, _, _, err := expandSource(t, `\name`, mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Text(toks); got != "gotex" {
+		t.Errorf("got %q; want %q", got, "gotex")
+	}
+
+	toks, _, _, err = expandSource(t, `\name`, mod, over)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Text(toks); got != "TeX" {
+		t.Errorf("later module: got %q; want %q", got, "TeX")
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	src := `\newcommand{\inner}[1]{<#1>}
+\newcommand{\outer}[1]{\inner{#1!}}
+\outer{x}`
+	toks, fset, file, err := expandSource(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Text(toks); got != "\n\n<x!>" {
+		t.Fatalf("got %q", got)
+	}
+
+	at := func(p token.Pos) string {
+		offs := int(p) - file.Base()
+		return src[offs:]
+	}
+	for _, tok := range toks {
+		switch tok.Lit {
+		case "x":
+			// Arguments come from the call site.
+			if !strings.HasPrefix(at(tok.Pos), "x}") || tok.Exp != nil {
+				t.Errorf("x: got position %s, expansion %v", fset.Position(tok.Pos), tok.Exp)
+			}
+		case "!":
+			if !strings.HasPrefix(at(tok.Pos), "!}}") || tok.Exp == nil || tok.Exp.Macro.Name != "outer" {
+				t.Errorf("!: got position %s", fset.Position(tok.Pos))
+			}
+		case "<":
+			x := tok.Exp
+			if x == nil || x.Macro.Name != "inner" || x.Depth() != 2 || x.Root().Macro.Name != "outer" {
+				t.Fatalf("<: got expansion %+v", x)
+			}
+			if got := fset.Position(x.Root().Call).Line; got != 3 {
+				t.Errorf("root call on line %d; want 3", got)
+			}
+		}
+	}
+}
+
+func TestDefaultProvenance(t *testing.T) {
+	src := `\newcommand{\greet}[1][world]{hello #1}
+\greet \greet[you]`
+	toks, _, _, err := expandSource(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range toks {
+		switch tok.Lit {
+		case "world":
+			// The default belongs to the expansion that substituted it.
+			if tok.Exp == nil || tok.Exp.Macro.Name != "greet" {
+				t.Errorf("world: got expansion %v", tok.Exp)
+			}
+		case "you":
+			if tok.Exp != nil {
+				t.Errorf("you: got expansion %v", tok.Exp)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	cases := []struct {
+		src, msg string
+		line     int
+	}{
+		{"\\def\\a{\\a}\n\\a", `expansion of \a exceeds maximum depth 10 (in expansion of \a)`, 2},
+		{"\\newcommand{\\two}[2]{#1#2}\n\\two{x}", `missing argument of \two`, 2},
+		{"\\def\\stop#1.{#1}\n\\stop x", `runaway argument of \stop`, 2},
+		{"\\def\\m<#1>{#1}\n\\m x", `use of \m does not match its definition`, 2},
+		{"\\NewDocumentCommand{\\r}{r<>}{#1}\n\\r x", `missing argument of \r`, 2},
+	}
+	for _, c := range cases {
+		toks, _, _, err := expandSource(t, c.src)
+		list, ok := err.(scanner.ErrorList)
+		if !ok || len(list) != 1 || list[0].Msg != c.msg || list[0].Pos.Line != c.line {
+			t.Errorf("%q: got error %v; want %d: %s", c.src, err, c.line, c.msg)
+		}
+		// The failed call is kept, followed by the input it could not use.
+		if len(toks) == 0 {
+			t.Errorf("%q: got no tokens", c.src)
+		}
+	}
+
+	// \def\a{\a\a} doubles the work with each level.
+	fset := token.NewFileSet()
+	src := `\def\a{\a\a}\a`
+	file := fset.AddFile("exp.tex", fset.Base(), len(src))
+	f, _ := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	e := New(fset)
+	e.MaxExpansions = 1000
+	_, err := e.File(f, file, []byte(src))
+	list, _ := err.(scanner.ErrorList)
+	if len(list) != 2 || list[1].Msg != "too many macro expansions (more than 1000) (in expansion of \\a)" {
+		t.Errorf("got %v", list)
+	}
+}
@@ -0,0 +1,309 @@
+package expand
+
+import (
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/token"
+)
+
+// macro is a definition prepared for expansion.
+type macro struct {
+	body []Token
+	def  []Token // default value of the optional first argument, if any
+
+	// Parameter text of \def: prefix must follow the name literally;
+	// delims[i] ends argument i+1 (empty for undelimited arguments).
+	prefix []Token
+	delims [][]Token
+
+	// Arguments of a document command and their default values.
+	spec     command.Spec
+	defaults [][]Token
+}
+
+// macro returns the prepared form of d.
+func (e *Expander) macro(d *ast.MacroDef) *macro {
+	if m := e.macros[d]; m != nil {
+		return m
+	}
+	at := e.atLetter[d]
+	m := &macro{body: scan(d.Body, d.BodyPos, at)}
+	if d.Default != nil {
+		m.def = scan(*d.Default, d.DefaultPos, at)
+	}
+	switch {
+	case d.IsDef():
+		m.prefix, m.delims = splitParams(scan(d.Params, token.NoPos, at))
+	case d.IsDocumentCommand():
+		m.spec, _ = command.ParseSpec(d.Spec) // reported by the parser
+		m.defaults = make([][]Token, len(m.spec))
+		for i, p := range m.spec {
+			if p.HasDefault() {
+				m.defaults[i] = scan(p.Default, token.NoPos, at)
+			}
+		}
+	default:
+		m.delims = make([][]Token, d.NArgs)
+	}
+	e.macros[d] = m
+	return m
+}
+
+// splitParams splits the parameter text of \def at its parameters.
+func splitParams(params []Token) (prefix []Token, delims [][]Token) {
+	cur := &prefix
+	for i := 0; i < len(params); i++ {
+		t := params[i]
+		if t.Tok == token.HASH && i+1 < len(params) && params[i+1].Tok == token.NUMBER {
+			delims = append(delims, nil)
+			cur = &delims[len(delims)-1]
+			if num := params[i+1]; len(num.Lit) > 1 {
+				// #12: the digits after the first delimit the argument.
+				*cur = append(*cur, Token{Tok: token.NUMBER, Lit: num.Lit[1:]})
+			}
+			i++
+			continue
+		}
+		*cur = append(*cur, t)
+	}
+	return prefix, delims
+}
+
+// call reads the arguments of the macro called by t from the input and
+// returns its body with the arguments substituted. It reports false if
+// the arguments do not match the definition.
+func (e *Expander) call(t Token, x *Expansion) ([]Token, bool) {
+	d := x.Macro
+	m := e.macro(d)
+
+	// Reading arguments only pops tokens, so truncating the input to its
+	// original length restores it if they do not match.
+	n := len(e.input)
+	fail := func(msg string) ([]Token, bool) {
+		e.error(t, msg)
+		e.input = e.input[:n]
+		return nil, false
+	}
+
+	var args [][]Token
+	if d.IsDocumentCommand() {
+		for i, p := range m.spec {
+			arg, ok := e.documentArg(p, m.defaults[i], x)
+			if !ok {
+				return fail("missing argument of \\" + d.Name)
+			}
+			args = append(args, arg)
+		}
+		return substitute(m.body, args, x), true
+	}
+	if d.IsDef() {
+		for _, want := range m.prefix {
+			if got, ok := e.peek(0); !ok || !same(got, want) {
+				return fail("use of \\" + d.Name + " does not match its definition")
+			}
+			e.pop()
+		}
+	}
+	for i, delim := range m.delims {
+		var (
+			arg []Token
+			ok  bool
+		)
+		switch {
+		case i == 0 && d.Default != nil:
+			if arg, ok = e.optional(); !ok {
+				arg, ok = value(x, m.def...), true
+			}
+		case len(delim) > 0:
+			arg, ok = e.delimited(delim)
+			if !ok {
+				return fail("runaway argument of \\" + d.Name)
+			}
+		default:
+			arg, ok = e.undelimited()
+		}
+		if !ok {
+			return fail("missing argument of \\" + d.Name)
+		}
+		args = append(args, arg)
+	}
+
+	return substitute(m.body, args, x), true
+}
+
+// value returns a copy of toks belonging to x, for the values substituted
+// for omitted arguments, like the default of an optional argument.
+func value(x *Expansion, toks ...Token) []Token {
+	out := make([]Token, len(toks))
+	for i, t := range toks {
+		t.Exp = x
+		out[i] = t
+	}
+	return out
+}
+
+// substitute returns body with the parameters replaced by args. Tokens
+// of the body belong to x; the arguments keep their provenance.
+func substitute(body []Token, args [][]Token, x *Expansion) []Token {
+	out := make([]Token, 0, len(body))
+	for i := 0; i < len(body); i++ {
+		t := body[i]
+		t.Exp = x
+		if t.Tok == token.HASH && i+1 < len(body) {
+			switch next := body[i+1]; {
+			case next.Tok == token.HASH:
+				i++ // ## stands for #
+			case next.Tok == token.NUMBER:
+				i++
+				if n := int(next.Lit[0] - '1'); 0 <= n && n < len(args) && len(args[n]) > 0 {
+					// The argument takes the place of the parameter.
+					start := len(out)
+					out = append(out, args[n]...)
+					out[start].Space = t.Space
+				}
+				if len(next.Lit) > 1 {
+					out = append(out, Token{Pos: next.Pos + 1, Tok: token.NUMBER, Lit: next.Lit[1:], Exp: x})
+				}
+				continue
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// skipSpace skips a line break before an argument. A blank line is an
+// argument of its own, the paragraph break.
+func (e *Expander) skipSpace() {
+	if t, ok := e.peek(0); ok && t.Tok == token.NEWLINE {
+		if next, ok := e.peek(1); !ok || next.Tok != token.NEWLINE {
+			e.pop()
+		}
+	}
+}
+
+// undelimited reads an undelimited argument: a single token or a group,
+// whose braces are removed.
+func (e *Expander) undelimited() ([]Token, bool) {
+	e.skipSpace()
+	t, ok := e.peek(0)
+	if !ok || t.Tok == token.RBRACE {
+		return nil, false
+	}
+	if t.Tok != token.LBRACE {
+		e.pop()
+		return []Token{t}, true
+	}
+	group, ok := e.group()
+	if !ok {
+		return nil, false
+	}
+	return group[1 : len(group)-1], true
+}
+
+// optional reads an optional argument [...], if present.
+func (e *Expander) optional() ([]Token, bool) {
+	return e.between(Token{Tok: token.LBRACK, Lit: "["}, Token{Tok: token.RBRACK, Lit: "]"})
+}
+
+// between reads an argument delimited by open and close, if present.
+func (e *Expander) between(open, close Token) ([]Token, bool) {
+	e.skipSpace()
+	if t, ok := e.peek(0); !ok || !same(t, open) {
+		return nil, false
+	}
+	n := len(e.input)
+	e.pop() // open
+	arg, ok := e.delimited([]Token{close})
+	if !ok {
+		e.input = e.input[:n] // an unclosed [ is not an argument
+	}
+	return arg, ok
+}
+
+// delimited reads an argument ending with delim, which is consumed. If
+// the argument is a single group, its braces are removed.
+func (e *Expander) delimited(delim []Token) ([]Token, bool) {
+	var arg []Token
+	for {
+		if e.matches(delim) {
+			for range delim {
+				e.pop()
+			}
+			break
+		}
+		t, ok := e.peek(0)
+		if !ok || t.Tok == token.RBRACE {
+			return nil, false
+		}
+		if t.Tok == token.LBRACE {
+			group, ok := e.group()
+			if !ok {
+				return nil, false
+			}
+			arg = append(arg, group...)
+			continue
+		}
+		arg = append(arg, e.pop())
+	}
+
+	if n := len(arg); n >= 2 && arg[0].Tok == token.LBRACE && arg[n-1].Tok == token.RBRACE {
+		if group, ok := matchGroup(arg); ok && len(group) == n {
+			return arg[1 : n-1], true
+		}
+	}
+	return arg, true
+}
+
+// matches reports whether the pending input starts with toks.
+func (e *Expander) matches(toks []Token) bool {
+	for i, want := range toks {
+		if got, ok := e.peek(i); !ok || !same(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// group reads a brace group, including the braces.
+func (e *Expander) group() ([]Token, bool) {
+	var toks []Token
+	depth := 0
+	for len(e.input) > 0 {
+		t := e.pop()
+		toks = append(toks, t)
+		switch t.Tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return toks, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// matchGroup returns the group at the start of toks.
+func matchGroup(toks []Token) ([]Token, bool) {
+	depth := 0
+	for i, t := range toks {
+		switch t.Tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return toks[:i+1], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// same reports whether a and b are the same token, regardless of where
+// they come from.
+func same(a, b Token) bool {
+	return a.Tok == b.Tok && a.Lit == b.Lit
+}
@@ -0,0 +1,155 @@
+package expand
+
+import (
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/token"
+)
+
+// Values of the arguments of document commands, as passed by xparse: a
+// star or token argument is \BooleanTrue or \BooleanFalse, an omitted
+// optional argument without default is -NoValue-.
+var (
+	booleanTrue  = Token{Tok: token.COMMAND, Lit: "BooleanTrue"}
+	booleanFalse = Token{Tok: token.COMMAND, Lit: "BooleanFalse"}
+	noValue      = scan("-NoValue-", token.NoPos, false)
+)
+
+// documentArg reads an argument described by p. The values xparse
+// substitutes for omitted arguments belong to x.
+func (e *Expander) documentArg(p command.Param, def []Token, x *Expansion) ([]Token, bool) {
+	switch p.Type {
+	case 's', 't':
+		want := "*"
+		if p.Type == 't' {
+			want = p.Open
+		}
+		if t, ok := e.peek(0); ok && t.String() == want {
+			e.pop()
+			return value(x, booleanTrue), true
+		}
+		return value(x, booleanFalse), true
+
+	case 'o', 'O', 'd', 'D', 'r', 'R':
+		open, close := scan(p.Open, token.NoPos, false), scan(p.Close, token.NoPos, false)
+		if len(open) == 1 && len(close) == 1 {
+			if arg, ok := e.between(open[0], close[0]); ok {
+				return arg, true
+			}
+		}
+		switch {
+		case p.HasDefault():
+			return value(x, def...), true // a missing R argument is reported by the parser
+		case p.Optional():
+			return value(x, noValue...), true
+		}
+		return nil, false
+
+	case 'v':
+		e.skipSpace()
+		t, ok := e.peek(0)
+		if !ok || t.Tok == token.LBRACE {
+			return e.undelimited()
+		}
+		e.pop()
+		return e.delimited([]Token{t})
+	}
+	return e.undelimited()
+}
+
+// conditionals lists the xparse tests on argument values: for each, the
+// value making the test true and whether it has a true and a false branch.
+var conditionals = map[string]struct {
+	isTrue            func(arg []Token) (result, known bool)
+	hasTrue, hasFalse bool
+}{
+	"IfBooleanTF": {isBoolean, true, true},
+	"IfBooleanT":  {isBoolean, true, false},
+	"IfBooleanF":  {isBoolean, false, true},
+	"IfNoValueTF": {isNoValue, true, true},
+	"IfNoValueT":  {isNoValue, true, false},
+	"IfNoValueF":  {isNoValue, false, true},
+	"IfValueTF":   {isValue, true, true},
+	"IfValueT":    {isValue, true, false},
+	"IfValueF":    {isValue, false, true},
+}
+
+func isBoolean(arg []Token) (result, known bool) {
+	if len(arg) == 1 {
+		switch {
+		case same(arg[0], booleanTrue):
+			return true, true
+		case same(arg[0], booleanFalse):
+			return false, true
+		}
+	}
+	return false, false
+}
+
+func isNoValue(arg []Token) (result, known bool) {
+	if len(arg) != len(noValue) {
+		return false, true
+	}
+	for i, t := range arg {
+		if !same(t, noValue[i]) {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+func isValue(arg []Token) (result, known bool) {
+	result, known = isNoValue(arg)
+	return !result, known
+}
+
+// conditional evaluates the xparse test t, like \IfBooleanTF{#1}{a}{b},
+// and pushes the chosen branch. It reports false, leaving the input
+// unchanged, if t is not such a test or its outcome is not known. A test
+// redefined by the user is left to the definition.
+func (e *Expander) conditional(t Token) bool {
+	c, ok := conditionals[t.Lit]
+	if _, defined := e.active[t.Lit]; !ok || defined || t.Tok != token.COMMAND {
+		return false
+	}
+	n := len(e.input)
+	arg, ok := e.undelimited()
+	if !ok {
+		e.input = e.input[:n]
+		return false
+	}
+	result, known := c.isTrue(arg)
+	if !known {
+		e.input = e.input[:n]
+		return false
+	}
+
+	var branch []Token
+	if c.hasTrue {
+		yes, ok := e.undelimited()
+		if !ok {
+			e.input = e.input[:n]
+			return false
+		}
+		if result {
+			branch = yes
+		}
+	}
+	if c.hasFalse {
+		no, ok := e.undelimited()
+		if !ok {
+			e.input = e.input[:n]
+			return false
+		}
+		if !result {
+			branch = no
+		}
+	}
+	if len(branch) > 0 {
+		branch = append([]Token(nil), branch...)
+		branch[0].Space = t.Space
+	} else if len(e.input) > 0 && t.Space {
+		e.input[len(e.input)-1].Space = true // keep the space before the test
+	}
+	e.push(branch)
+	return true
+}
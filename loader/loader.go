@@ -0,0 +1,174 @@
+// Package loader loads a document spread over several files. Starting
+// with the main file, it follows the \input, \include and \import
+// statements and parses each file of the dependency graph once.
+// \usemodule is not followed: modules define macros, not content.
+//
+// As in LaTeX, included files are resolved relative to the directory of
+// the main file; the extensions .tex and .gtex may be omitted. A file
+// loaded as the main file may name the main document it belongs to with
+// a "% !TEX root" comment, like a chapter edited on its own; its includes
+// are then resolved relative to the directory of that document first.
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// A Loader loads the files of documents.
+type Loader struct {
+	Fset *token.FileSet
+	Mode parser.Mode // parsing mode of the files; if 0, parser.ParseFull
+
+	// ReadFile reads the named file. If nil, os.ReadFile is used.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// A Document is a loaded document.
+type Document struct {
+	Files []*File  // files in the order of their first inclusion, starting with the main file
+	Dirs  []string // directories against which included files are resolved
+}
+
+// Main returns the main file of d.
+func (d *Document) Main() *File { return d.Files[0] }
+
+// A File is a file of a document.
+type File struct {
+	Name     string
+	File     *token.File
+	AST      *ast.File
+	Src      []byte
+	Includes []*Include // statements including a file that was found, in source order
+}
+
+// An Include is a statement including a file. A file included more than
+// once, or by itself, is loaded once and shared by its includes.
+type Include struct {
+	Spec *ast.ImportSpec
+	File *File
+}
+
+// Load loads the document whose main file is filename. If the main file
+// cannot be read, the result is nil.
+//
+// Files that cannot be found or parsed are reported in a
+// [scanner.ErrorList] sorted by source position; the remaining files are
+// returned nonetheless.
+func (l *Loader) Load(filename string) (*Document, error) {
+	src, err := l.read(filename)
+	if err != nil {
+		return nil, err
+	}
+	ld := &load{
+		Loader: l,
+		doc:    new(Document),
+		files:  make(map[string]*File),
+	}
+	ld.file(filename, src)
+	ld.errors.Sort()
+	return ld.doc, ld.errors.Err()
+}
+
+// load is the state of a single call of Load.
+type load struct {
+	*Loader
+	doc    *Document
+	files  map[string]*File // files loaded so far, by name
+	errors scanner.ErrorList
+}
+
+// file loads the named file and the files it includes.
+func (ld *load) file(name string, src []byte) *File {
+	file := ld.Fset.AddFile(name, ld.Fset.Base(), len(src))
+	cfg := parser.Config{Mode: ld.Mode}
+	if cfg.Mode == 0 {
+		cfg.Mode = parser.ParseFull
+	}
+	f, err := cfg.Parse(ld.Fset, file, src)
+	if list, ok := err.(scanner.ErrorList); ok {
+		ld.errors = append(ld.errors, list...)
+	}
+	lf := &File{Name: name, File: file, AST: f, Src: src}
+	ld.files[name] = lf
+	ld.doc.Files = append(ld.doc.Files, lf)
+	if ld.doc.Dirs == nil {
+		ld.doc.Dirs = Dirs(name, f)
+	}
+
+	for _, imp := range f.Imports {
+		if imp.Cmd == "usemodule" {
+			continue
+		}
+		target, data := ld.Resolve(ld.doc.Dirs, imp)
+		if target == "" {
+			ld.errors.Add(ld.Fset.Position(imp.Pos()), fmt.Sprintf("cannot find file %q", imp.Name))
+			continue
+		}
+		inc := ld.files[target]
+		if inc == nil {
+			inc = ld.file(target, data)
+		}
+		lf.Includes = append(lf.Includes, &Include{Spec: imp, File: inc})
+	}
+	return lf
+}
+
+// Dirs returns the directories against which the files included by f,
+// the file with the given name, are resolved: the directory of f,
+// preceded by that of the main document if f names one with a
+// "% !TEX root" comment.
+func Dirs(name string, f *ast.File) []string {
+	dir := filepath.Dir(name)
+	if d := f.Directive(ast.TeXRoot); d != nil && d.Value != "" {
+		root := filepath.FromSlash(d.Value)
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(dir, root)
+		}
+		if root := filepath.Dir(root); root != dir {
+			return []string{root, dir}
+		}
+	}
+	return []string{dir}
+}
+
+// Resolve returns the name and content of the file included by imp, or
+// "" if there is none. The extensions .tex and .gtex may be omitted.
+func (l *Loader) Resolve(dirs []string, imp *ast.ImportSpec) (string, []byte) {
+	return l.Find(dirs, imp.Name, ".tex", ".gtex")
+}
+
+// Find returns the name and content of the file name, or "" if there is
+// none. A relative name is looked up in each of dirs in turn, first as
+// is and then with each of exts appended.
+func (l *Loader) Find(dirs []string, name string, exts ...string) (string, []byte) {
+	name = filepath.FromSlash(name)
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		base := filepath.Join(dir, name)
+		if data, err := l.read(base); err == nil {
+			return base, data
+		}
+		for _, ext := range exts {
+			if data, err := l.read(base + ext); err == nil {
+				return base + ext, data
+			}
+		}
+	}
+	return "", nil
+}
+
+func (l *Loader) read(name string) ([]byte, error) {
+	if l.ReadFile != nil {
+		return l.ReadFile(name)
+	}
+	return os.ReadFile(name)
+}
@@ -0,0 +1,136 @@
+package loader
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// mapFS returns a ReadFile function for the files below dir.
+func mapFS(dir string, files map[string]string) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := files[filepath.ToSlash(rel)]; ok {
+			return []byte(data), nil
+		}
+		return nil, fs.ErrNotExist
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := filepath.FromSlash("/doc")
+	files := map[string]string{
+		"main.tex": `\input{chapters/one}
+\include{chapters/two.gtex}
+\input{chapters/one}
+\include{missing}
+\usemodule{mathx}
+`,
+		"chapters/one.tex": `\input{main}`,
+		"chapters/two.gtex": `\input{chapters/one}
+\section{`,
+	}
+	l := &Loader{Fset: token.NewFileSet(), ReadFile: mapFS(dir, files)}
+	doc, err := l.Load(filepath.Join(dir, "main.tex"))
+	if doc == nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range doc.Files {
+		rel, _ := filepath.Rel(dir, f.Name)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if got := strings.Join(names, " "); got != "main.tex chapters/one.tex chapters/two.gtex" {
+		t.Errorf("got files %s", got)
+	}
+
+	main, one, two := doc.Files[0], doc.Files[1], doc.Files[2]
+	if doc.Main() != main || len(main.Includes) != 3 {
+		t.Fatalf("got %d includes of the main file; want 3", len(main.Includes))
+	}
+	for i, want := range []*File{one, two, one} {
+		if inc := main.Includes[i]; inc.File != want {
+			t.Errorf("include %d of main: got %s; want %s", i, inc.File.Name, want.Name)
+		}
+	}
+	if len(one.Includes) != 1 || one.Includes[0].File != main {
+		t.Errorf("got includes %v of chapters/one; want main", one.Includes)
+	}
+	if len(two.Includes) != 1 || two.Includes[0].File != one {
+		t.Errorf("got includes %v of chapters/two; want chapters/one", two.Includes)
+	}
+
+	errs, ok := err.(scanner.ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("got errors %v; want 2", err)
+	}
+	if !strings.HasSuffix(errs[0].Pos.Filename, "two.gtex") {
+		t.Errorf("got error %s; want a syntax error in chapters/two.gtex", errs[0])
+	}
+	if errs[1].Pos.Line != 4 || errs[1].Msg != `cannot find file "missing"` {
+		t.Errorf("got error %s", errs[1])
+	}
+
+	if _, err := l.Load(filepath.Join(dir, "absent.tex")); err == nil {
+		t.Error("loading a missing main file succeeded")
+	}
+}
+
+func TestTeXRoot(t *testing.T) {
+	dir := filepath.FromSlash("/doc")
+	files := map[string]string{
+		"chapters/intro.tex":   "% !TEX root = ../main.tex\n\\input{figures}\n\\input{notes}\n",
+		"chapters/notes.tex":   "",
+		"figures.tex":          "",
+		"chapters/figures.tex": "",
+	}
+	l := &Loader{Fset: token.NewFileSet(), ReadFile: mapFS(dir, files)}
+	doc, err := l.Load(filepath.Join(dir, "chapters", "intro.tex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{dir, filepath.Join(dir, "chapters")}; strings.Join(doc.Dirs, " ") != strings.Join(want, " ") {
+		t.Errorf("got dirs %q; want %q", doc.Dirs, want)
+	}
+	// Paths are relative to the main document first.
+	var names []string
+	for _, inc := range doc.Main().Includes {
+		rel, _ := filepath.Rel(dir, inc.File.Name)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if got := strings.Join(names, " "); got != "figures.tex chapters/notes.tex" {
+		t.Errorf("got includes %s", got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := filepath.FromSlash("/doc")
+	l := &Loader{ReadFile: mapFS(dir, map[string]string{
+		"a.bib":     "x",
+		"sub/b.tex": "y",
+	})}
+	for _, test := range []struct {
+		dirs []string
+		name string
+		want string
+	}{
+		{[]string{dir}, "a", "a.bib"},
+		{[]string{dir}, "a.bib", "a.bib"},
+		{[]string{filepath.Join(dir, "sub"), dir}, "a", "a.bib"},
+		{[]string{dir}, "sub/b", ""},
+		{[]string{"/elsewhere"}, "/doc/a", "a.bib"},
+	} {
+		name, _ := l.Find(test.dirs, test.name, ".bib")
+		if want := filepath.Join(dir, test.want); test.want == "" && name != "" || test.want != "" && name != want {
+			t.Errorf("Find(%q, %q) = %q; want %q", test.dirs, test.name, name, test.want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Package normalize converts the TeX input conventions for accents,
+// ligatures and special glyphs in words to Unicode: \'e becomes é, \"{o}
+// becomes ö, \ss becomes ß and -- becomes –.
+//
+// Normalized text is meant for search indexing, word counts and spell
+// checking; it is not a substitute for typesetting.
+package normalize
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/neox5/gotex/ast"
+)
+
+// File normalizes the literals of all words in f. The source text of a
+// changed word is kept in its Raw field; its position is not changed.
+func File(f *ast.File) {
+	ast.Walk(visitor{}, f)
+}
+
+type visitor struct{}
+
+func (v visitor) Visit(n ast.Node) ast.Visitor {
+	if w, ok := n.(*ast.Word); ok && w.Raw == "" {
+		if lit := String(w.Lit); lit != w.Lit {
+			w.Raw, w.Lit = w.Lit, lit
+		}
+	}
+	return v
+}
+
+// String returns s with TeX accents, ligatures and glyph commands replaced
+// by the Unicode characters they produce. Unknown commands are kept.
+func String(s string) string {
+	if !strings.ContainsAny(s, "\\{}-'`") {
+		return s // fast path: nothing to convert
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case '\\':
+			i = command(&b, s, i)
+		case '{', '}':
+			i++ // grouping only, as in f{}f
+		case '-':
+			switch {
+			case strings.HasPrefix(s[i:], "---"):
+				b.WriteRune('—')
+				i += 3
+			case strings.HasPrefix(s[i:], "--"):
+				b.WriteRune('–')
+				i += 2
+			default:
+				b.WriteByte(c)
+				i++
+			}
+		case '`', '\'':
+			double := i+1 < len(s) && s[i+1] == c
+			b.WriteRune(quote(c, double))
+			if double {
+				i++
+			}
+			i++
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// command converts the command starting with the backslash at s[i] and
+// returns the index following it.
+func command(b *strings.Builder, s string, i int) int {
+	start := i
+	i++ // skip '\'
+	if i == len(s) {
+		b.WriteByte('\\')
+		return i
+	}
+
+	// Control symbols: \' \$ \- ...
+	if !isLetter(s[i]) {
+		sym := s[i : i+1]
+		i++
+		switch {
+		case IsAccent(sym):
+			base, next := argument(s, i)
+			b.WriteString(accent(sym, base))
+			return next
+		case sym == "-" || sym == "@" || sym == "/":
+			return i // discretionary hyphen, space factor, italic correction
+		case strings.Contains("$%&#_{}", sym):
+			b.WriteString(sym)
+			return i
+		}
+		b.WriteString(s[start:i])
+		return i
+	}
+
+	// Control words: \ss \c{c} ...
+	for i < len(s) && isLetter(s[i]) {
+		i++
+	}
+	name := s[start+1 : i]
+	switch {
+	case IsAccent(name):
+		base, next := argument(s, skipSpaces(s, i))
+		b.WriteString(accent(name, base))
+		return next
+	case IsGlyph(name):
+		b.WriteString(glyphs[name])
+		i = skipSpaces(s, i)
+		if strings.HasPrefix(s[i:], "{}") {
+			i += 2
+		}
+		return i
+	}
+	b.WriteString(s[start:i])
+	return i
+}
+
+// argument returns the base character of an accent argument starting at
+// s[i] (a single character, or a group like {o} or {\i}), and the index
+// following the argument. The base of \i and \j is the dotless letter.
+func argument(s string, i int) (base string, next int) {
+	if i == len(s) {
+		return "", i
+	}
+	if s[i] != '{' {
+		if s[i] == '\\' {
+			return dotless(s, i)
+		}
+		_, w := utf8.DecodeRuneInString(s[i:])
+		return s[i : i+w], i + w
+	}
+
+	end := strings.IndexByte(s[i:], '}')
+	if end < 0 {
+		return String(s[i+1:]), len(s)
+	}
+	inner := strings.TrimSpace(s[i+1 : i+end])
+	if strings.HasPrefix(inner, "\\") {
+		base, _ = dotless(inner, 0)
+		return base, i + end + 1
+	}
+	return inner, i + end + 1
+}
+
+// dotless handles \i and \j as accent arguments.
+func dotless(s string, i int) (string, int) {
+	for _, name := range []string{"i", "j"} {
+		cmd := "\\" + name
+		if strings.HasPrefix(s[i:], cmd) && (len(s) == i+len(cmd) || !isLetter(s[i+len(cmd)])) {
+			return glyphs[name], skipSpaces(s, i+len(cmd))
+		}
+	}
+	return "", i
+}
+
+// accent applies the accent command name to base. It returns the
+// precomposed character if there is one, and base followed by the
+// combining mark otherwise.
+func accent(name, base string) string {
+	if base == "" {
+		return string(combining[name])
+	}
+	r, w := utf8.DecodeRuneInString(base)
+	// Accents on dotless letters compose with the dotted ones.
+	switch r {
+	case 'ı':
+		r = 'i'
+	case 'ȷ':
+		r = 'j'
+	}
+	if c, ok := composed[name][r]; ok {
+		return string(c) + base[w:]
+	}
+	return base[:w] + string(combining[name]) + base[w:]
+}
+
+// quote returns the typographic quote for ` and ', or for “ and ”.
+func quote(c byte, double bool) rune {
+	switch {
+	case c == '`' && double:
+		return '“'
+	case c == '`':
+		return '‘'
+	case double:
+		return '”'
+	}
+	return '’'
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// IsAccent reports whether the command \name (a control word like c or a
+// control symbol like ') puts an accent on its argument.
+func IsAccent(name string) bool {
+	_, ok := combining[name]
+	return ok
+}
+
+// IsGlyph reports whether the command \name produces a letter, such as
+// \ss or \o.
+func IsGlyph(name string) bool {
+	_, ok := glyphs[name]
+	return ok
+}
+
+// combining maps accent commands to Unicode combining marks.
+var combining = map[string]rune{
+	"'":  '\u0301', // acute
+	"`":  '\u0300', // grave
+	"^":  '\u0302', // circumflex
+	"\"": '\u0308', // diaeresis
+	"~":  '\u0303', // tilde
+	"=":  '\u0304', // macron
+	".":  '\u0307', // dot above
+	"u":  '\u0306', // breve
+	"v":  '\u030C', // caron
+	"H":  '\u030B', // double acute
+	"r":  '\u030A', // ring above
+	"c":  '\u0327', // cedilla
+	"k":  '\u0328', // ogonek
+	"d":  '\u0323', // dot below
+	"b":  '\u0331', // macron below
+	"t":  '\u0361', // tie
+}
+
+// glyphs maps glyph commands to the text they produce.
+var glyphs = map[string]string{
+	"ss": "ß", "SS": "SS",
+	"ae": "æ", "AE": "Æ",
+	"oe": "œ", "OE": "Œ",
+	"o": "ø", "O": "Ø",
+	"aa": "å", "AA": "Å",
+	"l": "ł", "L": "Ł",
+	"i": "ı", "j": "ȷ",
+	"dh": "ð", "DH": "Ð",
+	"th": "þ", "TH": "Þ",
+	"ng": "ŋ", "NG": "Ŋ",
+}
+
+// composed maps accent commands and base letters to precomposed
+// characters. It is built from pairs of base letter and result.
+var composed = func() map[string]map[rune]rune {
+	pairs := map[string]string{
+		"'":  "aáeéiíoóuúyýAÁEÉIÍOÓUÚYÝcćCĆnńNŃsśSŚzźZŹlĺLĹrŕRŔgǵGǴ",
+		"`":  "aàeèiìoòuùAÀEÈIÌOÒUÙnǹNǸ",
+		"^":  "aâeêiîoôuûAÂEÊIÎOÔUÛcĉCĈgĝGĜhĥHĤjĵJĴsŝSŜwŵWŴyŷYŶ",
+		"\"": "aäeëiïoöuüyÿAÄEËIÏOÖUÜYŸ",
+		"~":  "aãoõnñAÃOÕNÑiĩIĨuũUŨ",
+		"=":  "aāeēiīoōuūAĀEĒIĪOŌUŪ",
+		".":  "cċCĊeėEĖgġGĠIİzżZŻ",
+		"u":  "aăAĂgğGĞuŭUŬeĕEĔiĭIĬoŏOŎ",
+		"v":  "cčCČdďDĎeěEĚnňNŇrřRŘsšSŠtťTŤzžZŽ",
+		"H":  "oőOŐuűUŰ",
+		"r":  "aåAÅuůUŮ",
+		"c":  "cçCÇsşSŞtţTŢgģGĢkķKĶlļLĻnņNŅrŗRŖ",
+		"k":  "aąAĄeęEĘiįIĮuųUŲ",
+	}
+	m := make(map[string]map[rune]rune, len(pairs))
+	for name, list := range pairs {
+		m[name] = make(map[rune]rune)
+		for len(list) > 0 {
+			base, w1 := utf8.DecodeRuneInString(list)
+			c, w2 := utf8.DecodeRuneInString(list[w1:])
+			m[name][base] = c
+			list = list[w1+w2:]
+		}
+	}
+	return m
+}()
@@ -0,0 +1,88 @@
+package normalize_test
+
+import (
+	"testing"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/normalize"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/token"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"plain", "plain"},
+		{`caf\'e`, "café"},
+		{`\'Ecole`, "École"},
+		{`na\"{\i}ve`, "naïve"},
+		{`\"{o}`, "ö"},
+		{`Gr\"u\ss e`, "Grüße"},
+		{`Stra\ss{}e`, "Straße"},
+		{`gar\c{c}on`, "garçon"},
+		{`\c c`, "ç"},
+		{`\v{S}koda`, "Škoda"},
+		{`Erd\H{o}s`, "Erdős"},
+		{`\ae\oe\o\aa\l`, "æœøåł"},
+		{`1--3`, "1–3"},
+		{`---`, "—"},
+		{"``quoted''", "“quoted”"},
+		{"`single'", "‘single’"},
+		{"don't", "don’t"},
+		{`hy\-phen`, "hyphen"},
+		{`AT\&T`, "AT&T"},
+		{`\'{}`, "́"},
+		{`\~{w}`, "w̃"}, // no precomposed character
+		{`\unknown`, `\unknown`},
+	}
+	for _, test := range tests {
+		if got := normalize.String(test.in); got != test.want {
+			t.Errorf("String(%q) = %q; want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	src := "Caf\\'e na\\\"{\\i}ve Stra\\ss e, 1--3 ``ok''\nplain \\c{c}a \\newline"
+	fset := token.NewFileSet()
+	file := fset.AddFile("words.tex", fset.Base(), len(src))
+	f, err := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalize.File(f)
+
+	var words []*ast.Word
+	ast.Inspect(f, func(n ast.Node) bool {
+		if w, ok := n.(*ast.Word); ok {
+			words = append(words, w)
+		}
+		return true
+	})
+
+	want := []struct{ lit, raw string }{
+		{"Café", "Caf\\'e"},
+		{"naïve", "na\\\"{\\i}ve"},
+		{"Straße", "Stra\\ss e"},
+		{"1–3", "1--3"},
+		{"“ok”", "``ok''"},
+		{"plain", ""},
+		{"ça", "\\c{c}a"},
+	}
+	if len(words) != len(want) {
+		t.Fatalf("got %d words; want %d", len(words), len(want))
+	}
+	for i, w := range want {
+		got := words[i]
+		if got.Lit != w.lit || got.Raw != w.raw {
+			t.Errorf("word %d: got %q (raw %q); want %q (raw %q)", i, got.Lit, got.Raw, w.lit, w.raw)
+		}
+		// The span still covers the source text.
+		source := w.raw
+		if source == "" {
+			source = w.lit
+		}
+		if s := src[int(got.Pos())-file.Base() : int(got.End())-file.Base()]; s != source {
+			t.Errorf("word %d: span covers %q; want %q", i, s, source)
+		}
+	}
+}
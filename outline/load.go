@@ -0,0 +1,73 @@
+package outline
+
+import (
+	"fmt"
+
+	"github.com/neox5/gotex/loader"
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// A Loader builds the outline of a document spread over several files.
+// It loads the files with a [loader.Loader] and splices the sections of
+// each included file into the outline at the position of the statement
+// including it.
+type Loader struct {
+	Fset *token.FileSet
+
+	// ReadFile reads the named file. If nil, os.ReadFile is used.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// Load returns the outline of the document whose main file is filename.
+// Included files are resolved as described in package loader; a file
+// included twice contributes its sections twice.
+//
+// Files that cannot be read or parsed are reported in a
+// [scanner.ErrorList] sorted by source position; the outline of the
+// remaining files is returned nonetheless. A file including itself,
+// directly or indirectly, is reported as an error.
+func (l *Loader) Load(filename string) ([]*Section, error) {
+	ll := &loader.Loader{Fset: l.Fset, Mode: parser.ImportsOnly, ReadFile: l.ReadFile}
+	doc, err := ll.Load(filename)
+	if doc == nil {
+		return nil, err
+	}
+	ld := &load{Loader: l, active: make(map[*loader.File]bool)}
+	if list, ok := err.(scanner.ErrorList); ok {
+		ld.errors = list
+	}
+	list := ld.file(doc.Main())
+	ld.errors.Sort()
+	return Build(list), ld.errors.Err()
+}
+
+// load is the state of a single call of Load.
+type load struct {
+	*Loader
+	active map[*loader.File]bool // files being outlined, to detect cycles
+	errors scanner.ErrorList
+}
+
+// file returns the flat list of sections of f and the files it includes.
+func (ld *load) file(f *loader.File) []*Section {
+	ld.active[f] = true
+	defer delete(ld.active, f)
+
+	// Merge the sections of the included files into list at the
+	// positions of the statements including them.
+	list := Scan(f.File, f.Src)
+	var merged []*Section
+	for _, inc := range f.Includes {
+		for len(list) > 0 && list[0].Pos < inc.Spec.Pos() {
+			merged, list = append(merged, list[0]), list[1:]
+		}
+		if ld.active[inc.File] {
+			ld.errors.Add(ld.Fset.Position(inc.Spec.Pos()), fmt.Sprintf("file %q includes itself", inc.Spec.Name))
+			continue
+		}
+		merged = append(merged, ld.file(inc.File)...)
+	}
+	return append(merged, list...)
+}
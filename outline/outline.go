@@ -0,0 +1,270 @@
+// Package outline builds the sectioning structure of gotex documents: the
+// tree of \part, \chapter, \section, ... \subparagraph commands with their
+// titles, labels and source ranges.
+//
+// The outline is computed from the token stream, so it does not depend on
+// the full parse of a document. [File] returns the outline of a single
+// source file; a [Loader] follows \input, \include and \import to build the
+// outline of a document spread over several files.
+package outline
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// A Level is the nesting depth of a sectioning command.
+type Level int
+
+const (
+	LevelPart Level = iota
+	LevelChapter
+	LevelSection
+	LevelSubsection
+	LevelSubsubsection
+	LevelParagraph
+	LevelSubparagraph
+)
+
+var levelNames = [...]string{
+	LevelPart:          "part",
+	LevelChapter:       "chapter",
+	LevelSection:       "section",
+	LevelSubsection:    "subsection",
+	LevelSubsubsection: "subsubsection",
+	LevelParagraph:     "paragraph",
+	LevelSubparagraph:  "subparagraph",
+}
+
+// String returns the name of the sectioning command of level l.
+func (l Level) String() string {
+	if 0 <= l && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// LookupLevel returns the level of the sectioning command \name.
+func LookupLevel(name string) (Level, bool) {
+	for l, n := range levelNames {
+		if n == name {
+			return Level(l), true
+		}
+	}
+	return 0, false
+}
+
+// A Section is a node of the outline.
+type Section struct {
+	Level Level
+	Star  bool   // unnumbered variant, like \section*
+	Short string // optional short title for the table of contents, or ""
+	Title string // title with runs of white space collapsed
+	Label string // key of the \label following the title, or ""
+
+	Pos      token.Pos // position of the backslash
+	TitlePos token.Pos // start of the title text
+	TitleEnd token.Pos // end of the title text
+	End      token.Pos // end of the section's content in its file
+
+	Children []*Section
+}
+
+// Cmd returns the sectioning command without backslash, like "section*".
+func (s *Section) Cmd() string {
+	if s.Star {
+		return s.Level.String() + "*"
+	}
+	return s.Level.String()
+}
+
+// File returns the outline of a single source file. The file must have
+// been added to a token.FileSet for src.
+func File(file *token.File, src []byte) []*Section {
+	return Build(Scan(file, src))
+}
+
+// Build nests a list of sections in source order: each section becomes a
+// child of the closest preceding section of a lower level. The Children
+// fields of the sections are overwritten. Build returns the top-level
+// sections.
+func Build(list []*Section) []*Section {
+	var roots []*Section
+	var stack []*Section
+	for _, s := range list {
+		s.Children = nil
+		for len(stack) > 0 && stack[len(stack)-1].Level >= s.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, s)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, s)
+		}
+		stack = append(stack, s)
+	}
+	return roots
+}
+
+// Inspect traverses the outline in depth-first order: it calls f for each
+// section; if f returns true, Inspect continues with its children.
+func Inspect(list []*Section, f func(*Section) bool) {
+	for _, s := range list {
+		if f(s) {
+			Inspect(s.Children, f)
+		}
+	}
+}
+
+// Scan returns the sectioning commands of src in source order, without
+// nesting them. The end of each section is the start of the next section
+// of the same or a lower level in src, or the end of the file. Commands
+// without a title and those inside verbatim environments are ignored.
+func Scan(file *token.File, src []byte) []*Section {
+	sc := &sectionScanner{file: file, src: src}
+	sc.s.Init(nil, file, src, nil) // errors are reported by the parser
+	sc.next()
+
+	var list []*Section
+	for sc.tok != token.EOF {
+		switch {
+		case sc.tok == token.COMMAND:
+			if level, ok := LookupLevel(sc.lit); ok {
+				if s := sc.section(level); s != nil {
+					list = append(list, s)
+				}
+				continue
+			}
+		case sc.tok == token.ENV:
+			sc.begin()
+			continue
+		}
+		sc.next()
+	}
+
+	eof := token.Pos(file.Base() + file.Size())
+	for i, s := range list {
+		s.End = eof
+		for _, next := range list[i+1:] {
+			if next.Level <= s.Level {
+				s.End = next.Pos
+				break
+			}
+		}
+	}
+	return list
+}
+
+// sectionScanner is the token stream of a file with one token lookahead.
+type sectionScanner struct {
+	s    scanner.Scanner
+	file *token.File
+	src  []byte
+
+	pos token.Pos
+	tok token.Token
+	lit string
+}
+
+func (sc *sectionScanner) next() {
+	sc.pos, sc.tok, sc.lit = sc.s.Scan()
+}
+
+// skipSpace skips line breaks and comments; blank lines are allowed, as
+// in LaTeX between a command and its arguments.
+func (sc *sectionScanner) skipSpace() {
+	for sc.tok == token.NEWLINE || sc.tok == token.COMMENT {
+		sc.next()
+	}
+}
+
+// section parses a sectioning command and its arguments. The current
+// token is the command. It returns nil if the command has no title.
+func (sc *sectionScanner) section(level Level) *Section {
+	s := &Section{Level: level, Pos: sc.pos}
+	sc.next()
+	if sc.tok == token.ASTERISK {
+		s.Star = true
+		sc.next()
+	}
+	sc.skipSpace()
+	if sc.tok == token.LBRACK {
+		start, end, _ := sc.group(token.LBRACK, token.RBRACK)
+		s.Short = sc.text(start, end)
+		sc.next()
+		sc.skipSpace()
+	}
+	if sc.tok != token.LBRACE {
+		return nil
+	}
+	s.TitlePos, s.TitleEnd, _ = sc.group(token.LBRACE, token.RBRACE)
+	s.Title = sc.text(s.TitlePos, s.TitleEnd)
+	sc.next()
+
+	sc.skipSpace()
+	if sc.tok == token.COMMAND && sc.lit == "label" {
+		sc.next()
+		if sc.tok == token.LBRACE {
+			start, end, _ := sc.group(token.LBRACE, token.RBRACE)
+			s.Label = sc.text(start, end)
+			sc.next()
+		}
+	}
+	return s
+}
+
+// group advances to the token closing the group opened by the current
+// token and returns the range of its content. If the group is not closed,
+// the content extends to the end of the file and ok is false.
+func (sc *sectionScanner) group(open, close token.Token) (start, end token.Pos, ok bool) {
+	start = sc.pos + 1
+	depth := 0
+	for ; sc.tok != token.EOF; sc.next() {
+		switch sc.tok {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return start, sc.pos, true
+			}
+		}
+	}
+	return start, sc.pos, false
+}
+
+// begin skips \begin{name}, and the body of the environment if it is
+// verbatim.
+func (sc *sectionScanner) begin() {
+	sc.next()
+	if sc.tok != token.LBRACE {
+		return
+	}
+	start, end, ok := sc.group(token.LBRACE, token.RBRACE)
+	if !ok {
+		return
+	}
+	// The current token is the closing brace of the name, so the scanner
+	// is positioned right before the body.
+	if name := sc.text(start, end); isVerbatim(name) {
+		sc.s.ScanRawUntil("\\end{"+name+"}", false)
+	}
+	sc.next()
+}
+
+// text returns the source text in [start, end) with runs of white space
+// collapsed to single spaces.
+func (sc *sectionScanner) text(start, end token.Pos) string {
+	b := sc.file.Base()
+	return strings.Join(strings.Fields(string(sc.src[int(start)-b:int(end)-b])), " ")
+}
+
+func isVerbatim(name string) bool {
+	_, ok := parser.DefaultVerbatimEnvs[name]
+	return ok
+}
@@ -0,0 +1,138 @@
+package outline
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// dump returns an indented listing of the outline.
+func dump(list []*Section) string {
+	var b strings.Builder
+	var walk func([]*Section, string)
+	walk = func(list []*Section, indent string) {
+		for _, s := range list {
+			fmt.Fprintf(&b, "%s\\%s", indent, s.Cmd())
+			if s.Short != "" {
+				fmt.Fprintf(&b, "[%s]", s.Short)
+			}
+			fmt.Fprintf(&b, "{%s}", s.Title)
+			if s.Label != "" {
+				fmt.Fprintf(&b, " label=%s", s.Label)
+			}
+			b.WriteByte('\n')
+			walk(s.Children, indent+"  ")
+		}
+	}
+	walk(list, "")
+	return b.String()
+}
+
+const src = `\documentclass{book}
+\part{Basics}
+\chapter[Intro]{Introduction to
+  \emph{gotex}}
+\label{ch:intro}
+\section{Motivation}
+% \section{Commented out}
+\subsection*{History}
+\begin{verbatim}
+\section{Not a section}
+\end{verbatim}
+\section{Goals}\label{sec:goals}
+\paragraph{Aside}
+\chapter{Syntax}
+\section
+`
+
+func TestFile(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("book.tex", fset.Base(), len(src))
+	list := File(file, []byte(src))
+
+	want := `\part{Basics}
+  \chapter[Intro]{Introduction to \emph{gotex}} label=ch:intro
+    \section{Motivation}
+      \subsection*{History}
+    \section{Goals} label=sec:goals
+      \paragraph{Aside}
+  \chapter{Syntax}
+`
+	if got := dump(list); got != want {
+		t.Errorf("got outline:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Ranges: a section ends where the next one of the same or a lower
+	// level starts; the last ones end at the end of the file.
+	offs := func(p token.Pos) int { return int(p) - file.Base() }
+	intro := list[0].Children[0]
+	if got := src[offs(intro.Pos):offs(intro.End)]; !strings.HasPrefix(got, `\chapter[Intro]`) || !strings.HasSuffix(got, "\\paragraph{Aside}\n") {
+		t.Errorf("got chapter range %q", got)
+	}
+	if got := src[offs(intro.TitlePos):offs(intro.TitleEnd)]; got != "Introduction to\n  \\emph{gotex}" {
+		t.Errorf("got title range %q", got)
+	}
+	if part := list[0]; offs(part.End) != len(src) {
+		t.Errorf("part ends at %d; want %d", offs(part.End), len(src))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := filepath.FromSlash("/doc")
+	files := map[string]string{
+		"main.tex": `\chapter{One}
+\input{chapters/two}
+\chapter{Three}
+\include{missing}
+\input{main}
+`,
+		"chapters/two.tex": `\section{One.A}
+\chapter{Two}
+\section{Two.A}
+`,
+	}
+	l := &Loader{
+		Fset: token.NewFileSet(),
+		ReadFile: func(name string) ([]byte, error) {
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			if data, ok := files[filepath.ToSlash(rel)]; ok {
+				return []byte(data), nil
+			}
+			return nil, fs.ErrNotExist
+		},
+	}
+	list, err := l.Load(filepath.Join(dir, "main.tex"))
+
+	want := `\chapter{One}
+  \section{One.A}
+\chapter{Two}
+  \section{Two.A}
+\chapter{Three}
+`
+	if got := dump(list); got != want {
+		t.Errorf("got outline:\n%s\nwant:\n%s", got, want)
+	}
+
+	errs, ok := err.(scanner.ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("got errors %v; want 2", err)
+	}
+	for i, msg := range []string{`cannot find file "missing"`, `file "main" includes itself`} {
+		if errs[i].Msg != msg || errs[i].Pos.Line != i+4 {
+			t.Errorf("error %d: got %s; want line %d: %s", i, errs[i], i+4, msg)
+		}
+	}
+
+	// Sections of included files have positions in their own file.
+	if got := l.Fset.Position(list[1].Pos).Filename; got != filepath.Join(dir, "chapters", "two.tex") {
+		t.Errorf("got file %q for chapter Two", got)
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"unicode/utf8"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/token"
+)
+
+// lookupCommand returns the signature of the command name: that of a
+// document command defined in the file, or that of the registry.
+func (p *parser) lookupCommand(name string) *command.Signature {
+	if sig, ok := p.signatures[name]; ok {
+		return sig
+	}
+	return p.commands.Lookup(name)
+}
+
+// parseCommand parses a command with the signature sig and its arguments.
+// An omitted optional argument is recorded as not present; a missing
+// mandatory argument is reported.
+func (p *parser) parseCommand(sig *command.Signature) *ast.Command {
+	c := &ast.Command{Name: p.lit, Pos_: p.pos, End_: p.end}
+	p.next() // consume command
+
+	for _, param := range sig.Spec() {
+		var arg *ast.Arg
+		switch param.Type {
+		case 's', 't':
+			arg = p.parseTokenArg(param)
+		case 'o', 'O', 'd', 'D', 'r', 'R':
+			arg = p.parseDelimitedArg(param)
+		case 'v':
+			arg = p.parseVerbatimArg(sig.Name)
+		default:
+			arg = p.parseMandatoryArg(sig)
+		}
+		arg.Kind = param.Type
+		if arg.Present {
+			c.End_ = arg.End_
+		} else {
+			if param.HasDefault() {
+				arg.Lit = param.Default
+			}
+			if !param.Optional() {
+				p.error(arg.Pos_, "missing argument of \\"+c.Name)
+			}
+		}
+		c.Args = append(c.Args, arg)
+	}
+	return c
+}
+
+// at reports whether the source text of the current token is s.
+func (p *parser) at(s string) bool {
+	return p.tok != token.EOF && p.text(p.pos, p.end) == s
+}
+
+// parseTokenArg parses an optional star or the token of a t argument.
+func (p *parser) parseTokenArg(param command.Param) *ast.Arg {
+	arg := &ast.Arg{Pos_: p.pos, End_: p.pos}
+	tok := param.Open
+	if param.Type == 's' {
+		tok = "*"
+	}
+	if p.at(tok) {
+		arg.Present = true
+		arg.LitPos, arg.End_ = p.end, p.end
+		p.next()
+	}
+	return arg
+}
+
+// parseDelimitedArg parses an argument between the delimiters of param,
+// like [...] for an optional argument. If the delimiters differ, nested
+// pairs are balanced as in xparse.
+func (p *parser) parseDelimitedArg(param command.Param) *ast.Arg {
+	arg := &ast.Arg{Pos_: p.pos, End_: p.pos}
+	if !p.at(param.Open) {
+		return arg
+	}
+	open := p.pos
+	start := p.end
+	depth, nested := 0, 0
+	for p.next(); p.tok != token.EOF; p.next() {
+		switch {
+		case p.tok == token.LBRACE:
+			depth++
+		case p.tok == token.RBRACE:
+			depth--
+		case depth > 0:
+		case p.at(param.Close) && nested == 0:
+			arg.Present = true
+			arg.Lit, arg.LitPos, arg.End_ = p.text(start, p.pos), start, p.end
+			p.next() // consume closing delimiter
+			return arg
+		case p.at(param.Close):
+			nested--
+		case p.at(param.Open):
+			nested++
+		}
+	}
+	p.error(open, "expected '"+param.Close+"' to close argument")
+	return arg
+}
+
+// parseMandatoryArg parses a group or, like TeX, a single token. Unlike
+// in TeX, a token may be a whole word or number, so \frac12 takes 12 as
+// its first argument. The content of a group is read verbatim if the
+// signature says so, so that characters like % and # in a URL are kept.
+func (p *parser) parseMandatoryArg(sig *command.Signature) *ast.Arg {
+	p.skipSpace()
+	arg := &ast.Arg{Pos_: p.pos, End_: p.pos}
+	switch {
+	case p.tok == token.EOF || p.tok == token.RBRACE || p.atParBreak():
+		return arg
+	case p.tok == token.LBRACE && sig.Verbatim:
+		p.parseVerbatimGroup(arg, sig.Name)
+	case p.tok == token.LBRACE:
+		arg.Present = true
+		if !p.parseArgBody(arg) {
+			p.error(arg.Pos_, "missing '}' to close argument of \\"+sig.Name)
+		}
+	default:
+		arg.Present = true
+		arg.Lit, arg.LitPos, arg.End_ = p.text(p.pos, p.end), p.pos, p.end
+		p.next()
+	}
+	return arg
+}
+
+// parseArgBody parses the content of the group starting at the current
+// brace into arg.Body and sets the text and end of arg. Braces that do
+// not belong to a command group the content without ending it; a blank
+// line does not end it either. It reports false if the group is not
+// closed; the content then extends to the end of the file.
+func (p *parser) parseArgBody(arg *ast.Arg) bool {
+	arg.LitPos = p.end
+	p.next() // consume {
+	depth := 0
+	for p.tok != token.EOF {
+		switch {
+		case p.tok == token.LBRACE:
+			depth++
+			p.next()
+		case p.tok == token.RBRACE && depth == 0:
+			arg.Lit, arg.End_ = p.text(arg.LitPos, p.pos), p.end
+			p.next() // consume }
+			return true
+		case p.tok == token.RBRACE:
+			depth--
+			p.next()
+		case p.atParBreak():
+			p.next()
+		default:
+			arg.Body = p.parseElement(arg.Body)
+		}
+	}
+	arg.Lit, arg.End_ = p.text(arg.LitPos, p.pos), p.pos
+	return false
+}
+
+// parseVerbatimArg parses a v argument: text read verbatim between braces
+// or between two equal characters on the same line, as in \verb.
+func (p *parser) parseVerbatimArg(name string) *ast.Arg {
+	arg := &ast.Arg{Pos_: p.pos, End_: p.pos}
+	if p.tok == token.LBRACE {
+		p.parseVerbatimGroup(arg, name)
+		return arg
+	}
+	delim := p.text(p.pos, p.end)
+	if p.tok == token.EOF || p.tok == token.NEWLINE || utf8.RuneCountInString(delim) != 1 {
+		return arg // reported as missing
+	}
+
+	// The scanner is positioned right after the delimiter.
+	pos, lit, found := p.s.ScanRawUntil(delim, true)
+	arg.Present = true
+	arg.Lit, arg.LitPos = lit, pos
+	arg.End_ = pos + token.Pos(len(lit))
+	if found {
+		arg.End_ += token.Pos(len(delim))
+	} else {
+		p.error(arg.Pos_, "verbatim argument of \\"+name+" not terminated before end of line")
+	}
+	p.next()
+	return arg
+}
+
+// parseVerbatimGroup reads the content of the group starting at the
+// current brace verbatim, up to the next closing brace.
+func (p *parser) parseVerbatimGroup(arg *ast.Arg, name string) {
+	// The scanner is positioned right after the brace.
+	pos, lit, found := p.s.ScanRawUntil("}", false)
+	p.s.Catcodes().Pop() // the group opened by the brace ends here
+	arg.Present = true
+	arg.Lit, arg.LitPos = lit, pos
+	arg.End_ = pos + token.Pos(len(lit))
+	if found {
+		arg.End_++
+	} else {
+		p.error(arg.Pos_, "missing '}' to close argument of \\"+name)
+	}
+	p.next()
+}
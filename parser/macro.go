@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"strconv"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+// macroDefs lists the commands defining macros.
+var macroDefs = map[string]bool{
+	"newcommand":           true,
+	"renewcommand":         true,
+	"providecommand":       true,
+	"DeclareRobustCommand": true,
+	"def":                  true,
+	"gdef":                 true,
+	"edef":                 true,
+	"xdef":                 true,
+
+	"NewDocumentCommand":     true,
+	"RenewDocumentCommand":   true,
+	"ProvideDocumentCommand": true,
+	"DeclareDocumentCommand": true,
+}
+
+// isMacroDef reports whether the current token defines a macro.
+func (p *parser) isMacroDef() bool {
+	return p.tok == token.COMMAND && macroDefs[p.lit]
+}
+
+// parseMacroDef parses a macro definition and adds it to the symbol table.
+// It returns nil if the definition is malformed.
+func (p *parser) parseMacroDef() *ast.MacroDef {
+	d := &ast.MacroDef{Cmd: p.lit, Pos_: p.pos}
+	p.next() // consume \newcommand
+
+	var ok bool
+	switch {
+	case d.IsDef():
+		ok = p.parseDefHead(d)
+	case d.IsDocumentCommand():
+		ok = p.parseDocumentCommandHead(d)
+	default:
+		ok = p.parseNewcommandHead(d)
+	}
+	if !ok || !p.parseMacroBody(d) {
+		return nil
+	}
+
+	if _, defined := p.macros[d.Name]; defined && d.Provides() {
+		return d
+	}
+	if p.macros == nil {
+		p.macros = make(map[string]*ast.MacroDef)
+	}
+	p.macros[d.Name] = d
+
+	// Uses of document commands are parsed according to their
+	// specification; other macros are left to the expander.
+	if d.IsDocumentCommand() {
+		if p.signatures == nil {
+			p.signatures = make(map[string]*command.Signature)
+		}
+		p.signatures[d.Name] = &command.Signature{Name: d.Name, Args: d.Spec, Mode: command.AnyMode}
+	} else {
+		delete(p.signatures, d.Name)
+	}
+	return d
+}
+
+// parseNewcommandHead parses the part of \newcommand*{\name}[n][default]
+// preceding the body.
+func (p *parser) parseNewcommandHead(d *ast.MacroDef) bool {
+	if p.tok == token.ASTERISK {
+		d.Star = true
+		p.next()
+	}
+	p.skipSpace()
+	if !p.parseDefinedName(d) {
+		return false
+	}
+	p.skipSpace()
+
+	if p.tok == token.LBRACK {
+		p.next()
+		n, err := strconv.Atoi(p.lit)
+		if p.tok != token.NUMBER || err != nil || n < 0 || n > 9 {
+			p.error(p.pos, "expected number of arguments between 0 and 9")
+			return false
+		}
+		d.NArgs = n
+		p.next()
+		if p.tok != token.RBRACK {
+			p.error(p.pos, "expected ']' after number of arguments")
+			return false
+		}
+		p.next()
+		p.skipSpace()
+
+		if p.tok == token.LBRACK {
+			pos, def, ok := p.parseBracketed()
+			if !ok {
+				return false
+			}
+			d.Default, d.DefaultPos = &def, pos
+			p.skipSpace()
+		}
+	}
+	return true
+}
+
+// parseDefHead parses the part of \def\name<parameter text> preceding the
+// body. The parameter text is the source up to the opening brace; its
+// parameters #1, #2, ... must be numbered consecutively.
+func (p *parser) parseDefHead(d *ast.MacroDef) bool {
+	if !p.parseMacroName(d) {
+		return false
+	}
+
+	start := p.pos
+	for p.tok != token.LBRACE && p.tok != token.EOF {
+		if p.tok == token.HASH {
+			hash := p.pos
+			p.next()
+			if p.tok != token.NUMBER || p.pos != hash+1 {
+				p.error(hash, "expected parameter number after '#'")
+				return false
+			}
+			// TeX takes a single digit; the rest of a number delimits.
+			if n := int(p.lit[0] - '0'); n != d.NArgs+1 {
+				p.error(hash, "parameters must be numbered consecutively")
+				return false
+			}
+			d.NArgs++
+		}
+		p.next()
+	}
+	d.Params = p.text(start, p.pos)
+	return true
+}
+
+// parseMacroName parses the name of the macro being defined.
+func (p *parser) parseMacroName(d *ast.MacroDef) bool {
+	switch p.tok {
+	case token.COMMAND, token.IMPORT, token.ENV, token.ENVEND, token.CONTROL_SYMBOL:
+		d.Name, d.NamePos = p.lit, p.pos
+		p.next()
+		return true
+	}
+	p.error(p.pos, "expected macro name after \\"+d.Cmd)
+	return false
+}
+
+// parseDefinedName parses the name of the macro defined by \newcommand
+// and its variants, which may be braced: \newcommand{\name} or
+// \newcommand\name.
+func (p *parser) parseDefinedName(d *ast.MacroDef) bool {
+	braced := p.tok == token.LBRACE
+	if braced {
+		p.next()
+		p.skipSpace()
+	}
+	if !p.parseMacroName(d) {
+		return false
+	}
+	if braced {
+		p.skipSpace()
+		if p.tok != token.RBRACE {
+			p.error(p.pos, "expected '}' after macro name")
+			return false
+		}
+		p.next()
+	}
+	return true
+}
+
+// parseDocumentCommandHead parses the part of
+// \NewDocumentCommand{\name}{spec} preceding the body.
+func (p *parser) parseDocumentCommandHead(d *ast.MacroDef) bool {
+	p.skipSpace()
+	if !p.parseDefinedName(d) {
+		return false
+	}
+	p.skipSpace()
+	if p.tok != token.LBRACE {
+		p.error(p.pos, "expected argument specification of \\"+d.Name)
+		return false
+	}
+	var ok bool
+	d.SpecPos, d.Spec, _, ok = p.parseGroup()
+	if !ok {
+		p.error(d.SpecPos, "missing '}' to close argument specification of \\"+d.Name)
+		return false
+	}
+	spec, err := command.ParseSpec(d.Spec)
+	if err != nil {
+		p.error(d.SpecPos, err.Error())
+		return false
+	}
+	d.NArgs = len(spec)
+	p.skipSpace()
+	return true
+}
+
+// parseMacroBody parses the braced replacement text of a definition.
+func (p *parser) parseMacroBody(d *ast.MacroDef) bool {
+	if p.tok != token.LBRACE {
+		p.error(p.pos, "expected '{' to start the body of \\"+d.Name)
+		return false
+	}
+	var ok bool
+	d.BodyPos, d.Body, d.End_, ok = p.parseGroup()
+	if !ok {
+		p.error(d.Pos_, "missing '}' to close the body of \\"+d.Name)
+	}
+	return ok
+}
+
+// parseGroup parses a brace group and returns the position and text of
+// its content and the end of the group. It reports false if the group is
+// not closed; the content then extends to the end of the file.
+//
+// Like TeX, which stores the body of a definition as tokens, the content
+// changes no category codes: a \makeatletter in it takes effect when the
+// macro is used, not when it is defined.
+func (p *parser) parseGroup() (token.Pos, string, token.Pos, bool) {
+	start := p.end
+	depth := 0
+	p.s.SetMode(0)
+	for ; p.tok != token.EOF; p.next() {
+		switch p.tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		}
+		if depth == 0 {
+			text, end := p.text(start, p.pos), p.end
+			p.s.SetMode(scanner.TrackCatcodes)
+			p.s.Catcodes().Pop() // the group opened by the brace ends here
+			p.next()             // consume }
+			return start, text, end, true
+		}
+	}
+	p.s.SetMode(scanner.TrackCatcodes)
+	return start, p.text(start, p.pos), p.pos, false
+}
+
+// parseBracketed parses an optional argument [...] and returns its text
+// and position. Brackets inside braces do not close the argument.
+func (p *parser) parseBracketed() (token.Pos, string, bool) {
+	open := p.pos
+	start := p.end
+	depth := 0
+	for p.next(); p.tok != token.EOF; p.next() {
+		switch p.tok {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		case token.RBRACK:
+			if depth == 0 {
+				text := p.text(start, p.pos)
+				p.next() // consume ]
+				return start, text, true
+			}
+		}
+	}
+	p.error(open, "expected ']' to close optional argument")
+	return token.NoPos, "", false
+}
+
+// skipSpace skips line breaks and comments between the parts of a command.
+// A blank line is not skipped.
+func (p *parser) skipSpace() {
+	for {
+		switch {
+		case p.tok == token.COMMENT, p.tok == token.NEWLINE && !p.atParBreak():
+			p.next()
+		default:
+			return
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
 	"github.com/neox5/gotex/token"
 )
 
@@ -11,21 +12,72 @@ import (
 type Mode uint
 
 const (
-	ImportsOnly Mode = 1 << iota // Only parse \import statements
+	ImportsOnly Mode = 1 << iota // Only parse \import, \input, \include and \usemodule statements
 	ParseFull                    // Future: parse full syntax tree
 )
 
+// DefaultVerbatimEnvs lists the environments whose body is taken literally
+// unless a [Config] specifies otherwise. See [Config.VerbatimEnvs].
+var DefaultVerbatimEnvs = map[string]string{
+	"verbatim":   "",
+	"verbatim*":  "",
+	"Verbatim":   "o",  // fancyvrb: \begin{Verbatim}[options]
+	"lstlisting": "o",  // listings: \begin{lstlisting}[options]
+	"minted":     "om", // minted: \begin{minted}[options]{language}
+	"comment":    "",
+}
+
+// defaultCommands is the registry used if Config.Commands is nil.
+var defaultCommands = command.Default()
+
+// A Config controls parsing.
+type Config struct {
+	Mode Mode // parsing mode
+
+	// VerbatimEnvs maps the names of environments whose body is taken
+	// literally to the arguments following \begin{name}: one letter per
+	// argument, 'o' for an optional [...] and 'm' for a mandatory {...}
+	// argument. If nil, DefaultVerbatimEnvs is used.
+	VerbatimEnvs map[string]string
+
+	// Commands holds the signatures of the commands whose arguments are
+	// parsed in ParseFull mode. If nil, command.Default() is used.
+	Commands *command.Registry
+}
+
 // Parse parses the given source into a syntax tree depending on the mode.
 // The source must be valid UTF-8. The caller must provide a token.FileSet and associated token.File.
+//
+// If syntax errors were found, the result is a partial AST together with a
+// [scanner.ErrorList] sorted by source position.
 func Parse(fset *token.FileSet, file *token.File, src []byte, mode Mode) (*ast.File, error) {
+	cfg := Config{Mode: mode}
+	return cfg.Parse(fset, file, src)
+}
+
+// Parse is like the package-level [Parse] function, but uses the settings
+// of cfg.
+func (cfg *Config) Parse(fset *token.FileSet, file *token.File, src []byte) (*ast.File, error) {
 	p := newParser(fset, file, src)
+	p.verbatimEnvs = cfg.VerbatimEnvs
+	if p.verbatimEnvs == nil {
+		p.verbatimEnvs = DefaultVerbatimEnvs
+	}
+	p.commands = cfg.Commands
+	if p.commands == nil {
+		p.commands = defaultCommands
+	}
 
-	switch {
+	var f *ast.File
+	switch mode := cfg.Mode; {
 	case mode&ImportsOnly != 0:
-		return p.parseImportsOnly(), nil
+		f = p.parseImportsOnly()
 	case mode&ParseFull != 0:
-		return p.parseFull(), nil
+		f = p.parseFull()
 	default:
 		return nil, errors.New("unsupported parse mode")
 	}
+
+	p.errors.Sort()
+	return f, p.errors.Err()
 }
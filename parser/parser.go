@@ -1,35 +1,116 @@
 package parser
 
 import (
+	"strings"
+	"unicode/utf8"
+
 	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/normalize"
 	"github.com/neox5/gotex/scanner"
 	"github.com/neox5/gotex/token"
 )
 
 type parser struct {
-	s    *scanner.Scanner
-	fset *token.FileSet
-	file *token.File
+	s      *scanner.Scanner
+	fset   *token.FileSet
+	file   *token.File
+	src    []byte
+	errors scanner.ErrorList
+
+	verbatimEnvs map[string]string // see Config.VerbatimEnvs
+	directives   []*ast.Directive
+	macros       map[string]*ast.MacroDef      // see ast.File.Macros
+	commands     *command.Registry             // see Config.Commands
+	signatures   map[string]*command.Signature // document commands defined so far
+	imports      []*ast.ImportSpec             // imports found in full mode
+
+	// Comments
+	comments     []*ast.CommentGroup
+	comment      *ast.Comment // the current token, if it is a comment
+	sinceComment int          // number of tokens scanned since the last comment
 
 	tok token.Token
 	lit string
 	pos token.Pos
+	end token.Pos // end of the current token
+
+	prev token.Token // previous token
 }
 
 func newParser(fset *token.FileSet, file *token.File, src []byte) *parser {
 	var scan scanner.Scanner
-	scan.Init(fset, file, src, nil)
 	p := &parser{
 		s:    &scan,
 		fset: fset,
 		file: file,
+		src:  src,
 	}
+	scan.Init(fset, file, src, p.errors.Add)
+	scan.SetMode(scanner.TrackCatcodes)
 	p.next()
 	return p
 }
 
+// text returns the source text between start and end.
+func (p *parser) text(start, end token.Pos) string {
+	base := token.Pos(p.file.Base())
+	return string(p.src[start-base : end-base])
+}
+
+// error records a parse error at position pos.
+func (p *parser) error(pos token.Pos, msg string) {
+	p.errors.Add(p.fset.Position(pos), msg)
+}
+
+// isImport reports whether the current token starts an import statement.
+// Besides the \import keyword, the commands \input, \include and
+// \usemodule declare dependencies.
+func (p *parser) isImport() bool {
+	switch p.tok {
+	case token.IMPORT:
+		return true
+	case token.COMMAND:
+		switch p.lit {
+		case "input", "include", "usemodule":
+			return true
+		}
+	}
+	return false
+}
+
 func (p *parser) next() {
+	p.prev = p.tok
 	p.pos, p.tok, p.lit = p.s.Scan()
+	p.end = p.s.Pos()
+	p.sinceComment++
+	if p.tok == token.COMMENT {
+		p.recordComment()
+	}
+}
+
+// recordComment adds the current token, a comment, to the comment groups
+// and directives of the file. Comments are recorded as they are scanned,
+// so that those skipped inside arguments and groups are not lost.
+func (p *parser) recordComment() {
+	p.comment = &ast.Comment{
+		Lit:  p.lit,
+		Pos_: p.pos,
+		End_: p.pos + token.Pos(len(p.lit)),
+	}
+	if d := parseDirective(p.comment); d != nil {
+		p.directives = append(p.directives, d)
+	}
+
+	// A comment continues the current group if only the line break after
+	// the previous comment lies between them: the comment itself and the
+	// NEWLINE were scanned since.
+	if n := len(p.comments); n > 0 && p.sinceComment == 2 {
+		p.comments[n-1].List = append(p.comments[n-1].List, p.comment)
+	} else {
+		p.comments = append(p.comments, &ast.CommentGroup{List: []*ast.Comment{p.comment}})
+	}
+	p.sinceComment = 0
 }
 
 func (p *parser) parseFull() *ast.File {
@@ -37,55 +118,147 @@ func (p *parser) parseFull() *ast.File {
 	start := p.pos
 
 	for p.tok != token.EOF {
-		switch p.tok {
-		case token.COMMENT:
-			comment := p.parseComment()
-			nodes = append(nodes, comment)
-			if p.tok == token.NEWLINE {
-				nodes = append(nodes, &ast.Newline{
-					Pos_: p.pos,
-					End_: p.pos + 1,
-				})
-				p.next()
+		switch {
+		case p.tok == token.COMMENT:
+			nodes = p.parseCommentLine(nodes)
+		case p.tok == token.NEWLINE:
+			// Blank lines between paragraphs
+			nodes = append(nodes, p.parseNewline())
+		case p.isMacroDef():
+			// Definitions do not start a paragraph.
+			if d := p.parseMacroDef(); d != nil {
+				nodes = append(nodes, d)
 			}
-		case token.NEWLINE:
-			text := p.parseText() // treat as part of text
-			nodes = append(nodes, text)
-		case token.COMMAND:
-			if p.lit == "newline" {
-				text := p.parseText() // same, groupable
-				nodes = append(nodes, text)
-			} else {
-				// TODO: dispatch to command handling
-				p.next()
-			}
-		case token.WORD:
-			text := p.parseText()
-			nodes = append(nodes, text)
 		default:
-			p.next() // skip unknown or unexpected tokens
+			if par := p.parseParagraph(); par != nil {
+				nodes = append(nodes, par)
+			}
 		}
 	}
 
 	return &ast.File{
-		Filename: p.file.Name(),
-		Imports:  nil, // Not collected in full mode
-		Body:     nodes,
-		Pos_:     start,
-		End_:     p.pos,
+		Filename:   p.file.Name(),
+		Imports:    p.imports,
+		Directives: p.directives,
+		Comments:   p.comments,
+		Macros:     p.macros,
+		Body:       nodes,
+		Newline:    p.s.Newline(),
+		Pos_:       start,
+		End_:       p.pos,
+	}
+}
+
+// atParBreak reports whether the current token ends a paragraph: a blank
+// line (a NEWLINE directly following another one) or \par.
+func (p *parser) atParBreak() bool {
+	return p.tok == token.NEWLINE && p.prev == token.NEWLINE ||
+		p.tok == token.COMMAND && p.lit == "par"
+}
+
+// parseParagraph parses the content up to the next paragraph break. The
+// \par ending a paragraph belongs to it; a blank line does not. It returns
+// nil if the paragraph has no content, e.g. if it only consists of
+// commands that are not parsed yet.
+func (p *parser) parseParagraph() *ast.Paragraph {
+	par := &ast.Paragraph{Pos_: p.pos}
+
+	for p.tok != token.EOF && !p.atParBreak() {
+		par.Body = p.parseElement(par.Body)
+	}
+
+	par.End_ = p.pos
+	if p.tok == token.COMMAND && p.lit == "par" {
+		par.Par = p.pos
+		par.End_ = p.end
+		p.next()
+	}
+	if len(par.Body) == 0 {
+		return nil
 	}
+	return par
+}
+
+// parseElement parses the node starting at the current token, if any, and
+// appends it to list. Tokens that do not start a node are skipped.
+func (p *parser) parseElement(list []ast.Node) []ast.Node {
+	switch p.tok {
+	case token.COMMENT:
+		list = p.parseCommentLine(list)
+	case token.NEWLINE:
+		list = append(list, p.parseText()) // treat as part of text
+	case token.ENV:
+		if n := p.parseBegin(); n != nil {
+			list = append(list, n)
+		}
+	case token.ENVEND:
+		if n := p.parseEnd(); n != nil {
+			list = append(list, n)
+		}
+	case token.IMPORT:
+		if imp := p.parseImport(); imp != nil {
+			list = append(list, imp)
+		}
+	case token.COMMAND:
+		if p.isImport() {
+			if imp := p.parseImport(); imp != nil {
+				list = append(list, imp)
+			}
+		} else if p.lit == "newline" || p.lit == "verb" || p.atWord() {
+			list = append(list, p.parseText()) // same, groupable
+		} else if p.isMacroDef() {
+			if d := p.parseMacroDef(); d != nil {
+				list = append(list, d)
+			}
+		} else if sig := p.lookupCommand(p.lit); sig != nil {
+			list = append(list, p.parseCommand(sig))
+		} else {
+			// TODO: dispatch to command handling
+			p.next()
+		}
+	case token.WORD, token.NUMBER, token.DASH, token.QUOTE, token.BACKQUOTE:
+		list = append(list, p.parseText())
+	case token.CONTROL_SYMBOL:
+		list = append(list, p.parseText())
+	default:
+		p.next() // skip unknown or unexpected tokens
+	}
+	return list
+}
+
+// parseCommentLine parses a comment and the line break ending it, and
+// appends them to list.
+func (p *parser) parseCommentLine(list []ast.Node) []ast.Node {
+	list = append(list, p.parseComment())
+	if p.tok == token.NEWLINE {
+		list = append(list, p.parseNewline())
+	}
+	return list
+}
+
+func (p *parser) parseNewline() *ast.Newline {
+	n := &ast.Newline{Pos_: p.pos, End_: p.end}
+	p.next()
+	return n
 }
 
 func (p *parser) parseImportsOnly() *ast.File {
 	var imports []*ast.ImportSpec
 
 	for p.tok != token.EOF {
-		if p.tok == token.IMPORT {
+		switch {
+		case p.isImport():
 			imp := p.parseImportSpec()
 			if imp != nil {
 				imports = append(imports, imp)
 			}
-		} else {
+		case p.tok == token.ENV:
+			p.parseBegin() // skip verbatim bodies
+		case p.tok == token.COMMAND && p.lit == "verb":
+			p.parseVerb()
+		case p.tok == token.COMMENT:
+			p.parseComment() // collects directives
+		default:
 			p.next() // skip other tokens
 		}
 	}
@@ -94,36 +267,61 @@ func (p *parser) parseImportsOnly() *ast.File {
 	end := p.pos
 
 	return &ast.File{
-		Filename: p.file.Name(),
-		Imports:  imports,
-		Pos_:     start,
-		End_:     end,
+		Filename:   p.file.Name(),
+		Imports:    imports,
+		Directives: p.directives,
+		Comments:   p.comments,
+		Newline:    p.s.Newline(),
+		Pos_:       start,
+		End_:       end,
+	}
+}
+
+// parseImport parses an import statement in full mode, where it is both
+// a node of the paragraph and an entry of File.Imports.
+func (p *parser) parseImport() *ast.ImportSpec {
+	imp := p.parseImportSpec()
+	if imp != nil {
+		p.imports = append(p.imports, imp)
 	}
+	return imp
 }
 
 func (p *parser) parseImportSpec() *ast.ImportSpec {
 	start := p.pos
 	cmdTok := p.tok
+	cmdLit := p.lit
 	p.next() // consume \import
 
 	if p.tok != token.LBRACE {
-		// Incomplete import, skip
+		p.error(start, "expected '{' after \\"+cmdLit)
 		return nil
 	}
 	p.next() // consume {
 
+	// The name is the concatenation of all tokens up to the closing brace,
+	// so that paths like "chapters/intro.tex" survive tokenization. As in
+	// TeX, a comment also hides the line break ending it.
 	var name string
-	if p.tok == token.WORD || p.tok == token.COMMAND {
-		name = p.lit
-		p.next()
-		if p.tok == token.NUMBER {
-			name += p.lit
+loop:
+	for {
+		switch p.tok {
+		case token.RBRACE, token.LBRACE, token.NEWLINE, token.EOF:
+			break loop
+		case token.COMMENT:
 			p.next()
+			if p.tok == token.NEWLINE {
+				p.next()
+			}
+			continue
+		default:
+			name += p.lit
 		}
+		p.next()
 	}
 
 	if p.tok != token.RBRACE {
-		// Malformed import
+		p.error(p.pos, "expected '}' to close \\"+cmdLit)
 		return nil
 	}
 	end := p.pos
@@ -131,22 +329,71 @@ func (p *parser) parseImportSpec() *ast.ImportSpec {
 
 	return &ast.ImportSpec{
 		Token: cmdTok,
+		Cmd:   cmdLit,
 		Name:  name,
 		Pos_:  start,
 		End_:  end + 1,
 	}
 }
 
+// parseComment returns the current token, a comment recorded when it was
+// scanned, as a node.
 func (p *parser) parseComment() *ast.Comment {
-	comment := &ast.Comment{
-		Lit:  p.lit,
-		Pos_: p.pos,
-		End_: p.pos + token.Pos(len(p.lit)),
-	}
+	comment := p.comment
 	p.next()
 	return comment
 }
 
+// parseDirective returns the directive in comment c, or nil if c is an
+// ordinary comment. Directives have the forms
+//
+//	% !TEX key = value
+//	%gotex:key value
+//
+// where the space before !TEX is optional and TEX may be in any case.
+func parseDirective(c *ast.Comment) *ast.Directive {
+	text := c.Lit[1:] // strip %
+	d := &ast.Directive{Pos_: c.Pos_, End_: c.End_}
+
+	if rest, ok := strings.CutPrefix(text, "gotex:"); ok {
+		key, value, _ := strings.Cut(rest, " ")
+		d.Key, d.Value = key, strings.TrimSpace(value)
+		switch key {
+		case "ignore", "ignore-file":
+			d.Kind = ast.GotexIgnore
+		case "module":
+			d.Kind = ast.GotexModule
+		case "":
+			return nil
+		default:
+			d.Kind = ast.GotexOther
+		}
+		return d
+	}
+
+	text = strings.TrimLeft(text, " \t")
+	if len(text) < 4 || !strings.EqualFold(text[:4], "!TEX") {
+		return nil
+	}
+	key, value, ok := strings.Cut(text[4:], "=")
+	if !ok {
+		return nil
+	}
+	d.Key = strings.ToLower(strings.TrimSpace(key))
+	d.Value = strings.TrimSpace(value)
+	switch d.Key {
+	case "root":
+		d.Kind = ast.TeXRoot
+	case "program", "ts-program":
+		d.Kind = ast.TeXProgram
+	case "":
+		return nil
+	default:
+		d.Kind = ast.TeXMagic
+	}
+	return d
+}
+
 func (p *parser) parseText() *ast.TextBlock {
 	var content []ast.TextNode
 	start := p.pos
@@ -154,36 +401,43 @@ func (p *parser) parseText() *ast.TextBlock {
 loop:
 	for p.tok != token.EOF {
 		switch p.tok {
-		case token.WORD:
-			node := &ast.Word{
-				Lit:  p.lit,
-				Pos_: p.pos,
-				End_: p.pos + token.Pos(len(p.lit)),
-			}
-			content = append(content, node)
-			p.next()
+		case token.WORD, token.NUMBER, token.DASH, token.QUOTE, token.BACKQUOTE:
+			content = append(content, p.parseWord())
 
 		case token.NEWLINE:
-			node := &ast.Newline{
-				Pos_: p.pos,
-				End_: p.pos + 1,
+			if p.atParBreak() {
+				break loop
 			}
-			content = append(content, node)
-			p.next()
+			content = append(content, p.parseNewline())
 
 		case token.COMMAND:
 			if p.lit == "newline" {
 				node := &ast.LineBreak{
 					Kind: "newline",
 					Pos_: p.pos,
-					End_: p.pos + token.Pos(len(p.lit)),
+					End_: p.pos + token.Pos(1+len(p.lit)),
 				}
 				content = append(content, node)
 				p.next()
+			} else if p.lit == "verb" {
+				content = append(content, p.parseVerb())
+			} else if p.atWord() {
+				content = append(content, p.parseWord())
 			} else {
 				break loop // ✅ exits the for-loop
 			}
 
+		case token.CONTROL_SYMBOL:
+			switch {
+			case isLineBreak(p.lit):
+				content = append(content, p.parseLineBreak())
+			case p.atWord():
+				content = append(content, p.parseWord())
+			default:
+				content = append(content, &ast.ControlSymbol{Lit: p.lit, Pos_: p.pos, End_: p.end})
+				p.next()
+			}
+
 		default:
 			break loop // ✅ exits the for-loop on any non-text token
 		}
@@ -195,3 +449,228 @@ loop:
 		End_:    p.pos,
 	}
 }
+
+// atWord reports whether the current token can be part of a word: letters,
+// digits, dashes and quotes (ligatures like -- and “), accents like \'
+// and \c, glyph commands like \ss, and the discretionary hyphen \-.
+func (p *parser) atWord() bool {
+	switch p.tok {
+	case token.WORD, token.NUMBER, token.DASH, token.QUOTE, token.BACKQUOTE:
+		return true
+	case token.CONTROL_SYMBOL:
+		return p.lit == "-" || normalize.IsAccent(p.lit)
+	case token.COMMAND:
+		return normalize.IsAccent(p.lit) || normalize.IsGlyph(p.lit)
+	}
+	return false
+}
+
+// parseWord parses a word: a run of adjacent tokens for which atWord
+// holds, including the argument of accents (\'e, \"{o}, \c{c}). Like in
+// TeX, spaces after a control word (\ss e) do not end the word. The
+// literal of the word is its source text.
+func (p *parser) parseWord() *ast.Word {
+	w := &ast.Word{Pos_: p.pos}
+	for {
+		w.End_ = p.end
+		controlWord := p.tok == token.COMMAND
+		accent := (controlWord || p.tok == token.CONTROL_SYMBOL) && normalize.IsAccent(p.lit)
+		p.next()
+
+		if accent && p.tok == token.LBRACE && (p.pos == w.End_ || controlWord) {
+			for p.tok != token.RBRACE && p.tok != token.NEWLINE && p.tok != token.EOF {
+				p.next()
+			}
+			if p.tok != token.RBRACE {
+				break
+			}
+			w.End_ = p.end
+			p.next()
+			controlWord = false
+		}
+
+		adjacent := p.pos == w.End_ || controlWord && p.tok == token.WORD
+		if !adjacent || !p.atWord() {
+			break
+		}
+	}
+	w.Lit = p.text(w.Pos_, w.End_)
+	return w
+}
+
+// isLineBreak reports whether a CONTROL_SYMBOL literal is \\ or \\*.
+func isLineBreak(lit string) bool {
+	return lit == "\\" || lit == "\\*"
+}
+
+// parseLineBreak parses \\, \\* and their optional [length] argument.
+func (p *parser) parseLineBreak() *ast.LineBreak {
+	b := &ast.LineBreak{
+		Kind: "\\",
+		Star: p.lit == "\\*",
+		Pos_: p.pos,
+		End_: p.pos + token.Pos(1+len(p.lit)),
+	}
+	p.next()
+
+	if p.tok == token.LBRACK {
+		lbrack := p.pos
+		p.next()
+		for p.tok != token.RBRACK && p.tok != token.NEWLINE && p.tok != token.EOF {
+			b.Length += p.lit
+			p.next()
+		}
+		if p.tok != token.RBRACK {
+			p.error(lbrack, "expected ']' to close \\\\[length]")
+			return b
+		}
+		b.End_ = p.pos + 1
+		p.next()
+	}
+	return b
+}
+
+// parseEnvName parses the {name} following \begin or \end. The current
+// token must be the \begin or \end keyword; on return, the current token
+// is the closing brace. The name is returned as a mandatory argument.
+func (p *parser) parseEnvName() (*ast.Arg, bool) {
+	start, kw := p.pos, p.lit
+	p.next() // consume \begin or \end
+
+	if p.tok != token.LBRACE {
+		if kw == "end" {
+			return nil, false // \end of plain TeX, which ends the job
+		}
+		p.error(start, "expected '{' after \\"+kw)
+		return nil, false
+	}
+	arg := &ast.Arg{Kind: 'm', Present: true, LitPos: p.end, Pos_: p.pos}
+	p.next() // consume {
+
+	for p.tok != token.RBRACE && p.tok != token.LBRACE && p.tok != token.NEWLINE && p.tok != token.EOF {
+		arg.Lit += p.lit
+		p.next()
+	}
+	if p.tok != token.RBRACE {
+		p.error(p.pos, "expected '}' to close environment name")
+		return nil, false
+	}
+	arg.End_ = p.end
+	return arg, true
+}
+
+// parseBegin parses \begin{name}. For verbatim environments (see
+// Config.VerbatimEnvs) the body up to \end{name} is captured raw and
+// returned as *ast.Verbatim. For other environments only \begin{name}
+// is consumed and returned as a command named "begin"; the body follows
+// it up to the matching \end.
+func (p *parser) parseBegin() ast.Node {
+	start := p.pos
+	arg, ok := p.parseEnvName()
+	if !ok {
+		return nil
+	}
+	name := arg.Lit
+	spec, ok := p.verbatimEnvs[name]
+	if !ok {
+		p.next() // consume }
+		return &ast.Command{Name: "begin", Args: []*ast.Arg{arg}, Pos_: start, End_: arg.End_}
+	}
+
+	// The current token is the closing brace of the name, so the scanner
+	// is positioned right before the body.
+	end := "\\end{" + name + "}"
+	pos, lit, found := p.s.ScanRawUntil(end, false)
+	v := &ast.Verbatim{Env: name, Pos_: start, End_: pos + token.Pos(len(lit))}
+	v.Args, v.Content, v.ContentPos = splitVerbatimArgs(spec, lit, pos)
+	if found {
+		v.End_ += token.Pos(len(end))
+	} else {
+		p.error(start, "missing "+end)
+	}
+	p.next()
+	return v
+}
+
+// parseEnd parses \end{name} and returns it as a command named "end".
+func (p *parser) parseEnd() ast.Node {
+	start := p.pos
+	arg, ok := p.parseEnvName()
+	if !ok {
+		return nil
+	}
+	p.next() // consume }
+	return &ast.Command{Name: "end", Args: []*ast.Arg{arg}, Pos_: start, End_: arg.End_}
+}
+
+// splitVerbatimArgs splits the arguments described by spec off the raw
+// text following \begin{name}. The result has one entry per argument;
+// absent optional arguments are empty.
+func splitVerbatimArgs(spec, lit string, pos token.Pos) (args []string, content string, contentPos token.Pos) {
+	i := 0
+	for _, kind := range spec {
+		open, close := byte('['), byte(']')
+		if kind == 'm' {
+			open, close = '{', '}'
+		}
+		var arg string
+		if i < len(lit) && lit[i] == open {
+			if j := matchingDelim(lit, i, open, close); j > 0 {
+				arg = lit[i+1 : j]
+				i = j + 1
+			}
+		}
+		args = append(args, arg)
+	}
+	return args, lit[i:], pos + token.Pos(i)
+}
+
+// matchingDelim returns the index of the delimiter closing the one at
+// s[i], or -1 if it is not closed.
+func matchingDelim(s string, i int, open, close byte) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseVerb parses \verb|...| and \verb*|...|, where | stands for any
+// delimiter character that is not a letter or space.
+func (p *parser) parseVerb() *ast.Verbatim {
+	v := &ast.Verbatim{Env: "verb", Pos_: p.pos, End_: p.pos + token.Pos(len(`\verb`))}
+	if p.s.Peek() == '*' {
+		p.s.Next()
+		v.Star = true
+		v.End_++
+	}
+
+	delim := p.s.Peek()
+	switch p.s.Catcodes().Lookup(delim) {
+	case scanner.CatLetter, scanner.CatSpace, scanner.CatEndOfLine, scanner.CatInvalid:
+		p.error(v.Pos_, "missing \\verb delimiter")
+		v.ContentPos = v.End_
+		p.next()
+		return v
+	}
+	p.s.Next()
+
+	pos, lit, found := p.s.ScanRawUntil(string(delim), true)
+	v.Content, v.ContentPos = lit, pos
+	v.End_ = pos + token.Pos(len(lit))
+	if found {
+		v.End_ += token.Pos(utf8.RuneLen(delim))
+	} else {
+		p.error(v.Pos_, "\\verb not terminated before end of line")
+	}
+	p.next()
+	return v
+}
@@ -2,9 +2,13 @@ package parser
 
 import (
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/scanner"
 	"github.com/neox5/gotex/token"
 )
 
@@ -57,6 +61,7 @@ func TestWordsOnlyCompare(t *testing.T) {
 			&ast.Newline{},
 			&ast.Comment{Lit: "% using plain words and implicit layout — no macros or punctuation."},
 			&ast.Newline{},
+			&ast.Newline{},
 			&ast.Comment{Lit: "% ------------------------------------------------"},
 			&ast.Newline{},
 			&ast.Comment{Lit: "% Variant 1: Double newline (blank line)"},
@@ -68,13 +73,14 @@ func TestWordsOnlyCompare(t *testing.T) {
 			&ast.Comment{Lit: "% ------------------------------------------------"},
 			&ast.Newline{},
 
-			&ast.TextBlock{Content: []ast.TextNode{
+			&ast.Newline{},
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
 				&ast.Word{Lit: "hello"},
 				&ast.Word{Lit: "world"},
 				&ast.Newline{},
-			}},
+			}}}},
 			&ast.Newline{},
-			&ast.TextBlock{Content: []ast.TextNode{
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
 				&ast.Word{Lit: "this"},
 				&ast.Word{Lit: "is"},
 				&ast.Word{Lit: "a"},
@@ -85,7 +91,7 @@ func TestWordsOnlyCompare(t *testing.T) {
 				&ast.Word{Lit: "double"},
 				&ast.Word{Lit: "newline"},
 				&ast.Newline{},
-			}},
+			}}}},
 			&ast.Newline{},
 
 			&ast.Comment{Lit: "% ------------------------------------------------"},
@@ -98,8 +104,9 @@ func TestWordsOnlyCompare(t *testing.T) {
 			&ast.Newline{},
 			&ast.Comment{Lit: "% ------------------------------------------------"},
 			&ast.Newline{},
+			&ast.Newline{},
 
-			&ast.TextBlock{Content: []ast.TextNode{
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
 				&ast.Word{Lit: "this"},
 				&ast.Word{Lit: "is"},
 				&ast.Word{Lit: "a"},
@@ -120,7 +127,7 @@ func TestWordsOnlyCompare(t *testing.T) {
 				&ast.Word{Lit: "single"},
 				&ast.Word{Lit: "paragraph"},
 				&ast.Newline{},
-			}},
+			}}}},
 			&ast.Newline{},
 
 			&ast.Comment{Lit: "% ------------------------------------------------"},
@@ -133,15 +140,15 @@ func TestWordsOnlyCompare(t *testing.T) {
 			&ast.Newline{},
 			&ast.Comment{Lit: "% ------------------------------------------------"},
 			&ast.Newline{},
+			&ast.Newline{},
 
-			&ast.TextBlock{Content: []ast.TextNode{
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
 				&ast.Word{Lit: "this"},
 				&ast.Word{Lit: "line"},
 				&ast.Word{Lit: "ends"},
 				&ast.Word{Lit: "here"},
-				&ast.LineBreak{Kind: "newline"},
-			}},
-			&ast.TextBlock{Content: []ast.TextNode{
+				&ast.LineBreak{Kind: "\\"},
+				&ast.Newline{},
 				&ast.Word{Lit: "and"},
 				&ast.Word{Lit: "this"},
 				&ast.Word{Lit: "starts"},
@@ -149,15 +156,15 @@ func TestWordsOnlyCompare(t *testing.T) {
 				&ast.Word{Lit: "the"},
 				&ast.Word{Lit: "next"},
 				&ast.Word{Lit: "line"},
-				&ast.LineBreak{Kind: "newline"},
-			}},
-			&ast.TextBlock{Content: []ast.TextNode{
+				&ast.LineBreak{Kind: "\\"},
+				&ast.Newline{},
 				&ast.Word{Lit: "still"},
 				&ast.Word{Lit: "within"},
 				&ast.Word{Lit: "the"},
 				&ast.Word{Lit: "same"},
 				&ast.Word{Lit: "paragraph"},
-			}},
+				&ast.Newline{},
+			}}}},
 			&ast.Newline{},
 
 			&ast.Comment{Lit: "% ------------------------------------------------"},
@@ -195,3 +202,695 @@ func TestWordsOnlyCompare(t *testing.T) {
 	ast.Walk(visitor, astFile)
 	visitor.Finish()
 }
+
+func TestMakeAtLetter(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		imports []string
+		errors  int
+	}{
+		{
+			name:    "internal command",
+			src:     "\\makeatletter\\input@path{x}\\makeatother\\input{y}",
+			imports: []string{"y"},
+		},
+		{
+			name:    "group restores catcodes",
+			src:     "{\\makeatletter}\\input@path{x}",
+			imports: nil,
+			errors:  1, // \input followed by '@'
+		},
+	}
+
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		file := fset.AddFile("style.sty", fset.Base(), len(test.src))
+		f, err := Parse(fset, file, []byte(test.src), ImportsOnly)
+
+		var names []string
+		for _, imp := range f.Imports {
+			names = append(names, imp.Name)
+		}
+		if !slices.Equal(names, test.imports) {
+			t.Errorf("%s: got imports %q; want %q", test.name, names, test.imports)
+		}
+		var n int
+		if list, ok := err.(scanner.ErrorList); ok {
+			n = len(list)
+		}
+		if n != test.errors {
+			t.Errorf("%s: got %d errors (%v); want %d", test.name, n, err, test.errors)
+		}
+	}
+}
+
+// verbatimCollector collects the verbatim nodes of an AST.
+type verbatimCollector struct{ list *[]*ast.Verbatim }
+
+func (c verbatimCollector) Visit(n ast.Node) ast.Visitor {
+	if v, ok := n.(*ast.Verbatim); ok {
+		*c.list = append(*c.list, v)
+	}
+	return c
+}
+
+func TestVerbatim(t *testing.T) {
+	src := "\\begin{verbatim}\n\\input{hidden} % kept\n\\end{verbatim}\n" +
+		"\\begin{lstlisting}[language=Go]\nx := {y}\n\\end{lstlisting}\n" +
+		"\\begin{minted}{go}\nfmt.Println()\n\\end{minted}\n" +
+		"Use \\verb|\\input{x}| or \\verb*+a b+.\n" +
+		"\\input{shown}\n"
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("verb.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Imports) != 1 || f.Imports[0].Name != "shown" {
+		t.Errorf("got imports %v; want only \"shown\"", f.Imports)
+	}
+
+	file = fset.AddFile("verb.tex", fset.Base(), len(src))
+	f, err = Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*ast.Verbatim
+	ast.Walk(verbatimCollector{&got}, f)
+	want := []ast.Verbatim{
+		{Env: "verbatim", Content: "\n\\input{hidden} % kept\n"},
+		{Env: "lstlisting", Args: []string{"language=Go"}, Content: "\nx := {y}\n"},
+		{Env: "minted", Args: []string{"", "go"}, Content: "\nfmt.Println()\n"},
+		{Env: "verb", Content: "\\input{x}"},
+		{Env: "verb", Star: true, Content: "a b"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d verbatim nodes; want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Env != w.Env || g.Star != w.Star || g.Content != w.Content || !slices.Equal(g.Args, w.Args) {
+			t.Errorf("%d: got %s%v %q %q; want %s%v %q %q", i, g.Env, g.Star, g.Args, g.Content, w.Env, w.Star, w.Args, w.Content)
+		}
+		offs := int(g.ContentPos) - file.Base()
+		if src[offs:offs+len(g.Content)] != g.Content {
+			t.Errorf("%d: content position %d does not match source", i, offs)
+		}
+	}
+	if s := src[int(got[3].Pos())-file.Base() : int(got[3].End())-file.Base()]; s != "\\verb|\\input{x}|" {
+		t.Errorf("got \\verb span %q", s)
+	}
+
+	// Verbatim environments can be configured.
+	src = "\\begin{code}\\input{x}\\end{code}"
+	file = fset.AddFile("custom.tex", fset.Base(), len(src))
+	cfg := Config{Mode: ImportsOnly, VerbatimEnvs: map[string]string{"code": ""}}
+	if f, err = cfg.Parse(fset, file, []byte(src)); err != nil || len(f.Imports) != 0 {
+		t.Errorf("got imports %v, err %v; want none", f.Imports, err)
+	}
+
+	src = "\\verb|open\n\\begin{verbatim}x"
+	file = fset.AddFile("bad.tex", fset.Base(), len(src))
+	_, err = Parse(fset, file, []byte(src), ImportsOnly)
+	if list, ok := err.(scanner.ErrorList); !ok || len(list) != 2 {
+		t.Errorf("got %v; want 2 errors", err)
+	}
+}
+
+func TestLineBreaks(t *testing.T) {
+	src := "one\\\\two\\\\*three\\\\[1ex]four\\\\*[2pt]five\\newline six"
+	fset := token.NewFileSet()
+	file := fset.AddFile("breaks.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ast.File{
+		Body: []ast.Node{
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
+				&ast.Word{Lit: "one"},
+				&ast.LineBreak{Kind: "\\"},
+				&ast.Word{Lit: "two"},
+				&ast.LineBreak{Kind: "\\", Star: true},
+				&ast.Word{Lit: "three"},
+				&ast.LineBreak{Kind: "\\", Length: "1ex"},
+				&ast.Word{Lit: "four"},
+				&ast.LineBreak{Kind: "\\", Star: true, Length: "2pt"},
+				&ast.Word{Lit: "five"},
+				&ast.LineBreak{Kind: "newline"},
+				&ast.Word{Lit: "six"},
+			}}}},
+		},
+	}
+	visitor := &ast.CompareVisitor{T: t, Expected: expected}
+	ast.Walk(visitor, f)
+	visitor.Finish()
+
+	// The span of \\*[2pt] includes the optional argument.
+	tb := f.Body[0].(*ast.Paragraph).Body[0].(*ast.TextBlock)
+	b := tb.Content[7]
+	if got := src[int(b.Pos())-file.Base() : int(b.End())-file.Base()]; got != "\\\\*[2pt]" {
+		t.Errorf("got line break span %q", got)
+	}
+}
+
+func TestControlSymbols(t *testing.T) {
+	src := "5\\,kg by NASA\\@ Mr\\ Smith\\/ and caf\\'e\\\\\n\\;x"
+	fset := token.NewFileSet()
+	file := fset.AddFile("symbols.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ast.File{
+		Body: []ast.Node{
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
+				&ast.Word{Lit: "5"},
+				&ast.ControlSymbol{Lit: ","},
+				&ast.Word{Lit: "kg"},
+				&ast.Word{Lit: "by"},
+				&ast.Word{Lit: "NASA"},
+				&ast.ControlSymbol{Lit: "@"},
+				&ast.Word{Lit: "Mr"},
+				&ast.ControlSymbol{Lit: " "},
+				&ast.Word{Lit: "Smith"},
+				&ast.ControlSymbol{Lit: "/"},
+				&ast.Word{Lit: "and"},
+				&ast.Word{Lit: "caf\\'e"},
+				&ast.LineBreak{Kind: "\\"},
+				&ast.Newline{},
+				&ast.ControlSymbol{Lit: ";"},
+				&ast.Word{Lit: "x"},
+			}}}},
+		},
+	}
+	visitor := &ast.CompareVisitor{T: t, Expected: expected}
+	ast.Walk(visitor, f)
+	visitor.Finish()
+
+	tb := f.Body[0].(*ast.Paragraph).Body[0].(*ast.TextBlock)
+	if cs := tb.Content[1]; src[int(cs.Pos())-file.Base():int(cs.End())-file.Base()] != "\\," {
+		t.Errorf("got control symbol span %d-%d", cs.Pos(), cs.End())
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	src := "one two\nthree\n\n  \n\nfour\\par five\n% note\n\nsix"
+	fset := token.NewFileSet()
+	file := fset.AddFile("par.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ast.File{
+		Body: []ast.Node{
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
+				&ast.Word{Lit: "one"},
+				&ast.Word{Lit: "two"},
+				&ast.Newline{},
+				&ast.Word{Lit: "three"},
+				&ast.Newline{},
+			}}}},
+			&ast.Newline{},
+			&ast.Newline{},
+			&ast.Newline{},
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
+				&ast.Word{Lit: "four"},
+			}}}},
+			&ast.Paragraph{Body: []ast.Node{
+				&ast.TextBlock{Content: []ast.TextNode{
+					&ast.Word{Lit: "five"},
+					&ast.Newline{},
+				}},
+				&ast.Comment{Lit: "% note"},
+				&ast.Newline{},
+			}},
+			&ast.Newline{},
+			&ast.Paragraph{Body: []ast.Node{&ast.TextBlock{Content: []ast.TextNode{
+				&ast.Word{Lit: "six"},
+			}}}},
+		},
+	}
+	visitor := &ast.CompareVisitor{T: t, Expected: expected}
+	ast.Walk(visitor, f)
+	visitor.Finish()
+
+	// The \par ending a paragraph belongs to it.
+	par := f.Body[4].(*ast.Paragraph)
+	if got := src[int(par.Par)-file.Base() : int(par.End())-file.Base()]; got != "\\par" {
+		t.Errorf("got paragraph end %q", got)
+	}
+	if last := f.Body[len(f.Body)-1].(*ast.Paragraph); last.Par != token.NoPos {
+		t.Errorf("paragraph ending at EOF has Par = %d", last.Par)
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	src := `% !TEX root = ../main.tex
+%!TeX program=xelatex
+% !TEX spellcheck = de-DE
+% TEX root = not a directive
+% !TEX no value
+%gotex:ignore typography/dash
+%gotex:ignore-file commands
+%gotex:module example.com/thesis
+% gotex:ignore not a directive
+text
+`
+	want := []ast.Directive{
+		{Kind: ast.TeXRoot, Key: "root", Value: "../main.tex"},
+		{Kind: ast.TeXProgram, Key: "program", Value: "xelatex"},
+		{Kind: ast.TeXMagic, Key: "spellcheck", Value: "de-DE"},
+		{Kind: ast.GotexIgnore, Key: "ignore", Value: "typography/dash"},
+		{Kind: ast.GotexIgnore, Key: "ignore-file", Value: "commands"},
+		{Kind: ast.GotexModule, Key: "module", Value: "example.com/thesis"},
+	}
+
+	for _, mode := range []Mode{ImportsOnly, ParseFull} {
+		fset := token.NewFileSet()
+		file := fset.AddFile("sub.tex", fset.Base(), len(src))
+		f, err := Parse(fset, file, []byte(src), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(f.Directives) != len(want) {
+			t.Fatalf("mode %d: got %d directives; want %d", mode, len(f.Directives), len(want))
+		}
+		for i, w := range want {
+			d := f.Directives[i]
+			if d.Kind != w.Kind || d.Key != w.Key || d.Value != w.Value {
+				t.Errorf("mode %d: directive %d: got %+v; want %+v", mode, i, *d, w)
+			}
+		}
+		if d := f.Directive(ast.TeXRoot); d == nil || fset.Position(d.Pos()).Line != 1 {
+			t.Errorf("mode %d: got root directive %+v", mode, d)
+		}
+	}
+}
+
+func TestArgumentComments(t *testing.T) {
+	src := `\section{Intro % why
+}
+\input{ch1% the first
+}
+\newcommand{\x}[1]{% body
+#1}
+\textbf{a %gotex:ignore typography
+b}
+`
+	for _, mode := range []Mode{ImportsOnly, ParseFull} {
+		fset := token.NewFileSet()
+		file := fset.AddFile("args.tex", fset.Base(), len(src))
+		f, err := Parse(fset, file, []byte(src), mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, g := range f.Comments {
+			got = append(got, g.Text())
+		}
+		if want := []string{"why", "the first", "body", ""}; !slices.Equal(got, want) {
+			t.Errorf("mode %d: got comments %q; want %q", mode, got, want)
+		}
+		if len(f.Directives) != 1 {
+			t.Errorf("mode %d: got %d directives; want 1", mode, len(f.Directives))
+		}
+		if len(f.Imports) != 1 || f.Imports[0].Name != "ch1" {
+			t.Errorf("mode %d: got imports %v", mode, f.Imports)
+		}
+		if mode != ParseFull {
+			continue
+		}
+		n := 0
+		for _, groups := range ast.NewCommentMap(fset, f, f.Comments) {
+			n += len(groups)
+		}
+		if n != len(f.Comments) {
+			t.Errorf("comment map has %d of %d comment groups", n, len(f.Comments))
+		}
+	}
+}
+
+func TestMacroDefs(t *testing.T) {
+	src := `\newcommand{\R}{\mathbb{R}}
+\newcommand*\norm[1]{\lVert #1 \rVert}
+\renewcommand{\vec}[2][n]{<#1_1, \dots, #1_{#2}>}
+\providecommand{\R}{R}
+\DeclareRobustCommand{\email}[1]
+  {\texttt{#1}}
+\def\pair#1#2{<#1, #2>}
+\def\range#1..#2.{[#1, #2]}
+Text with \gdef\x{x} inside.
+`
+	fset := token.NewFileSet()
+	file := fset.AddFile("macros.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def := func(s string) *string { return &s }
+	want := []*ast.MacroDef{
+		{Cmd: "newcommand", Name: "R", Body: `\mathbb{R}`},
+		{Cmd: "newcommand", Star: true, Name: "norm", NArgs: 1, Body: `\lVert #1 \rVert`},
+		{Cmd: "renewcommand", Name: "vec", NArgs: 2, Default: def("n"), Body: `<#1_1, \dots, #1_{#2}>`},
+		{Cmd: "providecommand", Name: "R", Body: "R"},
+		{Cmd: "DeclareRobustCommand", Name: "email", NArgs: 1, Body: `\texttt{#1}`},
+		{Cmd: "def", Name: "pair", NArgs: 2, Params: "#1#2", Body: "<#1, #2>"},
+		{Cmd: "def", Name: "range", NArgs: 2, Params: "#1..#2.", Body: "[#1, #2]"},
+		{Cmd: "gdef", Name: "x", Body: "x"},
+	}
+	var got []*ast.MacroDef
+	ast.Inspect(f, func(n ast.Node) bool {
+		if d, ok := n.(*ast.MacroDef); ok {
+			got = append(got, d)
+		}
+		return true
+	})
+	if len(got) != len(want) {
+		t.Fatalf("got %d definitions; want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		visitor := &ast.CompareVisitor{T: t, Expected: w}
+		ast.Walk(visitor, got[i])
+		visitor.Finish()
+	}
+
+	// The body positions point into the source.
+	if d := got[1]; src[int(d.BodyPos)-file.Base():int(d.End())-file.Base()-1] != d.Body {
+		t.Errorf("body position of \\%s does not match its text", d.Name)
+	}
+
+	// Definitions at the start of a line do not start a paragraph.
+	if _, ok := f.Body[0].(*ast.MacroDef); !ok {
+		t.Errorf("got %T; want definition at top level", f.Body[0])
+	}
+
+	// \providecommand does not replace an existing definition.
+	if d := f.Macros["R"]; d == nil || d.Cmd != "newcommand" {
+		t.Errorf("got symbol R = %+v", d)
+	}
+	for _, name := range []string{"norm", "vec", "email", "pair", "range", "x"} {
+		if f.Macros[name] == nil {
+			t.Errorf("missing symbol %s", name)
+		}
+	}
+}
+
+func TestMacroDefErrors(t *testing.T) {
+	cases := []struct{ src, msg string }{
+		{`\newcommand{R}{x}`, `expected macro name after \newcommand`},
+		{`\newcommand{\R}[x]{x}`, "expected number of arguments between 0 and 9"},
+		{`\newcommand{\R}[1][a{]}`, "expected ']' to close optional argument"},
+		{`\def\R#2{x}`, "parameters must be numbered consecutively"},
+		{`\newcommand\R x`, `expected '{' to start the body of \R`},
+		{`\def\R{x`, `missing '}' to close the body of \R`},
+	}
+	for _, c := range cases {
+		fset := token.NewFileSet()
+		file := fset.AddFile("bad.tex", fset.Base(), len(c.src))
+		_, err := Parse(fset, file, []byte(c.src), ParseFull)
+		list, ok := err.(scanner.ErrorList)
+		if !ok || len(list) == 0 || list[0].Msg != c.msg {
+			t.Errorf("%s: got error %v; want %q", c.src, err, c.msg)
+		}
+	}
+}
+
+func TestMacroBodyErrors(t *testing.T) {
+	// An unclosed body yields no definition.
+	src := `\def\R{x`
+	fset := token.NewFileSet()
+	file := fset.AddFile("bad.tex", fset.Base(), len(src))
+	f, _ := Parse(fset, file, []byte(src), ParseFull)
+	if d := f.Macros["R"]; d != nil {
+		t.Errorf("got definition %+v for an unclosed body", d)
+	}
+
+	// Commands in a body change category codes when the macro is used,
+	// not when it is defined.
+	src = `\newcommand{\x}{\makeatletter \y@z`
+	file = fset.AddFile("catcodes.sty", fset.Base(), len(src))
+	p := newParser(fset, file, []byte(src))
+	if d := p.parseMacroDef(); d != nil {
+		t.Errorf("got definition %+v for an unclosed body", d)
+	}
+	if c := p.s.Catcodes().Lookup('@'); c != scanner.CatOther {
+		t.Errorf("got category %s of @ after the body; want %s", c, scanner.CatOther)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	src := `\section*{Intro} \section[Short]{Long {nested} title}
+See \ref x, \cite[p.~3][ch. 2]{knuth} and \url{http://x.org/%20#top}.
+\footnote
+  {later} \emph{a} \frac{1}2 \unknown{z}
+\item text`
+	fset := token.NewFileSet()
+	file := fset.AddFile("cmds.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arg := func(kind byte, lit string) *ast.Arg { return &ast.Arg{Kind: kind, Present: true, Lit: lit} }
+	none := func(kind byte) *ast.Arg { return &ast.Arg{Kind: kind} }
+	want := []*ast.Command{
+		{Name: "section", Args: []*ast.Arg{arg('s', ""), none('o'), arg('m', "Intro")}},
+		{Name: "section", Args: []*ast.Arg{none('s'), arg('o', "Short"), arg('m', "Long {nested} title")}},
+		{Name: "ref", Args: []*ast.Arg{arg('m', "x")}},
+		{Name: "cite", Args: []*ast.Arg{arg('o', "p.~3"), arg('o', "ch. 2"), arg('m', "knuth")}},
+		{Name: "url", Args: []*ast.Arg{arg('m', "http://x.org/%20#top")}},
+		{Name: "footnote", Args: []*ast.Arg{none('o'), arg('m', "later")}},
+		{Name: "emph", Args: []*ast.Arg{arg('m', "a")}},
+		{Name: "frac", Args: []*ast.Arg{arg('m', "1"), arg('m', "2")}},
+		{Name: "item", Args: []*ast.Arg{none('o')}},
+	}
+	var got []*ast.Command
+	ast.Inspect(f, func(n ast.Node) bool {
+		if c, ok := n.(*ast.Command); ok {
+			got = append(got, c)
+		}
+		return true
+	})
+	if len(got) != len(want) {
+		t.Fatalf("got %d commands; want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		visitor := &ast.CompareVisitor{T: t, Expected: w}
+		ast.Walk(visitor, got[i])
+		visitor.Finish()
+	}
+
+	// Positions span the command and its arguments.
+	for _, c := range got[:2] {
+		text := src[int(c.Pos())-file.Base() : int(c.End())-file.Base()]
+		if m := c.Arg(2); src[int(m.LitPos)-file.Base():int(m.End())-file.Base()-1] != m.Lit {
+			t.Errorf("argument position of %q does not match its text", text)
+		}
+		if text[len(text)-1] != '}' {
+			t.Errorf("command ends with %q", text)
+		}
+	}
+
+	// The text after a verbatim argument is parsed as usual.
+	var words []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		if w, ok := n.(*ast.Word); ok {
+			words = append(words, w.Lit)
+		}
+		return true
+	})
+	if !slices.Contains(words, "text") {
+		t.Errorf("got words %q", words)
+	}
+}
+
+func TestEnvironments(t *testing.T) {
+	src := "\\begin{figure}[h]\\end{figure} \\begin{verbatim}\\end{x}\\end{verbatim} \\end"
+	fset := token.NewFileSet()
+	file := fset.AddFile("envs.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Command:
+			got = append(got, n.Name+":"+n.Arg(0).Lit)
+			if text := src[int(n.Pos())-file.Base() : int(n.End())-file.Base()]; text != "\\"+n.Name+"{figure}" {
+				t.Errorf("\\%s spans %q", n.Name, text)
+			}
+		case *ast.Verbatim:
+			got = append(got, "verbatim")
+		}
+		return true
+	})
+	if want := "begin:figure end:figure verbatim"; strings.Join(got, " ") != want {
+		t.Errorf("got %s; want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestCommandRegistry(t *testing.T) {
+	src := `\highlight{a} \section{b}`
+	fset := token.NewFileSet()
+	file := fset.AddFile("reg.tex", fset.Base(), len(src))
+	cfg := Config{Mode: ParseFull, Commands: command.NewRegistry(&command.Signature{Name: "highlight", Args: "m"})}
+	f, err := cfg.Parse(fset, file, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		if c, ok := n.(*ast.Command); ok {
+			names = append(names, c.Name)
+		}
+		return true
+	})
+	if !slices.Equal(names, []string{"highlight"}) {
+		t.Errorf("got commands %q; want [highlight]", names)
+	}
+
+	src = "\\section\n\nText"
+	file = fset.AddFile("missing.tex", fset.Base(), len(src))
+	_, err = Parse(fset, file, []byte(src), ParseFull)
+	if list, ok := err.(scanner.ErrorList); !ok || len(list) != 1 || list[0].Msg != `missing argument of \section` {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestArgumentBody(t *testing.T) {
+	src := "\\section{A \\emph{b} {c}\n\nd} \\url{x\\y}"
+	fset := token.NewFileSet()
+	file := fset.AddFile("body.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, words []string
+	var sect *ast.Command
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Command:
+			names = append(names, n.Name)
+			if n.Name == "section" {
+				sect = n
+			}
+		case *ast.Word:
+			words = append(words, n.Lit)
+		}
+		return true
+	})
+	if !slices.Equal(names, []string{"section", "emph", "url"}) {
+		t.Errorf("got commands %q", names)
+	}
+	if !slices.Equal(words, []string{"A", "b", "c", "d"}) {
+		t.Errorf("got words %q", words)
+	}
+	if arg := sect.Args[2]; arg.Lit != "A \\emph{b} {c}\n\nd" || arg.End() != sect.End() {
+		t.Errorf("got argument %q ending at %d; want the command end %d", arg.Lit, arg.End(), sect.End())
+	}
+}
+
+func TestDocumentCommands(t *testing.T) {
+	src := `\NewDocumentCommand{\foo}{s o m O{default} D<>{x}}{body}
+\NewDocumentCommand\code{v}{\texttt{#1}}
+\foo*[a]{b}[c]<d> \foo{b} \code|%#| \code{x%}
+\RenewDocumentCommand{\foo}{m}{#1}
+\foo{a}[b]`
+	fset := token.NewFileSet()
+	file := fset.AddFile("xparse.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := f.Macros["foo"]; d == nil || d.Spec != "m" || d.NArgs != 1 {
+		t.Errorf("got definition %+v", d)
+	}
+	if d := f.Macros["code"]; d == nil || d.Spec != "v" || !d.IsDocumentCommand() {
+		t.Errorf("got definition %+v", d)
+	}
+
+	arg := func(kind byte, lit string) *ast.Arg { return &ast.Arg{Kind: kind, Present: true, Lit: lit} }
+	def := func(kind byte, lit string) *ast.Arg { return &ast.Arg{Kind: kind, Lit: lit} }
+	want := []*ast.Command{
+		{Name: "foo", Args: []*ast.Arg{arg('s', ""), arg('o', "a"), arg('m', "b"), arg('O', "c"), arg('D', "d")}},
+		{Name: "foo", Args: []*ast.Arg{def('s', ""), def('o', ""), arg('m', "b"), def('O', "default"), def('D', "x")}},
+		{Name: "code", Args: []*ast.Arg{arg('v', "%#")}},
+		{Name: "code", Args: []*ast.Arg{arg('v', "x%")}},
+		{Name: "foo", Args: []*ast.Arg{arg('m', "a")}},
+	}
+	var got []*ast.Command
+	ast.Inspect(f, func(n ast.Node) bool {
+		if c, ok := n.(*ast.Command); ok {
+			got = append(got, c)
+		}
+		return true
+	})
+	if len(got) != len(want) {
+		t.Fatalf("got %d commands; want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		visitor := &ast.CompareVisitor{T: t, Expected: w}
+		ast.Walk(visitor, got[i])
+		visitor.Finish()
+	}
+	if c := got[0]; src[int(c.End())-file.Base()-1] != '>' {
+		t.Errorf("command ends at %s", fset.Position(c.End()))
+	}
+}
+
+func TestDocumentCommandErrors(t *testing.T) {
+	cases := []struct{ src, msg string }{
+		{`\NewDocumentCommand{\R}{m e{^}}{x}`, `unsupported argument type "e"`},
+		{`\NewDocumentCommand{\R}x`, `expected argument specification of \R`},
+		{`\NewDocumentCommand{\R}{r<>}{x}\R{a}`, `missing argument of \R`},
+		{`\NewDocumentCommand{\R}{d<>}{x}\R<a`, `expected '>' to close argument`},
+		{"\\NewDocumentCommand{\\R}{v}{x}\\R|a\n|", `verbatim argument of \R not terminated before end of line`},
+	}
+	for _, c := range cases {
+		fset := token.NewFileSet()
+		file := fset.AddFile("bad.tex", fset.Base(), len(c.src))
+		_, err := Parse(fset, file, []byte(c.src), ParseFull)
+		list, ok := err.(scanner.ErrorList)
+		if !ok || len(list) == 0 || list[0].Msg != c.msg {
+			t.Errorf("%s: got error %v; want %q", c.src, err, c.msg)
+		}
+	}
+}
+
+func TestFullModeImports(t *testing.T) {
+	src := "Text \\input{chapters/one}\n\\import{layout}\n\\usemodule{theme}"
+	fset := token.NewFileSet()
+	file := fset.AddFile("main.tex", fset.Base(), len(src))
+	f, err := Parse(fset, file, []byte(src), ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, imp := range f.Imports {
+		names = append(names, imp.Cmd+":"+imp.Name)
+	}
+	if want := []string{"input:chapters/one", "import:layout", "usemodule:theme"}; !slices.Equal(names, want) {
+		t.Errorf("got imports %q; want %q", names, want)
+	}
+
+	// The imports are also nodes of the paragraph.
+	n := 0
+	ast.Inspect(f, func(node ast.Node) bool {
+		if _, ok := node.(*ast.ImportSpec); ok {
+			n++
+		}
+		return true
+	})
+	if n != len(f.Imports) {
+		t.Errorf("found %d import nodes; want %d", n, len(f.Imports))
+	}
+}
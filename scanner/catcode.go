@@ -0,0 +1,211 @@
+package scanner
+
+import (
+	"maps"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/neox5/gotex/token"
+)
+
+// Catcode is a TeX category code. It determines how the scanner treats a
+// character.
+type Catcode uint8
+
+const (
+	CatEscape      Catcode = iota // \ starts a command
+	CatBeginGroup                 // {
+	CatEndGroup                   // }
+	CatMathShift                  // $
+	CatAlignment                  // &
+	CatEndOfLine                  // line break
+	CatParameter                  // #
+	CatSuperscript                // ^
+	CatSubscript                  // _
+	CatIgnored                    // skipped by the scanner (NUL)
+	CatSpace                      // space, tab
+	CatLetter                     // letters; part of words and command names
+	CatOther                      // digits, punctuation and everything else
+	CatActive                     // ~
+	CatComment                    // % starts a comment
+	CatInvalid                    // reported as illegal (DEL)
+)
+
+var catcodeNames = [...]string{
+	CatEscape:      "escape",
+	CatBeginGroup:  "begin-group",
+	CatEndGroup:    "end-group",
+	CatMathShift:   "math-shift",
+	CatAlignment:   "alignment",
+	CatEndOfLine:   "end-of-line",
+	CatParameter:   "parameter",
+	CatSuperscript: "superscript",
+	CatSubscript:   "subscript",
+	CatIgnored:     "ignored",
+	CatSpace:       "space",
+	CatLetter:      "letter",
+	CatOther:       "other",
+	CatActive:      "active",
+	CatComment:     "comment",
+	CatInvalid:     "invalid",
+}
+
+// String returns the name of the category code.
+func (c Catcode) String() string {
+	if int(c) < len(catcodeNames) {
+		return catcodeNames[c]
+	}
+	return "catcode(" + strconv.Itoa(int(c)) + ")"
+}
+
+// catcodeTokens maps the category codes of single-character tokens to
+// their token type.
+var catcodeTokens = [...]token.Token{
+	CatBeginGroup:  token.LBRACE,
+	CatEndGroup:    token.RBRACE,
+	CatMathShift:   token.DOLLAR,
+	CatAlignment:   token.AMPERSAND,
+	CatParameter:   token.HASH,
+	CatSuperscript: token.CARET,
+	CatSubscript:   token.UNDERSCORE,
+	CatActive:      token.TILDE,
+}
+
+// standardCatcodes is the initial table for ASCII characters, as set up
+// by LaTeX.
+var standardCatcodes = func() (t [utf8.RuneSelf]Catcode) {
+	for i := range t {
+		t[i] = CatOther
+	}
+	for ch := 'a'; ch <= 'z'; ch++ {
+		t[ch] = CatLetter
+		t[ch-'a'+'A'] = CatLetter
+	}
+	t['\\'] = CatEscape
+	t['{'] = CatBeginGroup
+	t['}'] = CatEndGroup
+	t['$'] = CatMathShift
+	t['&'] = CatAlignment
+	t['\n'] = CatEndOfLine
+	t['\r'] = CatEndOfLine
+	t['#'] = CatParameter
+	t['^'] = CatSuperscript
+	t['_'] = CatSubscript
+	t[0] = CatIgnored
+	t[' '] = CatSpace
+	t['\t'] = CatSpace
+	t['~'] = CatActive
+	t['%'] = CatComment
+	t[0x7F] = CatInvalid
+	return
+}()
+
+// CatcodeTable maps characters to category codes. The zero value is not
+// ready to use; see [NewCatcodeTable] and [CatcodeTable.Reset].
+//
+// Like in TeX, changes are local to the current group: [CatcodeTable.Push]
+// opens a group and [CatcodeTable.Pop] closes it, restoring all category
+// codes changed since the matching Push.
+type CatcodeTable struct {
+	ascii [utf8.RuneSelf]Catcode
+	other map[rune]Catcode // non-ASCII overrides; others are letters if unicode.IsLetter
+
+	level int            // group nesting level
+	saved []catcodeSaved // snapshots of changed groups, innermost last
+}
+
+// catcodeSaved is the state of a table before the first change in a group.
+type catcodeSaved struct {
+	level int
+	ascii [utf8.RuneSelf]Catcode
+	other map[rune]Catcode
+}
+
+// NewCatcodeTable returns a table with the standard initial category codes.
+func NewCatcodeTable() *CatcodeTable {
+	t := new(CatcodeTable)
+	t.Reset()
+	return t
+}
+
+// Reset restores the standard initial category codes and discards all
+// open groups.
+func (t *CatcodeTable) Reset() {
+	t.ascii = standardCatcodes
+	t.other = nil
+	t.level = 0
+	t.saved = t.saved[:0]
+}
+
+// Lookup returns the category code of ch. Non-ASCII characters are
+// letters if they are Unicode letters, and other characters otherwise,
+// unless set explicitly. Negative values (such as the scanner's
+// end-of-file marker) are invalid.
+func (t *CatcodeTable) Lookup(ch rune) Catcode {
+	switch {
+	case ch < 0:
+		return CatInvalid
+	case ch < utf8.RuneSelf:
+		return t.ascii[ch]
+	}
+	if c, ok := t.other[ch]; ok {
+		return c
+	}
+	if unicode.IsLetter(ch) {
+		return CatLetter
+	}
+	return CatOther
+}
+
+// Set sets the category code of ch in the current group.
+func (t *CatcodeTable) Set(ch rune, c Catcode) {
+	if t.level > 0 {
+		if n := len(t.saved); n == 0 || t.saved[n-1].level != t.level {
+			t.saved = append(t.saved, catcodeSaved{t.level, t.ascii, maps.Clone(t.other)})
+		}
+	}
+	if 0 <= ch && ch < utf8.RuneSelf {
+		t.ascii[ch] = c
+		return
+	}
+	if t.other == nil {
+		t.other = make(map[rune]Catcode)
+	}
+	t.other[ch] = c
+}
+
+// Push opens a group.
+func (t *CatcodeTable) Push() {
+	t.level++
+}
+
+// Pop closes the innermost group, undoing the changes made within it.
+// It reports whether a group was open.
+func (t *CatcodeTable) Pop() bool {
+	if t.level == 0 {
+		return false
+	}
+	if n := len(t.saved); n > 0 && t.saved[n-1].level == t.level {
+		t.ascii, t.other = t.saved[n-1].ascii, t.saved[n-1].other
+		t.saved = t.saved[:n-1]
+	}
+	t.level--
+	return true
+}
+
+// Level returns the group nesting level.
+func (t *CatcodeTable) Level() int {
+	return t.level
+}
+
+// MakeAtLetter makes @ a letter, as \makeatletter does, so that internal
+// commands like \@internal scan as a single command.
+func (t *CatcodeTable) MakeAtLetter() {
+	t.Set('@', CatLetter)
+}
+
+// MakeAtOther makes @ an other character again, as \makeatother does.
+func (t *CatcodeTable) MakeAtOther() {
+	t.Set('@', CatOther)
+}
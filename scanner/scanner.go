@@ -3,10 +3,12 @@ package scanner
 import (
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/neox5/gotex/token"
+	"github.com/neox5/gotex/units"
 )
 
 // ErrorHandler is used to handle scanner errors
@@ -33,10 +35,32 @@ func PrintError(w io.Writer) ErrorHandler {
 	}
 }
 
+// A Mode value is a set of flags (or 0). They control scanner behavior.
+type Mode uint
+
+const (
+	// ScanDimensions makes the scanner recognize decimal numbers (3.14,
+	// .5) as NUMBER and numbers followed by a unit or length register
+	// (12pt, -3.2em, 0.5\textwidth) as DIMENSION tokens. See package
+	// units for their values.
+	ScanDimensions Mode = 1 << iota
+
+	// TrackCatcodes makes the scanner apply the category code changes of
+	// the tokens it returns, as TeX does when it executes them: { opens a
+	// group of the catcode table and } closes it, undoing the changes made
+	// within, and \makeatletter and \makeatother change the category of @.
+	// A change takes effect from the token after the one making it.
+	TrackCatcodes
+)
+
 // Scanner structure to hold scanner state
 type Scanner struct {
 	// Source
-	src []byte // source content
+	src     []byte    // source content; in reader mode a window of the input starting at srcOffs
+	srcOffs int       // offset of src[0] in the input (always 0 unless reading from r)
+	r       io.Reader // input for reader mode; nil once exhausted or when scanning a byte slice
+	keep    int       // offset of the oldest byte that must stay in src (reader mode)
+	grow    bool      // last read filled the buffer; read larger chunks (reader mode)
 
 	// Positioning
 	file     *token.File    // source file handle
@@ -44,6 +68,11 @@ type Scanner struct {
 	offset   int            // current offset in src
 	rdOffset int            // reading offset (position after current character)
 	ch       rune           // current character
+	newline  string         // first line break seen: "\n", "\r\n" or "\r"; "" if none
+
+	// Character classes
+	catcodes CatcodeTable
+	mode     Mode
 
 	// Error handling
 	errHandler ErrorHandler
@@ -56,13 +85,131 @@ func (s *Scanner) Init(fset *token.FileSet, file *token.File, src []byte, errHan
 	s.src = src
 	s.errHandler = errHandler
 
+	s.srcOffs = 0
+	s.r = nil
+	s.keep = 0
+	s.grow = false
 	s.offset = 0
 	s.rdOffset = 0
+	s.ch = 0
+	s.newline = ""
+	s.catcodes.Reset()
+	s.mode = 0
 
 	// Initialize by reading the first character
 	s.next()
 }
 
+// SetMode sets the scanning mode. Init and InitReader reset the mode to 0.
+func (s *Scanner) SetMode(mode Mode) {
+	s.mode = mode
+}
+
+// Catcodes returns the category code table consulted for every character.
+// It starts out as the standard table; changes made through it, or by the
+// scanner itself in TrackCatcodes mode, affect all characters scanned
+// afterwards.
+func (s *Scanner) Catcodes() *CatcodeTable {
+	return &s.catcodes
+}
+
+// cat returns the category code of ch.
+func (s *Scanner) cat(ch rune) Catcode {
+	return s.catcodes.Lookup(ch)
+}
+
+// Buffer sizes used in reader mode. The buffer starts small so that short
+// inputs are cheap, and doubles up to readerBufSize while the input keeps
+// filling it. Longer tokens grow it further as needed.
+const (
+	minReaderBufSize = 512
+	readerBufSize    = 64 << 10
+)
+
+// InitReader initializes or re-initializes a Scanner to read its source
+// from r. Only a sliding window of the input is kept in memory, so inputs
+// too large to load at once can be tokenized.
+//
+// Since the size of the input is not known up front, file must have been
+// added to fset with size 0 and must remain the last file of fset while
+// scanning: the scanner grows it with [token.FileSet.ExtendFile] as input
+// is read. Positions and the line table are identical to those produced
+// by [Scanner.Init] on the complete input.
+//
+// Read errors other than [io.EOF] are reported to errHandler, and the
+// input is treated as ending at that point.
+func (s *Scanner) InitReader(fset *token.FileSet, file *token.File, r io.Reader, errHandler ErrorHandler) {
+	if file.Size() != 0 {
+		panic(fmt.Sprintf("file size (%d) must be 0 in reader mode", file.Size()))
+	}
+	s.fset = fset
+	s.file = file
+	s.src = make([]byte, 0, minReaderBufSize)
+	s.errHandler = errHandler
+
+	s.srcOffs = 0
+	s.r = r
+	s.keep = 0
+	s.grow = false
+	s.offset = 0
+	s.rdOffset = 0
+	s.ch = 0
+	s.newline = ""
+	s.catcodes.Reset()
+	s.mode = 0
+
+	s.next()
+}
+
+// fill reads more input into the source window until it extends to offset
+// need or the input is exhausted. Bytes before s.keep are discarded; the
+// window grows if the current token fills it completely.
+func (s *Scanner) fill(need int) {
+	// Slide the window: drop the bytes no longer needed.
+	if d := s.keep - s.srcOffs; d > 0 {
+		s.src = s.src[:copy(s.src, s.src[d:])]
+		s.srcOffs += d
+	}
+
+	for s.r != nil && need > s.end() {
+		if len(s.src) == cap(s.src) || s.grow && cap(s.src) < readerBufSize {
+			buf := make([]byte, len(s.src), 2*cap(s.src))
+			copy(buf, s.src)
+			s.src = buf
+		}
+		free := cap(s.src) - len(s.src)
+		n, err := s.r.Read(s.src[len(s.src):cap(s.src)])
+		s.grow = n == free
+		if n > 0 {
+			s.src = s.src[:len(s.src)+n]
+			s.fset.ExtendFile(s.file, s.srcOffs+len(s.src))
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.errorf(s.srcOffs+len(s.src), "read error: %s", err)
+			}
+			s.r = nil
+		}
+	}
+}
+
+// end returns the offset just past the source read so far.
+func (s *Scanner) end() int {
+	return s.srcOffs + len(s.src)
+}
+
+// text returns the source between the offsets start and end.
+func (s *Scanner) text(start, end int) string {
+	return string(s.src[start-s.srcOffs : end-s.srcOffs])
+}
+
+// setKeep marks offs as the start of the current token: in reader mode,
+// source from offs on (and the byte before it) stays available until
+// the next token is scanned.
+func (s *Scanner) setKeep(offs int) {
+	s.keep = max(offs-1, s.srcOffs)
+}
+
 const (
 	bom = 0xFEFF // byte order mark, only permitted as very first character
 	eof = -1     // end of file
@@ -70,20 +217,22 @@ const (
 
 // next reads the next Unicode character into s.ch and updates positioning
 func (s *Scanner) next() {
-	if s.rdOffset < len(s.src) {
+	if s.r != nil && s.rdOffset+utf8.UTFMax > s.end() {
+		s.fill(s.rdOffset + utf8.UTFMax)
+	}
+	if s.rdOffset < s.end() {
 		s.offset = s.rdOffset
-		if s.ch == '\n' {
-			s.file.AddLine(s.offset)
-		}
-		r, w := rune(s.src[s.rdOffset]), 1
+		i := s.rdOffset - s.srcOffs // index of the next character in src
+		s.lineBreak(s.src[i] == '\n')
+		r, w := rune(s.src[i]), 1
 		switch {
 		case r == 0:
 			s.error(s.offset, "illegal character NUL")
 		case r >= utf8.RuneSelf:
 			// not ASCII
-			r, w = utf8.DecodeRune(s.src[s.rdOffset:])
+			r, w = utf8.DecodeRune(s.src[i:])
 			if r == utf8.RuneError && w == 1 {
-				in := s.src[s.rdOffset:]
+				in := s.src[i:]
 				if s.offset == 0 &&
 					len(in) >= 2 &&
 					(in[0] == 0xFF && in[1] == 0xFE || in[0] == 0xFE && in[1] == 0xFF) {
@@ -91,6 +240,9 @@ func (s *Scanner) next() {
 					// UCS-2 (i.e. 2-byte UTF-16). Give specific error (go.dev/issue/71950).
 					s.error(s.offset, "illegal UTF-8 encoding (got UTF-16)")
 					s.rdOffset += len(in) // consume all input to avoid error cascade
+					if s.r != nil {
+						s.drain()
+					}
 				} else {
 					s.error(s.offset, "illegal UTF-8 encoding")
 				}
@@ -101,14 +253,87 @@ func (s *Scanner) next() {
 		s.rdOffset += w
 		s.ch = r
 	} else {
-		s.offset = len(s.src)
-		if s.ch == '\n' {
-			s.file.AddLine(s.offset)
-		}
+		s.offset = s.end()
+		s.lineBreak(false)
 		s.ch = eof
 	}
 }
 
+// lineBreak records a line starting at s.offset if the previous character
+// s.ch ended a line. A line ends after LF, CR LF or a lone CR; lf reports
+// whether the character at s.offset is LF.
+func (s *Scanner) lineBreak(lf bool) {
+	switch s.ch {
+	case '\n':
+		s.file.AddLine(s.offset)
+		if s.newline == "" {
+			s.newline = "\n"
+		}
+	case '\r':
+		if lf {
+			if s.newline == "" {
+				s.newline = "\r\n"
+			}
+			return // the line ends after the LF
+		}
+		s.file.AddLine(s.offset)
+		if s.newline == "" {
+			s.newline = "\r"
+		}
+	}
+}
+
+// Newline returns the first line break sequence seen so far: "\n",
+// "\r\n" or "\r", or "" if the source scanned so far has a single line.
+// Formatters can use it to preserve the line break convention of a file.
+func (s *Scanner) Newline() string {
+	return s.newline
+}
+
+// skipNewline consumes a line break: LF, CR LF or CR. Characters made
+// end-of-line by a catcode change are consumed on their own.
+func (s *Scanner) skipNewline() {
+	cr := s.ch == '\r'
+	s.next()
+	if cr && s.ch == '\n' {
+		s.next()
+	}
+}
+
+// peek returns the byte following the most recently read character
+// without advancing the scanner. If the scanner is at EOF, peek returns 0.
+func (s *Scanner) peek() byte {
+	if s.rdOffset < s.end() {
+		return s.src[s.rdOffset-s.srcOffs]
+	}
+	return 0
+}
+
+// rewind moves the scanner back to offs, which must be at or after the
+// start of the current token, and re-reads the character there.
+func (s *Scanner) rewind(offs int) {
+	s.ch = 0 // the characters skipped back over do not end a line
+	s.rdOffset = offs
+	s.next()
+}
+
+// drain consumes the rest of the reader input without scanning it.
+func (s *Scanner) drain() {
+	n, err := io.Copy(io.Discard, s.r)
+	end := s.end() + int(n)
+	if n > 0 {
+		s.fset.ExtendFile(s.file, end)
+	}
+	if err != nil {
+		s.errorf(end, "read error: %s", err)
+	}
+	s.src = s.src[:0]
+	s.srcOffs = end
+	s.keep = end
+	s.rdOffset = end
+	s.r = nil
+}
+
 func (s *Scanner) error(offs int, msg string) {
 	if s.errHandler != nil {
 		s.errHandler(s.fset.Position(s.file.Pos(offs)), msg)
@@ -124,11 +349,67 @@ func (s *Scanner) scanComment() string {
 	offs := s.offset
 
 	// Scan to the end of the line or file
-	for s.ch != '\n' && s.ch != eof {
+	for s.ch != eof && s.cat(s.ch) != CatEndOfLine {
 		s.next()
 	}
 
-	return string(s.src[offs:s.offset])
+	lit := s.text(offs, s.offset)
+	if (offs == 0 || s.text(offs-1, offs) == "\n" || s.text(offs-1, offs) == "\r") && strings.HasPrefix(lit, linePrefix) {
+		s.updateLineInfo(offs, lit[len(linePrefix):])
+	}
+	return lit
+}
+
+const linePrefix = "%line "
+
+// updateLineInfo interprets the text of a %line directive of the form
+//
+//	%line filename:line
+//	%line filename:line:column
+//
+// starting at offs and records alternative position information for the
+// line following the directive. As in Go, a comment not ending in :N is
+// an ordinary comment, like "%line up the columns", and is ignored.
+func (s *Scanner) updateLineInfo(offs int, text string) {
+	text = strings.TrimSpace(text)
+	filename, line, ok := cutNumber(text)
+	if !ok {
+		return // not a %line directive
+	}
+	column := 1
+	if name, l, ok := cutNumber(filename); ok {
+		// filename:line:column
+		filename, column, line = name, line, l
+	}
+	if filename == "" {
+		s.error(offs, "invalid %line directive: missing file name")
+		return
+	}
+	if line <= 0 || column <= 0 {
+		s.error(offs, "invalid %line directive: line and column must be positive")
+		return
+	}
+
+	// The directive applies to the line following the comment.
+	switch {
+	case s.ch == '\r' && s.hasPrefix("\r\n"):
+		s.file.AddLineColumnInfo(s.offset+2, filename, line, column)
+	case s.ch == '\n' || s.ch == '\r':
+		s.file.AddLineColumnInfo(s.offset+1, filename, line, column)
+	}
+}
+
+// cutNumber splits text of the form "prefix:n" into prefix and n.
+func cutNumber(text string) (prefix string, n int, ok bool) {
+	i := strings.LastIndexByte(text, ':')
+	if i < 0 {
+		return text, 0, false
+	}
+	n, err := strconv.Atoi(text[i+1:])
+	if err != nil {
+		return text, 0, false
+	}
+	return text[:i], n, true
 }
 
 // scanCommand scans a TeX command sequence (\command)
@@ -137,17 +418,13 @@ func (s *Scanner) scanCommand() (token.Token, string) {
 	offs := s.offset
 
 	// Scan the command name
-	for isCommandChar(s.ch) {
+	for s.cat(s.ch) == CatLetter {
 		s.next()
 	}
 
 	// Extract the command name from source (without the \)
-	name := string(s.src[offs:s.offset])
+	name := s.text(offs, s.offset)
 
-	if name == "newline" {
-		// Normalize \newline → linebreak
-		return token.COMMAND, "linebreak"
-	}
 	// Look up keyword or return command token (fallback if no keyword)
 	return token.LookupKeyword(name), name
 }
@@ -159,20 +436,19 @@ func (s *Scanner) scanWord() string {
 loop:
 	for {
 		switch {
-		case isLetter(s.ch) || isDigit(s.ch):
+		case s.cat(s.ch) == CatLetter || isDigit(s.ch):
 			builder.WriteRune(s.ch)
 			s.next()
 
-		case s.ch == '\\':
+		case s.cat(s.ch) == CatEscape:
 			cmdOffs := s.offset // remember position before consuming '\'
 			s.next()
-			if token.IsSymbol(s.ch) {
+			if isEscapedChar(s.ch) {
 				builder.WriteRune(s.ch) // append the symbol (not the backslash)
 				s.next()
 			} else {
 				// Not a valid escape inside a word, roll back
-				s.rdOffset = cmdOffs
-				s.next() // re-read the backslash
+				s.rewind(cmdOffs) // re-read the backslash
 				break loop
 			}
 
@@ -184,6 +460,18 @@ loop:
 	return builder.String()
 }
 
+// isEscapedChar reports whether \ch prints the character ch itself, as
+// for TeX's special characters. Such escapes are part of words (AT\&T);
+// other non-letters after a backslash form control symbols, like \@,
+// which sets the space factor and prints nothing.
+func isEscapedChar(ch rune) bool {
+	switch ch {
+	case '$', '%', '&', '#', '_', '{', '}':
+		return true
+	}
+	return false
+}
+
 // scanNumber scans a number (integer only)
 func (s *Scanner) scanNumber() string {
 	offs := s.offset - 1 // -1 to include the first digit
@@ -194,92 +482,300 @@ func (s *Scanner) scanNumber() string {
 	}
 
 	// Extract the number from source
-	return string(s.src[offs:s.offset])
+	return s.text(offs, s.offset)
+}
+
+// startsNumber reports whether a decimal number, possibly signed, starts
+// at the current character.
+func (s *Scanner) startsNumber() bool {
+	switch s.ch {
+	case '+', '-':
+		return isDigit(rune(s.peek())) || s.peek() == '.'
+	case '.':
+		return isDigit(rune(s.peek()))
+	}
+	return isDigit(s.ch)
+}
+
+// scanDimension scans a decimal number and the unit or length register
+// following it (ScanDimensions mode). A number without unit is a NUMBER;
+// a sign is only part of the token if it is a DIMENSION.
+func (s *Scanner) scanDimension() (token.Token, string) {
+	offs := s.offset
+	sign := s.ch == '+' || s.ch == '-'
+	if sign {
+		s.next()
+	}
+	digits := s.scanDigits()
+	if s.ch == '.' && isDigit(rune(s.peek())) {
+		s.next()
+		digits += s.scanDigits()
+	}
+	numEnd := s.offset
+
+	if digits > 0 && s.scanUnit() {
+		return token.DIMENSION, s.text(offs, s.offset)
+	}
+	if sign {
+		// Not a dimension: the sign is a symbol on its own.
+		ch := rune(s.text(offs, offs+1)[0])
+		s.rewind(offs + 1)
+		tok := token.LookupSymbol(ch)
+		if tok == token.ILLEGAL {
+			tok = token.OTHER
+		}
+		return tok, string(ch)
+	}
+	if s.offset != numEnd {
+		s.rewind(numEnd)
+	}
+	return token.NUMBER, s.text(offs, numEnd)
+}
+
+// scanDigits consumes decimal digits and returns their number.
+func (s *Scanner) scanDigits() int {
+	n := 0
+	for isDigit(s.ch) {
+		s.next()
+		n++
+	}
+	return n
+}
+
+// scanUnit scans a unit keyword (optionally preceded by "true") or a
+// length register and reports whether it is valid. The caller rewinds
+// if it is not.
+func (s *Scanner) scanUnit() bool {
+	offs := s.offset
+	if s.cat(s.ch) == CatEscape {
+		s.next()
+		offs = s.offset
+		for s.cat(s.ch) == CatLetter {
+			s.next()
+		}
+		return units.IsRegister(s.text(offs, s.offset))
+	}
+	for s.cat(s.ch) == CatLetter {
+		s.next()
+	}
+	word := s.text(offs, s.offset)
+	if len(word) > 4 && strings.EqualFold(word[:4], "true") {
+		word = word[4:]
+	}
+	return units.Lookup(word) != units.Invalid
 }
 
 // skipWhitespace skips whitespace characters
 func (s *Scanner) skipWhitespace() bool {
 	skipped := false
-	for isSpaceChar(s.ch) {
+	for s.cat(s.ch) == CatSpace {
 		s.next()
 		skipped = true
 	}
 	return skipped
 }
 
-// Scan scans the next token and returns its position, token type, and literal string
+// Pos returns the position of the character immediately after the most
+// recently scanned token, i.e. the end of the token.
+func (s *Scanner) Pos() token.Pos {
+	return s.file.Pos(s.offset)
+}
+
+// Peek returns the character following the most recently scanned token
+// without consuming it. It returns -1 at the end of the input.
+func (s *Scanner) Peek() rune {
+	return s.ch
+}
+
+// Next consumes and returns the character returned by [Scanner.Peek].
+// Together with [Scanner.ScanRawUntil] it lets a parser take over
+// tokenization for constructs whose content is not TeX, such as the
+// delimiter of \verb.
+func (s *Scanner) Next() rune {
+	ch := s.ch
+	if ch != eof {
+		s.next()
+	}
+	return ch
+}
+
+// SkipTo consumes the raw source up to pos, which must not lie before
+// the end of the most recently scanned token. It lets a client skip
+// constructs whose content is not TeX once their extent is known, such as
+// verbatim environments found by a parser.
+func (s *Scanner) SkipTo(pos token.Pos) {
+	offs := int(pos) - s.file.Base()
+	for s.ch != eof && s.offset < offs {
+		s.next()
+	}
+}
+
+// ScanRawUntil scans the raw source starting at the next character up to
+// the first occurrence of end, which is consumed but not included in lit.
+// No characters are interpreted: backslashes, comments and braces are
+// returned as they appear in the source.
+//
+// If end is not found, lit extends to the end of the input (or, if
+// singleLine is set, to the next line break, which is not consumed), and
+// ok is false.
+func (s *Scanner) ScanRawUntil(end string, singleLine bool) (pos token.Pos, lit string, ok bool) {
+	s.setKeep(s.offset)
+	offs := s.offset
+	pos = s.file.Pos(offs)
+
+	for s.ch != eof {
+		if singleLine && s.cat(s.ch) == CatEndOfLine {
+			return pos, s.text(offs, s.offset), false
+		}
+		if s.hasPrefix(end) {
+			lit = s.text(offs, s.offset)
+			for range utf8.RuneCountInString(end) {
+				s.next()
+			}
+			return pos, lit, true
+		}
+		s.next()
+	}
+	return pos, s.text(offs, s.offset), false
+}
+
+// hasPrefix reports whether the source at the current offset starts with p.
+func (s *Scanner) hasPrefix(p string) bool {
+	if s.r != nil && s.offset+len(p) > s.end() {
+		s.fill(s.offset + len(p))
+	}
+	if s.offset+len(p) > s.end() {
+		return false
+	}
+	i := s.offset - s.srcOffs
+	return string(s.src[i:i+len(p)]) == p // no allocation
+}
+
+// Scan scans the next token and returns its position, token type, and literal string.
+// Characters are classified by their category code (see [Scanner.Catcodes]).
 func (s *Scanner) Scan() (pos token.Pos, tok token.Token, lit string) {
+	pos, tok, lit = s.scan()
+	if s.mode&TrackCatcodes != 0 {
+		s.track(tok, lit)
+	}
+	return
+}
+
+// track applies the category code changes of a token; see TrackCatcodes.
+func (s *Scanner) track(tok token.Token, lit string) {
+	switch tok {
+	case token.LBRACE:
+		s.catcodes.Push()
+	case token.RBRACE:
+		s.catcodes.Pop()
+	case token.COMMAND:
+		switch lit {
+		case "makeatletter":
+			s.catcodes.MakeAtLetter()
+		case "makeatother":
+			s.catcodes.MakeAtOther()
+		}
+	}
+}
+
+func (s *Scanner) scan() (pos token.Pos, tok token.Token, lit string) {
 	s.skipWhitespace()
+	s.setKeep(s.offset)
 	pos = s.file.Pos(s.offset)
 
-	switch ch := s.ch; {
-	case isLetter(ch):
+	ch := s.ch
+	if ch == eof {
+		tok = token.EOF
+		lit = "EOF"
+		return
+	}
+
+	switch cat := s.cat(ch); {
+	case cat == CatLetter:
 		tok = token.WORD
 		lit = s.scanWord()
 
-	case ch == '\\':
+	case cat == CatEscape:
+		offs := s.offset
 		s.next() // consume '\'
 
-		switch s.ch {
-		case '\\':
+		switch c := s.cat(s.ch); {
+		case c == CatEscape:
+			// \\ and \\* (the optional [length] is left to the parser)
 			s.next() // consume second backslash
-			tok, lit = token.COMMAND, "linebreak"
-			return
+			tok, lit = token.CONTROL_SYMBOL, "\\"
+			if s.ch == '*' {
+				s.next()
+				lit = "\\*"
+			}
 
-		default:
-			switch {
-			case isCommandChar(s.ch):
-				tok, lit = s.scanCommand()
+		case c == CatLetter:
+			tok, lit = s.scanCommand()
 
-			case token.IsSymbol(s.ch):
-				// Escaped symbol like \$ — handled as part of a word
-				s.offset-- // backtrack to include the '\'
-				tok = token.WORD
-				lit = s.scanWord()
+		case isEscapedChar(s.ch):
+			// Escaped special character like \$ — handled as part of a word
+			s.rewind(offs) // backtrack to re-read the '\'
+			tok = token.WORD
+			lit = s.scanWord()
 
-			case isSpaceChar(s.ch):
-				s.next()
-				tok, lit = token.COMMAND, "space"
+		case c == CatEndOfLine:
+			// Escaped newline (line continuation) → skip both tokens
+			s.skipNewline()
+			return s.scan() // recurse to skip and rescan
 
-			case s.ch == '\n':
-				// Escaped newline (line continuation) → skip both tokens
-				s.next()
-				return s.Scan() // recurse to skip and rescan
+		case s.ch == eof:
+			tok, lit = token.ILLEGAL, "\\"
+			s.error(offs, "escape character at end of file")
 
-			default:
-				s.next()
-				tok, lit = token.ILLEGAL, string(s.ch)
-			}
+		default:
+			// Control symbol: \ (control space), \, \' \" \- and the like
+			tok, lit = token.CONTROL_SYMBOL, string(s.ch)
+			s.next()
 		}
 
-	case ch == '\n':
-		s.next()
+	case cat == CatEndOfLine:
+		s.skipNewline()
 		tok = token.NEWLINE
 		lit = "\n"
 
+	case s.mode&ScanDimensions != 0 && s.startsNumber():
+		tok, lit = s.scanDimension()
+
 	case isDigit(ch):
 		s.next()
 		tok = token.NUMBER
 		lit = s.scanNumber()
 
-	case ch == '%':
+	case cat == CatComment:
 		tok = token.COMMENT
 		lit = s.scanComment()
 
-	case token.IsSymbol(ch):
+	case cat == CatIgnored:
+		s.next()
+		return s.scan()
+
+	case cat == CatOther:
+		// Punctuation like ( and ?, and symbols like €, are text.
 		s.next()
 		tok = token.LookupSymbol(ch)
 		lit = string(ch)
+		if tok == token.ILLEGAL {
+			tok = token.OTHER
+		}
 
-	case ch == eof:
-		tok = token.EOF
-		lit = "EOF"
+	case int(cat) < len(catcodeTokens) && catcodeTokens[cat] != token.ILLEGAL:
+		// Single-character tokens are typed by category, not by character:
+		// a character made begin-group is an LBRACE.
+		s.next()
+		tok = catcodeTokens[cat]
+		lit = string(ch)
 
 	default:
+		offs := s.offset
 		s.next()
 		tok = token.ILLEGAL
 		lit = string(ch)
-		s.error(s.offset, fmt.Sprintf("illegal character %#U", ch))
+		s.error(offs, fmt.Sprintf("illegal character %#U", ch))
 	}
 
 	return
@@ -1,7 +1,13 @@
 package scanner
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/neox5/gotex/token"
 )
@@ -93,7 +99,9 @@ func TestWordsWithEscapedSymbols(t *testing.T) {
 	expected := []tokenData{
 		{token.WORD, "foo$bar"},
 		{token.WORD, "a_b"},
-		{token.WORD, "hello@world"},
+		{token.WORD, "hello"},
+		{token.CONTROL_SYMBOL, "@"}, // space factor, not an escaped @
+		{token.WORD, "world"},
 		{token.EOF, "EOF"},
 	}
 	runScannerTest(t, src, expected, "escaped_in_words_test.tex")
@@ -103,15 +111,92 @@ func TestEscapedNewlineAndSpace(t *testing.T) {
 	src := `word1\newline word2\ word3`
 	expected := []tokenData{
 		{token.WORD, "word1"},
-		{token.COMMAND, "linebreak"},
+		{token.COMMAND, "newline"},
 		{token.WORD, "word2"},
-		{token.COMMAND, "space"},
+		{token.CONTROL_SYMBOL, " "},
 		{token.WORD, "word3"},
 		{token.EOF, "EOF"},
 	}
 	runScannerTest(t, src, expected, "escaped_commands_test.tex")
 }
 
+func TestScanControlSymbols(t *testing.T) {
+	src := `a\\b\\*[2pt] x\,y\;z\! caf\'e na\"{\i}ve \-\/ AT\&T\\`
+	expected := []tokenData{
+		{token.WORD, "a"},
+		{token.CONTROL_SYMBOL, "\\"},
+		{token.WORD, "b"},
+		{token.CONTROL_SYMBOL, "\\*"},
+		{token.LBRACK, "["},
+		{token.NUMBER, "2"},
+		{token.WORD, "pt"},
+		{token.RBRACK, "]"},
+		{token.WORD, "x"},
+		{token.CONTROL_SYMBOL, ","},
+		{token.WORD, "y"},
+		{token.CONTROL_SYMBOL, ";"},
+		{token.WORD, "z"},
+		{token.CONTROL_SYMBOL, "!"},
+		{token.WORD, "caf"},
+		{token.CONTROL_SYMBOL, "'"},
+		{token.WORD, "e"},
+		{token.WORD, "na"},
+		{token.CONTROL_SYMBOL, `"`},
+		{token.LBRACE, "{"},
+		{token.COMMAND, "i"},
+		{token.RBRACE, "}"},
+		{token.WORD, "ve"},
+		{token.CONTROL_SYMBOL, "-"},
+		{token.CONTROL_SYMBOL, "/"},
+		{token.WORD, "AT&T"},
+		{token.CONTROL_SYMBOL, "\\"},
+		{token.EOF, "EOF"},
+	}
+	runScannerTest(t, src, expected, "control_symbols_test.tex")
+}
+
+func TestScanOther(t *testing.T) {
+	src := "Is it (really) good? \"Yes\" +1 \u20ac\u2014\x7fend"
+	want := []struct {
+		tok token.Token
+		lit string
+	}{
+		{token.WORD, "Is"},
+		{token.WORD, "it"},
+		{token.OTHER, "("},
+		{token.WORD, "really"},
+		{token.OTHER, ")"},
+		{token.WORD, "good"},
+		{token.OTHER, "?"},
+		{token.OTHER, `"`},
+		{token.WORD, "Yes"},
+		{token.OTHER, `"`},
+		{token.OTHER, "+"},
+		{token.NUMBER, "1"},
+		{token.OTHER, "\u20ac"},
+		{token.OTHER, "\u2014"},
+		{token.ILLEGAL, "\x7f"},
+		{token.WORD, "end"},
+		{token.EOF, "EOF"},
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("other.tex", fset.Base(), len(src))
+	var s Scanner
+	var errs ErrorList
+	s.Init(fset, file, []byte(src), errs.Add)
+	for i, w := range want {
+		_, tok, lit := s.Scan()
+		if tok != w.tok || lit != w.lit {
+			t.Errorf("%d: got %s %q; want %s %q", i, tok, lit, w.tok, w.lit)
+		}
+	}
+	// Only the DEL character is illegal, and it is reported at its start.
+	if want := "other.tex:1:37: illegal character U+007F"; errs.Len() != 1 || errs[0].Error() != want {
+		t.Errorf("got errors %v; want %s", errs, want)
+	}
+}
+
 func TestScanCommands(t *testing.T) {
 	src := `\section{Title}
 \begin{document}
@@ -182,3 +267,489 @@ func TestScanOptionalArguments(t *testing.T) {
 
 	runScannerTest(t, src, expected, "optional_args_test.tex")
 }
+
+func TestLineDirective(t *testing.T) {
+	src := "one\n%line chapter.tex:20\ntwo\n%line other.tex:5:3\nthree\n %line ignored.tex:1\nfour"
+	fset := token.NewFileSet()
+	file := fset.AddFile("flat.tex", fset.Base(), len(src))
+	var errs ErrorList
+	var s Scanner
+	s.Init(fset, file, []byte(src), errs.Add)
+
+	want := map[string]token.Position{
+		"one":   {Filename: "flat.tex", Offset: 0, Line: 1, Column: 1},
+		"two":   {Filename: "chapter.tex", Offset: 25, Line: 20, Column: 1},
+		"three": {Filename: "other.tex", Offset: 49, Line: 5, Column: 3},
+		"four":  {Filename: "other.tex", Offset: 76, Line: 7, Column: 1},
+	}
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.WORD {
+			continue
+		}
+		if got := fset.Position(pos); got != want[lit] {
+			t.Errorf("%s: got position %v (offset %d); want %v (offset %d)", lit, got, got.Offset, want[lit], want[lit].Offset)
+		}
+	}
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestLineDirectiveComments(t *testing.T) {
+	src := "%line up the columns\none\n%line 12\ntwo\n%line :3\nthree"
+	fset := token.NewFileSet()
+	file := fset.AddFile("flat.tex", fset.Base(), len(src))
+	var errs ErrorList
+	var s Scanner
+	s.Init(fset, file, []byte(src), errs.Add)
+
+	want := map[string]int{"one": 2, "two": 4, "three": 6}
+	for _, tok := range scanAll(&s, fset) {
+		if tok.tok == token.WORD && (tok.pos.Filename != "flat.tex" || tok.pos.Line != want[tok.lit]) {
+			t.Errorf("%s: got position %v; want flat.tex:%d", tok.lit, tok.pos, want[tok.lit])
+		}
+	}
+	if want := "flat.tex:5:1: invalid %line directive: missing file name"; len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("got errors %v; want %s", errs, want)
+	}
+}
+
+type scannedToken struct {
+	pos token.Position
+	tok token.Token
+	lit string
+}
+
+func scanAll(s *Scanner, fset *token.FileSet) []scannedToken {
+	var toks []scannedToken
+	for {
+		pos, tok, lit := s.Scan()
+		toks = append(toks, scannedToken{fset.Position(pos), tok, lit})
+		if tok == token.EOF {
+			return toks
+		}
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	var b strings.Builder
+	for i := 0; b.Len() < 3*readerBufSize; i++ {
+		fmt.Fprintf(&b, "\\section{Part %d} %% comment with ünïcödé %d\n", i, i)
+		b.WriteString("Grüße, world: a\\$b \\\\ 42 [x=3cm]\n\n")
+		if i%100 == 0 {
+			b.WriteString("% " + strings.Repeat("long comment ", 1000) + "\n")
+		}
+	}
+	src := b.String()
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("bytes.tex", fset.Base(), len(src))
+	var s Scanner
+	s.Init(fset, file, []byte(src), nil)
+	want := scanAll(&s, fset)
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"plain":   func(r io.Reader) io.Reader { return r },
+		"onebyte": iotest.OneByteReader,
+		"half":    iotest.HalfReader,
+	}
+	for name, wrap := range readers {
+		rfset := token.NewFileSet()
+		rfile := rfset.AddFile("bytes.tex", rfset.Base(), 0)
+		var rs Scanner
+		rs.InitReader(rfset, rfile, wrap(strings.NewReader(src)), nil)
+		got := scanAll(&rs, rfset)
+
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d tokens; want %d", name, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: token %d: got %+v; want %+v", name, i, got[i], want[i])
+				break
+			}
+		}
+		if rfile.Size() != file.Size() {
+			t.Errorf("%s: got file size %d; want %d", name, rfile.Size(), file.Size())
+		}
+		if rfile.LineCount() != file.LineCount() {
+			t.Errorf("%s: got %d lines; want %d", name, rfile.LineCount(), file.LineCount())
+		}
+		if rfset.Base() != fset.Base() {
+			t.Errorf("%s: got file set base %d; want %d", name, rfset.Base(), fset.Base())
+		}
+	}
+}
+
+func TestScanReaderError(t *testing.T) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("broken.tex", fset.Base(), 0)
+	var errs ErrorList
+	var s Scanner
+	s.InitReader(fset, file, iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("ab cd"))), errs.Add)
+
+	toks := scanAll(&s, fset)
+	if len(toks) != 2 || toks[0].lit != "a" || toks[1].tok != token.EOF {
+		t.Errorf("got tokens %+v; want WORD \"a\" followed by EOF", toks)
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Msg, "read error") {
+		t.Errorf("got errors %v; want one read error", errs)
+	}
+}
+
+var benchSrc = []byte(`% benchmark input
+\section{Introduction}
+This is a short paragraph with \emph{some} commands, numbers like 42
+and an escaped \$ sign. It spans several lines \\ with a line break.
+
+\begin{itemize}
+\item First [x=3cm]
+\item Second % trailing comment
+\end{itemize}
+`)
+
+func BenchmarkScan(b *testing.B) {
+	b.SetBytes(int64(len(benchSrc)))
+	for b.Loop() {
+		fset := token.NewFileSet()
+		file := fset.AddFile("bench.tex", fset.Base(), len(benchSrc))
+		var s Scanner
+		s.Init(fset, file, benchSrc, nil)
+		for {
+			_, tok, _ := s.Scan()
+			if tok == token.EOF {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkScanReader(b *testing.B) {
+	b.SetBytes(int64(len(benchSrc)))
+	for b.Loop() {
+		fset := token.NewFileSet()
+		file := fset.AddFile("bench.tex", fset.Base(), 0)
+		var s Scanner
+		s.InitReader(fset, file, bytes.NewReader(benchSrc), nil)
+		for {
+			_, tok, _ := s.Scan()
+			if tok == token.EOF {
+				break
+			}
+		}
+	}
+}
+
+func TestCatcodeTable(t *testing.T) {
+	cat := NewCatcodeTable()
+	for _, c := range []struct {
+		ch   rune
+		want Catcode
+	}{
+		{'\\', CatEscape}, {'{', CatBeginGroup}, {'}', CatEndGroup},
+		{'$', CatMathShift}, {'&', CatAlignment}, {'\n', CatEndOfLine},
+		{'#', CatParameter}, {'^', CatSuperscript}, {'_', CatSubscript},
+		{0, CatIgnored}, {' ', CatSpace}, {'a', CatLetter}, {'Z', CatLetter},
+		{'ß', CatLetter}, {'@', CatOther}, {'1', CatOther}, {'→', CatOther},
+		{'~', CatActive}, {'%', CatComment}, {0x7F, CatInvalid}, {eof, CatInvalid},
+	} {
+		if got := cat.Lookup(c.ch); got != c.want {
+			t.Errorf("Lookup(%q) = %s; want %s", c.ch, got, c.want)
+		}
+	}
+
+	cat.Push()
+	cat.MakeAtLetter()
+	cat.Set('→', CatActive)
+	cat.Push()
+	cat.Set('[', CatBeginGroup)
+	if got := cat.Lookup('@'); got != CatLetter {
+		t.Errorf("nested group: Lookup('@') = %s; want letter", got)
+	}
+	cat.Pop()
+	if got := cat.Lookup('['); got != CatOther {
+		t.Errorf("after inner Pop: Lookup('[') = %s; want other", got)
+	}
+	if got := cat.Lookup('→'); got != CatActive {
+		t.Errorf("after inner Pop: Lookup('→') = %s; want active", got)
+	}
+	cat.Pop()
+	if got := cat.Lookup('@'); got != CatOther {
+		t.Errorf("after outer Pop: Lookup('@') = %s; want other", got)
+	}
+	if got := cat.Lookup('→'); got != CatOther {
+		t.Errorf("after outer Pop: Lookup('→') = %s; want other", got)
+	}
+	if cat.Pop() {
+		t.Errorf("Pop at level 0 reported an open group")
+	}
+
+	// Changes at the outermost level are permanent.
+	cat.MakeAtLetter()
+	cat.Push()
+	cat.Pop()
+	if got := cat.Lookup('@'); got != CatLetter {
+		t.Errorf("global change: Lookup('@') = %s; want letter", got)
+	}
+}
+
+func TestScanCatcodes(t *testing.T) {
+	src := `\@internal a@b [x]`
+	fset := token.NewFileSet()
+	file := fset.AddFile("catcodes.sty", fset.Base(), len(src))
+	var s Scanner
+	s.Init(fset, file, []byte(src), nil)
+
+	// With the standard table, @ is not a letter.
+	_, tok, lit := s.Scan()
+	if tok != token.CONTROL_SYMBOL || lit != "@" {
+		t.Errorf("standard table: got {%s, %q}; want control symbol \\@", tok, lit)
+	}
+
+	s.Init(fset, file, []byte(src), nil)
+	s.Catcodes().MakeAtLetter()
+	s.Catcodes().Set('[', CatBeginGroup)
+	s.Catcodes().Set(']', CatEndGroup)
+	expected := []tokenData{
+		{token.COMMAND, "@internal"},
+		{token.WORD, "a@b"},
+		{token.LBRACE, "["},
+		{token.WORD, "x"},
+		{token.RBRACE, "]"},
+		{token.EOF, "EOF"},
+	}
+	for i, exp := range expected {
+		_, tok, lit := s.Scan()
+		if tok != exp.tok || lit != exp.lit {
+			t.Errorf("token %d: got {%s, %q}; want {%s, %q}", i, tok, lit, exp.tok, exp.lit)
+		}
+	}
+}
+
+func TestTrackCatcodes(t *testing.T) {
+	src := `{\makeatletter \@a} \@b \makeatletter \@c \makeatother \@d`
+	fset := token.NewFileSet()
+	file := fset.AddFile("track.sty", fset.Base(), len(src))
+	var s Scanner
+	s.Init(fset, file, []byte(src), nil)
+	s.SetMode(TrackCatcodes)
+	expected := []tokenData{
+		{token.LBRACE, "{"},
+		{token.COMMAND, "makeatletter"},
+		{token.COMMAND, "@a"},
+		{token.RBRACE, "}"},
+		{token.CONTROL_SYMBOL, "@"}, // the group ended
+		{token.WORD, "b"},
+		{token.COMMAND, "makeatletter"},
+		{token.COMMAND, "@c"},
+		{token.COMMAND, "makeatother"},
+		{token.CONTROL_SYMBOL, "@"},
+		{token.WORD, "d"},
+		{token.EOF, "EOF"},
+	}
+	for i, exp := range expected {
+		_, tok, lit := s.Scan()
+		if tok != exp.tok || lit != exp.lit {
+			t.Errorf("token %d: got {%s, %q}; want {%s, %q}", i, tok, lit, exp.tok, exp.lit)
+		}
+	}
+	if n := s.Catcodes().Level(); n != 0 {
+		t.Errorf("got group level %d; want 0", n)
+	}
+}
+
+func TestScanRawUntil(t *testing.T) {
+	const src = "\\begin{verbatim}%not a comment\n\\input{x}\\end{verbatim}after"
+	const raw = "%not a comment\n\\input{x}"
+
+	check := func(name string, s *Scanner, fset *token.FileSet) {
+		for i := 0; i < 4; i++ { // \begin { verbatim }
+			s.Scan()
+		}
+		pos, lit, ok := s.ScanRawUntil("\\end{verbatim}", false)
+		if !ok || lit != raw {
+			t.Errorf("%s: got %q, %v; want %q, true", name, lit, ok, raw)
+		}
+		if got := fset.Position(pos).Offset; got != 16 {
+			t.Errorf("%s: got offset %d; want 16", name, got)
+		}
+		if _, tok, lit := s.Scan(); tok != token.WORD || lit != "after" {
+			t.Errorf("%s: got %s %q after raw text; want WORD \"after\"", name, tok, lit)
+		}
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("raw.tex", fset.Base(), len(src))
+	var s Scanner
+	s.Init(fset, file, []byte(src), nil)
+	check("bytes", &s, fset)
+
+	rfset := token.NewFileSet()
+	rfile := rfset.AddFile("raw.tex", rfset.Base(), 0)
+	var rs Scanner
+	rs.InitReader(rfset, rfile, iotest.OneByteReader(strings.NewReader(src)), nil)
+	check("reader", &rs, rfset)
+
+	// A single-line scan stops before the line break.
+	const line = "|a%b\nc|"
+	file = fset.AddFile("line.tex", fset.Base(), len(line))
+	s.Init(fset, file, []byte(line), nil)
+	if ch := s.Next(); ch != '|' {
+		t.Fatalf("Next() = %q; want '|'", ch)
+	}
+	if _, lit, ok := s.ScanRawUntil("|", true); ok || lit != "a%b" {
+		t.Errorf("got %q, %v; want \"a%%b\", false", lit, ok)
+	}
+	if _, tok, _ := s.Scan(); tok != token.NEWLINE {
+		t.Errorf("got %s; want NEWLINE", tok)
+	}
+}
+
+func TestSkipTo(t *testing.T) {
+	const src = "\\url{a%b\nc}\\x"
+	fset := token.NewFileSet()
+	file := fset.AddFile("skip.tex", fset.Base(), len(src))
+	var s Scanner
+	s.Init(fset, file, []byte(src), nil)
+	s.Scan() // \url
+	s.Scan() // {
+	s.SkipTo(file.Pos(len("\\url{a%b\nc")))
+	if _, tok, _ := s.Scan(); tok != token.RBRACE {
+		t.Errorf("got %s after skipped text; want RBRACE", tok)
+	}
+	pos, tok, lit := s.Scan()
+	if tok != token.COMMAND || lit != "x" || fset.Position(pos).Line != 2 {
+		t.Errorf("got %s %q at %s; want COMMAND \"x\" on line 2", tok, lit, fset.Position(pos))
+	}
+}
+
+func TestScanNewlines(t *testing.T) {
+	tests := []struct {
+		src     string
+		newline string
+		lines   []int // line of each NEWLINE token and of the final word
+	}{
+		{"a\nb\n\nc", "\n", []int{1, 2, 3, 4}},
+		{"a\r\nb\r\n\r\nc", "\r\n", []int{1, 2, 3, 4}},
+		{"a\rb\r\rc", "\r", []int{1, 2, 3, 4}},
+		{"a\r\nb\nc\rd", "\r\n", []int{1, 2, 3, 4}},
+		{"a \\\r\nb\r\nc", "\r\n", []int{2, 3}}, // line continuation
+		{"abc", "", []int{1}},
+	}
+
+	for _, test := range tests {
+		for _, reader := range []bool{false, true} {
+			fset := token.NewFileSet()
+			var s Scanner
+			var errs ErrorList
+			if reader {
+				file := fset.AddFile("nl.tex", fset.Base(), 0)
+				s.InitReader(fset, file, iotest.OneByteReader(strings.NewReader(test.src)), errs.Add)
+			} else {
+				file := fset.AddFile("nl.tex", fset.Base(), len(test.src))
+				s.Init(fset, file, []byte(test.src), errs.Add)
+			}
+
+			var lines []int
+			var last token.Position
+			for _, tok := range scanAll(&s, fset) {
+				switch tok.tok {
+				case token.NEWLINE:
+					if tok.lit != "\n" {
+						t.Errorf("%q: got NEWLINE literal %q", test.src, tok.lit)
+					}
+					lines = append(lines, tok.pos.Line)
+				case token.WORD:
+					last = tok.pos
+				}
+			}
+			lines = append(lines, last.Line)
+
+			if !slices.Equal(lines, test.lines) {
+				t.Errorf("%q (reader=%v): got lines %v; want %v", test.src, reader, lines, test.lines)
+			}
+			if s.Newline() != test.newline {
+				t.Errorf("%q (reader=%v): got newline %q; want %q", test.src, reader, s.Newline(), test.newline)
+			}
+			if last.Column != 1 && len(test.lines) > 1 {
+				t.Errorf("%q (reader=%v): got column %d for last word; want 1", test.src, reader, last.Column)
+			}
+			if errs.Len() > 0 {
+				t.Errorf("%q (reader=%v): unexpected errors %v", test.src, reader, errs)
+			}
+		}
+	}
+}
+
+func TestLineDirectiveCRLF(t *testing.T) {
+	src := "%line other.tex:10\r\nx\r\n"
+	fset := token.NewFileSet()
+	file := fset.AddFile("main.tex", fset.Base(), len(src))
+	var s Scanner
+	s.Init(fset, file, []byte(src), nil)
+
+	for _, tok := range scanAll(&s, fset) {
+		if tok.tok == token.WORD {
+			if want := "other.tex:10:1"; tok.pos.String() != want {
+				t.Errorf("got %s; want %s", tok.pos, want)
+			}
+		}
+	}
+}
+
+func TestScanDimensions(t *testing.T) {
+	const src = "12pt -3.2em .5in 1truein 0.5\\textwidth 3.14 42 1-3 2emph 3\\section 4.x +5"
+	want := []struct {
+		tok token.Token
+		lit string
+	}{
+		{token.DIMENSION, "12pt"},
+		{token.DIMENSION, "-3.2em"},
+		{token.DIMENSION, ".5in"},
+		{token.DIMENSION, "1truein"},
+		{token.DIMENSION, "0.5\\textwidth"},
+		{token.NUMBER, "3.14"},
+		{token.NUMBER, "42"},
+		{token.NUMBER, "1"},
+		{token.DASH, "-"},
+		{token.NUMBER, "3"},
+		{token.NUMBER, "2"},
+		{token.WORD, "emph"},
+		{token.NUMBER, "3"},
+		{token.COMMAND, "section"},
+		{token.NUMBER, "4"},
+		{token.PERIOD, "."},
+		{token.WORD, "x"},
+		{token.OTHER, "+"},
+		{token.NUMBER, "5"},
+		{token.EOF, "EOF"},
+	}
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("dim.tex", fset.Base(), len(src))
+	var s Scanner
+	var errs ErrorList
+	s.Init(fset, file, []byte(src), errs.Add)
+	s.SetMode(ScanDimensions)
+
+	for i, w := range want {
+		_, tok, lit := s.Scan()
+		if tok != w.tok || lit != w.lit {
+			t.Errorf("%d: got %s %q; want %s %q", i, tok, lit, w.tok, w.lit)
+		}
+	}
+	if errs.Len() != 0 {
+		t.Errorf("got errors %v; want none", errs)
+	}
+
+	// Without the mode, decimal points and units are not part of numbers.
+	s.Init(fset, file, []byte(src), nil)
+	if _, tok, lit := s.Scan(); tok != token.NUMBER || lit != "12" {
+		t.Errorf("got %s %q; want NUMBER \"12\"", tok, lit)
+	}
+}
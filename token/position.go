@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"slices"
 	"sync"
+	"unicode/utf8"
 )
 
 // Position describes a source postion inside a file.
@@ -12,7 +13,7 @@ type Position struct {
 	Filename string // file name
 	Offset   int    // offset = Pos - file.base
 	Line     int    // line number, starting at 1
-	Column   int    // column number, starting at 1 (byte count)
+	Column   int    // column number, starting at 1 (byte count, see [File.PositionRune] and [File.PositionUTF16])
 }
 
 // String returns a string in the form file:line:column.
@@ -32,9 +33,18 @@ type File struct {
 	base int    // Pos starting point for this file
 	size int    // file size; this gives Pos range of [base... base+size]
 
-	// lines is protected by mutex
+	// lines and infos are protected by mutex
 	mutex sync.Mutex
-	lines []int // lines contain the offset of the first character for each line (lines[0] always 0)
+	lines []int      // lines contain the offset of the first character for each line (lines[0] always 0)
+	infos []lineInfo // alternative position information, sorted by offset
+}
+
+// lineInfo describes alternative file, line, and column number information
+// (such as provided via a %line directive) for a given file offset.
+type lineInfo struct {
+	Offset       int
+	Filename     string
+	Line, Column int
 }
 
 // Name returns the file name of file f.
@@ -60,6 +70,9 @@ func (f *File) LineCount() int {
 	return n
 }
 
+// AddLine adds the line offset for a new line.
+// The line offset must be larger than the offset for the previous line
+// and smaller than the file size; otherwise the line offset is ignored.
 func (f *File) AddLine(offset int) {
 	f.mutex.Lock()
 	if i := len(f.lines); (i == 0 || f.lines[i-1] < offset) && offset < f.size {
@@ -68,21 +81,161 @@ func (f *File) AddLine(offset int) {
 	f.mutex.Unlock() // manual unlocking without defer, due to performance costs
 }
 
-// Position returns the [Position] value for the given file postion p.
-func (f *File) Position(p Pos) (pos Position) {
+// AddLineInfo is like [File.AddLineColumnInfo] with a column = 1 argument.
+func (f *File) AddLineInfo(offset int, filename string, line int) {
+	f.AddLineColumnInfo(offset, filename, line, 1)
+}
+
+// AddLineColumnInfo adds alternative file, line, and column number
+// information for a given file offset. The offset must be larger
+// than the offset for the previously added alternative line info
+// and smaller than the file size; otherwise the information is
+// ignored.
+//
+// AddLineColumnInfo is typically used to register alternative position
+// information for regions of generated or concatenated sources, so that
+// positions map back to the original file (see %line directives in the
+// scanner).
+func (f *File) AddLineColumnInfo(offset int, filename string, line, column int) {
+	f.mutex.Lock()
+	if i := len(f.infos); (i == 0 || f.infos[i-1].Offset < offset) && 0 <= offset && offset < f.size {
+		f.infos = append(f.infos, lineInfo{offset, filename, line, column})
+	}
+	f.mutex.Unlock()
+}
+
+// SetLinesForContent sets the line offsets for the given file content,
+// replacing any lines added so far. It is useful for tools that need
+// positions for a file that has not been scanned. Lines end after LF,
+// CR LF or a lone CR, as in the scanner.
+func (f *File) SetLinesForContent(content []byte) {
+	lines := []int{0}
+	for offset, b := range content {
+		if b == '\r' && offset+1 < len(content) && content[offset+1] == '\n' {
+			continue // the line ends after the LF
+		}
+		if (b == '\n' || b == '\r') && offset+1 < len(content) {
+			lines = append(lines, offset+1)
+		}
+	}
+
+	// set lines table
+	f.mutex.Lock()
+	f.lines = lines
+	f.mutex.Unlock()
+}
+
+// LineStart returns the [Pos] value of the start of the given line.
+// It panics if the 1-based line number is invalid.
+func (f *File) LineStart(line int) Pos {
+	if line < 1 {
+		panic(fmt.Sprintf("invalid line number %d (should be >= 1)", line))
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if line > len(f.lines) {
+		panic(fmt.Sprintf("invalid line number %d (should be < %d)", line, len(f.lines)+1))
+	}
+	return Pos(f.base + f.lines[line-1])
+}
+
+// PositionFor returns the [Position] value for the given file position p.
+// If adjusted is set, the position may be adjusted by position-altering
+// alternative line information (see [File.AddLineColumnInfo]); otherwise
+// the raw position within the file is returned.
+func (f *File) PositionFor(p Pos, adjusted bool) (pos Position) {
 	if p != NoPos {
 		if p >= Pos(f.base) && p < Pos(f.base+f.size) {
-			pos = f.position(p)
+			pos = f.positionFor(p, adjusted)
 		}
 	}
 	return
 }
 
+// Position returns the [Position] value for the given file postion p.
+// Calling f.Position(p) is equivalent to calling f.PositionFor(p, true).
+func (f *File) Position(p Pos) (pos Position) {
+	return f.PositionFor(p, true)
+}
+
 // Pos returns the Pos value for the given file offset.
 func (f *File) Pos(offset int) Pos {
 	return Pos(f.base + offset)
 }
 
+// PositionRune is like [File.Position], but the column counts Unicode code
+// points instead of bytes. src must be the content of f. Unlike
+// [File.Position], the end-of-file position is accepted, and alternative
+// line information is ignored since columns are measured in src.
+func (f *File) PositionRune(p Pos, src []byte) Position {
+	return f.positionUnits(p, src, runeLen)
+}
+
+// PositionUTF16 is like [File.Position], but the column counts UTF-16 code
+// units, as used by LSP clients and most editors. src must be the content
+// of f. Unlike [File.Position], the end-of-file position is accepted, and
+// alternative line information is ignored since columns are measured in src.
+func (f *File) PositionUTF16(p Pos, src []byte) Position {
+	return f.positionUnits(p, src, utf16Len)
+}
+
+// PosRune returns the Pos for the given 1-based line and column, where the
+// column counts Unicode code points. It is the inverse of [File.PositionRune].
+// Columns past the end of the line are clamped to the line end (the position
+// of the line break). It panics if the line number is invalid.
+func (f *File) PosRune(line, column int, src []byte) Pos {
+	return f.posUnits(line, column, src, runeLen)
+}
+
+// PosUTF16 returns the Pos for the given 1-based line and column, where the
+// column counts UTF-16 code units. It is the inverse of [File.PositionUTF16].
+// Columns past the end of the line are clamped to the line end (the position
+// of the line break). It panics if the line number is invalid.
+func (f *File) PosUTF16(line, column int, src []byte) Pos {
+	return f.posUnits(line, column, src, utf16Len)
+}
+
+func runeLen(rune) int { return 1 }
+
+// utf16Len returns the number of UTF-16 code units needed to encode r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2 // surrogate pair
+	}
+	return 1
+}
+
+// positionUnits returns the position of p with the column measured by units.
+func (f *File) positionUnits(p Pos, src []byte, units func(rune) int) (pos Position) {
+	if p == NoPos || p < Pos(f.base) || p > Pos(f.base+f.size) {
+		return
+	}
+	pos = f.position(p)
+	start := pos.Offset - (pos.Column - 1) // offset of line start
+	col := 1
+	for i := start; i < pos.Offset && i < len(src); {
+		r, w := utf8.DecodeRune(src[i:])
+		col += units(r)
+		i += w
+	}
+	pos.Column = col
+	return
+}
+
+// posUnits returns the Pos of the given line and column measured by units.
+func (f *File) posUnits(line, column int, src []byte, units func(rune) int) Pos {
+	offs := int(f.LineStart(line)) - f.base
+	for col := 1; col < column && offs < len(src) && src[offs] != '\n' && src[offs] != '\r'; {
+		r, w := utf8.DecodeRune(src[offs:])
+		col += units(r)
+		if col > column {
+			break // column points into the middle of a character
+		}
+		offs += w
+	}
+	return f.Pos(offs)
+}
+
 func (f *File) line(offset int) int {
 	f.mutex.Lock()
 	defer f.mutex.Unlock()
@@ -111,6 +264,55 @@ func (f *File) column(offset, line int) int {
 	return offset - f.lines[line] + 1 // +1 for 1-based column numbering
 }
 
+// positionFor returns the position of p, adjusted by alternative line
+// information if adjusted is set.
+func (f *File) positionFor(p Pos, adjusted bool) Position {
+	pos := f.position(p)
+	if !adjusted {
+		return pos
+	}
+
+	f.mutex.Lock()
+	i := searchLineInfos(f.infos, pos.Offset)
+	var alt lineInfo
+	if i >= 0 {
+		alt = f.infos[i]
+	}
+	f.mutex.Unlock()
+	if i < 0 {
+		return pos
+	}
+
+	if alt.Filename != "" {
+		pos.Filename = alt.Filename
+	}
+	// d is the number of lines between the position and the line info
+	d := pos.Line - (f.line(alt.Offset) + 1)
+	pos.Line = alt.Line + d
+	if alt.Column == 0 {
+		// alternative column is unknown => relative column is unknown
+		pos.Column = 0
+	} else if d == 0 {
+		// the alternative column needs to be adjusted only for the line
+		// with the position info
+		pos.Column = alt.Column + (pos.Offset - alt.Offset)
+	}
+	return pos
+}
+
+// searchLineInfos returns the index of the last line info whose offset
+// is ≤ x, or -1 if there is none.
+func searchLineInfos(a []lineInfo, x int) int {
+	i, found := slices.BinarySearchFunc(a, x, func(a lineInfo, x int) int {
+		return cmp.Compare(a.Offset, x)
+	})
+	if !found {
+		i--
+	}
+	return i
+}
+
+// position returns the raw position of p within f.
 func (f *File) position(p Pos) Position {
 	o := int(p) - f.base
 	l := f.line(o)
@@ -169,6 +371,46 @@ func (s *FileSet) AddFile(filename string, base, size int) *File {
 	return f
 }
 
+// ExtendFile grows the size of file f to size. It supports files whose
+// size is not known up front, such as input scanned from an [io.Reader]:
+// the file is added with size 0 and extended as content is read.
+//
+// f must be the last file added to s, and size must not be smaller than
+// the current size of f. ExtendFile must not be called concurrently with
+// methods of f.
+func (s *FileSet) ExtendFile(f *File, size int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if n := len(s.files); n == 0 || s.files[n-1] != f {
+		panic(fmt.Sprintf("cannot extend file %s: not the last file in the set", f.name))
+	}
+	if size < f.size {
+		panic(fmt.Sprintf("invalid size %d (should be >= %d)", size, f.size))
+	}
+	base := f.base + size + 1 // +1 because EOF also has a position
+	if base < 0 {
+		panic("token.Pos offset overflow (> 2G of source code in file set)")
+	}
+	f.size = size
+	s.base = base
+}
+
+// RemoveFile removes a file from the [FileSet] so that subsequent
+// queries for its [Pos] interval yield a negative result.
+// This reduces the memory usage of a long-lived [FileSet] that
+// encounters an unbounded stream of files, such as a language server
+// or a watch-mode build.
+//
+// Removing a file that does not belong to the set has no effect.
+func (s *FileSet) RemoveFile(file *File) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if i := searchFiles(s.files, file.base); i >= 0 && s.files[i] == file {
+		s.files = slices.Delete(s.files, i, i+1)
+	}
+}
+
 // searchFiles returns the index of the File whose base is ≤ x.
 // Assumes 'a' is sorted by base. Out-of-bounds is not checked.
 func searchFiles(a []*File, x int) int {
@@ -206,12 +448,21 @@ func (s *FileSet) File(p Pos) (f *File) {
 	return f
 }
 
-// Position converts a [Pos] p in the file set into a Position value.
-func (s *FileSet) Position(p Pos) (pos Position) {
+// PositionFor converts a [Pos] p in the fileset into a [Position] value.
+// If adjusted is set, the position may be adjusted by position-altering
+// alternative line information (see [File.AddLineColumnInfo]); otherwise
+// the raw position within the file is returned.
+func (s *FileSet) PositionFor(p Pos, adjusted bool) (pos Position) {
 	if p != NoPos {
 		if f := s.file(p); f != nil {
-			return f.position(p)
+			return f.positionFor(p, adjusted)
 		}
 	}
 	return
 }
+
+// Position converts a [Pos] p in the file set into a Position value.
+// Calling s.Position(p) is equivalent to calling s.PositionFor(p, true).
+func (s *FileSet) Position(p Pos) (pos Position) {
+	return s.PositionFor(p, true)
+}
@@ -369,3 +369,138 @@ Text here.
 			outOfBoundsPos, fset.File(outOfBoundsPos))
 	}
 }
+
+func TestPositionUnits(t *testing.T) {
+	src := []byte("Grüße\n\\emph{𝄞} x\n")
+	fset := NewFileSet()
+	f := fset.AddFile("units.tex", fset.Base(), len(src))
+	f.SetLinesForContent(src)
+
+	cases := []struct {
+		offset   int
+		line     int
+		byteCol  int
+		runeCol  int
+		utf16Col int
+	}{
+		{0, 1, 1, 1, 1},     // G
+		{4, 1, 5, 4, 4},     // ß (ü is 2 bytes)
+		{6, 1, 7, 5, 5},     // e
+		{7, 1, 8, 6, 6},     // newline
+		{8, 2, 1, 1, 1},     // \
+		{14, 2, 7, 7, 7},    // 𝄞
+		{18, 2, 11, 8, 9},   // } (𝄞 is 4 bytes, 2 UTF-16 units)
+		{20, 2, 13, 10, 11}, // x
+		{21, 2, 14, 11, 12}, // newline
+	}
+
+	for _, c := range cases {
+		p := f.Pos(c.offset)
+		if got := fset.Position(p); got.Line != c.line || got.Column != c.byteCol {
+			t.Errorf("offset %d: got byte position %d:%d; want %d:%d", c.offset, got.Line, got.Column, c.line, c.byteCol)
+		}
+		checkPos(t, fmt.Sprintf("PositionRune(offset %d)", c.offset), f.PositionRune(p, src), Position{"units.tex", c.offset, c.line, c.runeCol})
+		checkPos(t, fmt.Sprintf("PositionUTF16(offset %d)", c.offset), f.PositionUTF16(p, src), Position{"units.tex", c.offset, c.line, c.utf16Col})
+
+		if got := f.PosRune(c.line, c.runeCol, src); got != p {
+			t.Errorf("PosRune(%d, %d) = %d; want %d", c.line, c.runeCol, got, p)
+		}
+		if got := f.PosUTF16(c.line, c.utf16Col, src); got != p {
+			t.Errorf("PosUTF16(%d, %d) = %d; want %d", c.line, c.utf16Col, got, p)
+		}
+	}
+
+	// The end-of-file position is accepted.
+	checkPos(t, "PositionUTF16(EOF)", f.PositionUTF16(f.Pos(22), src), Position{"units.tex", 22, 2, 13})
+
+	// Columns past the end of the line are clamped to the line break.
+	if got, want := f.PosUTF16(1, 100, src), f.Pos(7); got != want {
+		t.Errorf("PosUTF16 past line end = %d; want %d", got, want)
+	}
+	// A column inside a surrogate pair stays before the character.
+	if got, want := f.PosUTF16(2, 8, src), f.Pos(14); got != want {
+		t.Errorf("PosUTF16 inside surrogate pair = %d; want %d", got, want)
+	}
+}
+
+func TestLineStart(t *testing.T) {
+	src := []byte("one\ntwo\n\nfour")
+	fset := NewFileSet()
+	f := fset.AddFile("lines.tex", fset.Base(), len(src))
+	f.SetLinesForContent(src)
+
+	for line, offset := range []int{0, 4, 8, 9} {
+		if got, want := f.LineStart(line+1), f.Pos(offset); got != want {
+			t.Errorf("LineStart(%d) = %d; want %d", line+1, got, want)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("LineStart(5) did not panic")
+		}
+	}()
+	f.LineStart(5)
+}
+
+func TestSetLinesForContentNewlines(t *testing.T) {
+	src := []byte("a\r\nb\rc\n\r\nd\r")
+	fset := NewFileSet()
+	f := fset.AddFile("crlf.tex", fset.Base(), len(src))
+	f.SetLinesForContent(src)
+
+	want := []int{0, 3, 5, 7, 9}
+	if f.LineCount() != len(want) {
+		t.Fatalf("got %d lines; want %d", f.LineCount(), len(want))
+	}
+	for line, offset := range want {
+		if got := f.LineStart(line + 1); got != f.Pos(offset) {
+			t.Errorf("LineStart(%d) = %d; want %d", line+1, got, f.Pos(offset))
+		}
+	}
+
+	// Columns past the end of a line stop before CR.
+	if got := f.PosRune(1, 10, src); got != f.Pos(1) {
+		t.Errorf("PosRune(1, 10) = %d; want %d", got, f.Pos(1))
+	}
+}
+
+func TestLineInfo(t *testing.T) {
+	// A flattened buffer: two lines of main.tex, followed by two lines
+	// inlined from chapter.tex (starting at line 10), followed by main.tex again.
+	src := "ab\ncd\nef\ngh\nij\n"
+	fset := NewFileSet()
+	f := fset.AddFile("flat.tex", fset.Base(), len(src))
+	f.SetLinesForContent([]byte(src))
+	f.AddLineInfo(6, "chapter.tex", 10)
+	f.AddLineColumnInfo(12, "main.tex", 3, 1)
+
+	// Line infos must be added in increasing offset order.
+	f.AddLineInfo(9, "ignored.tex", 1)
+
+	cases := []struct {
+		offset int
+		raw    Position
+		adj    Position
+	}{
+		{0, Position{"flat.tex", 0, 1, 1}, Position{"flat.tex", 0, 1, 1}},
+		{4, Position{"flat.tex", 4, 2, 2}, Position{"flat.tex", 4, 2, 2}},
+		{6, Position{"flat.tex", 6, 3, 1}, Position{"chapter.tex", 6, 10, 1}},
+		{7, Position{"flat.tex", 7, 3, 2}, Position{"chapter.tex", 7, 10, 2}},
+		{10, Position{"flat.tex", 10, 4, 2}, Position{"chapter.tex", 10, 11, 2}},
+		{13, Position{"flat.tex", 13, 5, 2}, Position{"main.tex", 13, 3, 2}},
+	}
+	for _, c := range cases {
+		p := f.Pos(c.offset)
+		checkPos(t, fmt.Sprintf("raw offset %d", c.offset), fset.PositionFor(p, false), c.raw)
+		checkPos(t, fmt.Sprintf("adjusted offset %d", c.offset), fset.PositionFor(p, true), c.adj)
+		checkPos(t, fmt.Sprintf("Position offset %d", c.offset), fset.Position(p), c.adj)
+		checkPos(t, fmt.Sprintf("File.PositionFor offset %d", c.offset), f.PositionFor(p, false), c.raw)
+	}
+
+	// Alternative line info without column information leaves the column unknown.
+	g := fset.AddFile("nocol.tex", fset.Base(), len(src))
+	g.SetLinesForContent([]byte(src))
+	g.AddLineColumnInfo(3, "gen.tex", 7, 0)
+	checkPos(t, "unknown column", fset.Position(g.Pos(4)), Position{"gen.tex", 4, 7, 0})
+}
@@ -0,0 +1,72 @@
+package token
+
+import "slices"
+
+type serializedFile struct {
+	// fields correspond 1:1 to fields with same (lower-case) name in File
+	Name  string
+	Base  int
+	Size  int
+	Lines []int
+	Infos []lineInfo
+}
+
+type serializedFileSet struct {
+	Base  int
+	Files []serializedFile
+}
+
+// Read calls decode to deserialize a file set into s; s must not be nil.
+// Files previously added to s are replaced.
+func (s *FileSet) Read(decode func(any) error) error {
+	var ss serializedFileSet
+	if err := decode(&ss); err != nil {
+		return err
+	}
+
+	files := make([]*File, len(ss.Files))
+	for i := range ss.Files {
+		f := &ss.Files[i]
+		files[i] = &File{
+			name:  f.Name,
+			base:  f.Base,
+			size:  f.Size,
+			lines: f.Lines,
+			infos: f.Infos,
+		}
+		if len(files[i].lines) == 0 {
+			files[i].lines = []int{0} // lines[0] is always 0
+		}
+	}
+
+	s.mutex.Lock()
+	s.base = ss.Base
+	s.files = files
+	s.mutex.Unlock()
+
+	return nil
+}
+
+// Write calls encode to serialize the file set s.
+func (s *FileSet) Write(encode func(any) error) error {
+	var ss serializedFileSet
+
+	s.mutex.RLock()
+	ss.Base = s.base
+	files := make([]serializedFile, len(s.files))
+	for i, f := range s.files {
+		f.mutex.Lock()
+		files[i] = serializedFile{
+			Name:  f.name,
+			Base:  f.base,
+			Size:  f.size,
+			Lines: slices.Clone(f.lines),
+			Infos: slices.Clone(f.infos),
+		}
+		f.mutex.Unlock()
+	}
+	ss.Files = files
+	s.mutex.RUnlock()
+
+	return encode(ss)
+}
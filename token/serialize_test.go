@@ -0,0 +1,176 @@
+package token
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// equal returns nil if p and q describe the same file set;
+// otherwise it returns an error describing the discrepancy.
+func equal(p, q *FileSet) error {
+	if p == q {
+		// avoid deadlock if p == q
+		return nil
+	}
+
+	// not strictly needed for the test
+	p.mutex.Lock()
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	defer p.mutex.Unlock()
+
+	if p.base != q.base {
+		return fmt.Errorf("different bases: %d != %d", p.base, q.base)
+	}
+
+	if len(p.files) != len(q.files) {
+		return fmt.Errorf("different number of files: %d != %d", len(p.files), len(q.files))
+	}
+
+	for i, f := range p.files {
+		g := q.files[i]
+		if f.name != g.name {
+			return fmt.Errorf("different filenames: %q != %q", f.name, g.name)
+		}
+		if f.base != g.base {
+			return fmt.Errorf("different base for %q: %d != %d", f.name, f.base, g.base)
+		}
+		if f.size != g.size {
+			return fmt.Errorf("different size for %q: %d != %d", f.name, f.size, g.size)
+		}
+		for j, l := range f.lines {
+			m := g.lines[j]
+			if l != m {
+				return fmt.Errorf("different offsets for %q", f.name)
+			}
+		}
+		for j, l := range f.infos {
+			m := g.infos[j]
+			if l != m {
+				return fmt.Errorf("different infos for %q", f.name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkSerialize(t *testing.T, p *FileSet) {
+	t.Helper()
+
+	// gob round trip
+	var buf bytes.Buffer
+	if err := p.Write(gob.NewEncoder(&buf).Encode); err != nil {
+		t.Errorf("gob write failed: %s", err)
+		return
+	}
+	q := NewFileSet()
+	if err := q.Read(gob.NewDecoder(&buf).Decode); err != nil {
+		t.Errorf("gob read failed: %s", err)
+		return
+	}
+	if err := equal(p, q); err != nil {
+		t.Errorf("gob round trip failed: %s", err)
+	}
+
+	// json round trip
+	buf.Reset()
+	if err := p.Write(json.NewEncoder(&buf).Encode); err != nil {
+		t.Errorf("json write failed: %s", err)
+		return
+	}
+	q = NewFileSet()
+	if err := q.Read(json.NewDecoder(&buf).Decode); err != nil {
+		t.Errorf("json read failed: %s", err)
+		return
+	}
+	if err := equal(p, q); err != nil {
+		t.Errorf("json round trip failed: %s", err)
+	}
+}
+
+func TestSerialization(t *testing.T) {
+	p := NewFileSet()
+	checkSerialize(t, p)
+	// add some files
+	for i := 0; i < 10; i++ {
+		f := p.AddFile(fmt.Sprintf("file%d.tex", i), p.Base()+i, i*100)
+		checkSerialize(t, p)
+		// add some lines and alternative file infos
+		line := 1000
+		for offs := 0; offs < f.Size(); offs += 40 + i {
+			f.AddLine(offs)
+			if offs%7 == 0 {
+				f.AddLineInfo(offs, fmt.Sprintf("file%d.tex", offs), line)
+				line += 33
+			}
+		}
+		checkSerialize(t, p)
+	}
+}
+
+func TestSerializedPositions(t *testing.T) {
+	src := []byte("\\section{Intro}\nText\n%line other.tex:5\nmore\n")
+	p := NewFileSet()
+	f := p.AddFile("main.tex", p.Base(), len(src))
+	f.SetLinesForContent(src)
+	f.AddLineInfo(37, "other.tex", 5)
+
+	var buf bytes.Buffer
+	if err := p.Write(gob.NewEncoder(&buf).Encode); err != nil {
+		t.Fatal(err)
+	}
+	q := NewFileSet()
+	if err := q.Read(gob.NewDecoder(&buf).Decode); err != nil {
+		t.Fatal(err)
+	}
+
+	// Positions recorded before serialization resolve identically afterwards.
+	for offs := 0; offs <= len(src); offs++ {
+		pos := f.Pos(offs)
+		if got, want := q.Position(pos), p.Position(pos); got != want {
+			t.Errorf("offset %d: got %v; want %v", offs, got, want)
+		}
+	}
+	if got, want := q.Base(), p.Base(); got != want {
+		t.Errorf("got base %d; want %d", got, want)
+	}
+}
+
+func TestRemoveFile(t *testing.T) {
+	fset := NewFileSet()
+	a := fset.AddFile("a.tex", fset.Base(), 10)
+	b := fset.AddFile("b.tex", fset.Base(), 10)
+	c := fset.AddFile("c.tex", fset.Base(), 10)
+
+	fset.RemoveFile(b)
+	if got := fset.File(b.Pos(3)); got != nil {
+		t.Errorf("removed file still found: %v", got.Name())
+	}
+	if got := fset.File(a.Pos(3)); got != a {
+		t.Errorf("a.tex not found after removing b.tex")
+	}
+	if got := fset.File(c.Pos(3)); got != c {
+		t.Errorf("c.tex not found after removing b.tex")
+	}
+	if got := fset.Position(b.Pos(3)); got != (Position{}) {
+		t.Errorf("got position %v for removed file; want invalid", got)
+	}
+
+	// Removing again or removing a foreign file has no effect.
+	fset.RemoveFile(b)
+	other := NewFileSet().AddFile("x.tex", fset.Base(), 10)
+	fset.RemoveFile(other)
+	if got := fset.File(a.Pos(0)); got != a {
+		t.Errorf("a.tex not found after removing unknown files")
+	}
+
+	// The base does not shrink, so new files never reuse removed positions.
+	d := fset.AddFile("d.tex", fset.Base(), 10)
+	if d.Base() <= c.Base() {
+		t.Errorf("new file base %d overlaps removed range", d.Base())
+	}
+}
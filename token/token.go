@@ -9,11 +9,14 @@ const (
 
 	// Content
 	WORD       // Alphabetic sequences (e.g., "Hello", "article")
-	NUMBER     // Numeric sequences (e.g., "123", "42")
+	NUMBER     // Numeric sequences (e.g., "123", "42"; "3.14" in dimension mode)
+	DIMENSION  // Numbers with a unit or length register (e.g., "12pt", "-3.2em", "0.5\textwidth")
 	WHITESPACE // Space (0x20), tab (0x09)
 	NEWLINE    // Line breaks (LF: 0x0A for Unix/Linux, CRLF: 0x0D0A for Windows, CR: 0x0D for classic Mac)
+	OTHER      // Other characters without a token of their own (e.g., "(", "?", "€")
 
-	COMMAND // \documentclass, \begin, \end, etc.
+	COMMAND        // \documentclass, \begin, \end, etc.
+	CONTROL_SYMBOL // Backslash and a non-letter, e.g. \, \' or \\ (literal without the backslash; \\* is "\*")
 
 	keywords_beg
 	IMPORT // \import
@@ -50,6 +53,8 @@ const (
 	TILDE      // ~
 	PIPE       // |
 	AT         // @
+	QUOTE      // '
+	BACKQUOTE  // `
 	symbols_end
 )
 
@@ -61,10 +66,13 @@ var tokens = [...]string{
 
 	WORD:       "WORD",
 	NUMBER:     "NUMBER",
+	DIMENSION:  "DIMENSION",
 	WHITESPACE: "WHITESPACE",
 	NEWLINE:    "NEWLINE",
+	OTHER:      "OTHER",
 
-	COMMAND: "COMMAND",
+	COMMAND:        "COMMAND",
+	CONTROL_SYMBOL: "CONTROL_SYMBOL",
 
 	IMPORT: "import",
 	ENV:    "begin",
@@ -101,6 +109,8 @@ var tokens = [...]string{
 	TILDE:      "~",
 	PIPE:       "|",
 	AT:         "@",
+	QUOTE:      "'",
+	BACKQUOTE:  "`",
 }
 
 // Map to store keywords
@@ -0,0 +1,260 @@
+// Package units parses the numbers and dimensions of TeX sources, such as
+// 12pt, -3.2em or 0.5\textwidth, into typed values.
+//
+// The literals accepted are those of the scanner's [token.NUMBER] and
+// [token.DIMENSION] tokens when scanning with the ScanDimensions mode.
+package units
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Unit is the unit of a dimension.
+type Unit int
+
+const (
+	Invalid Unit = iota
+
+	// Absolute units
+	Pt // point, 1/72.27 in
+	Pc // pica, 12 pt
+	In // inch, 72.27 pt
+	Bp // big point, 1/72 in
+	Cm // centimeter
+	Mm // millimeter
+	Dd // didot point, 1238/1157 pt
+	Cc // cicero, 12 dd
+	Sp // scaled point, 1/65536 pt
+
+	// Font-relative units
+	Em // width of a quad in the current font
+	Ex // x-height of the current font
+	Mu // math unit, 1/18 em in math mode
+
+	// Register is a multiple of a length register, as in 0.5\textwidth.
+	Register
+)
+
+var unitNames = [...]string{
+	Invalid:  "invalid",
+	Pt:       "pt",
+	Pc:       "pc",
+	In:       "in",
+	Bp:       "bp",
+	Cm:       "cm",
+	Mm:       "mm",
+	Dd:       "dd",
+	Cc:       "cc",
+	Sp:       "sp",
+	Em:       "em",
+	Ex:       "ex",
+	Mu:       "mu",
+	Register: "register",
+}
+
+// String returns the TeX keyword of the unit.
+func (u Unit) String() string {
+	if 0 <= u && int(u) < len(unitNames) {
+		return unitNames[u]
+	}
+	return "unit(" + strconv.Itoa(int(u)) + ")"
+}
+
+// IsAbsolute reports whether u has a fixed size, independent of fonts
+// and layout.
+func (u Unit) IsAbsolute() bool { return Pt <= u && u <= Sp }
+
+// points is the size of the absolute units in TeX points.
+var points = [...]float64{
+	Pt: 1,
+	Pc: 12,
+	In: 72.27,
+	Bp: 72.27 / 72,
+	Cm: 72.27 / 2.54,
+	Mm: 72.27 / 25.4,
+	Dd: 1238.0 / 1157,
+	Cc: 12 * 1238.0 / 1157,
+	Sp: 1.0 / 65536,
+}
+
+// Lookup returns the unit with the given keyword, or Invalid. Like in
+// TeX, keywords are not case-sensitive.
+func Lookup(keyword string) Unit {
+	if len(keyword) != 2 {
+		return Invalid
+	}
+	keyword = strings.ToLower(keyword)
+	for u := Pt; u < Register; u++ {
+		if unitNames[u] == keyword {
+			return u
+		}
+	}
+	return Invalid
+}
+
+// registers lists the LaTeX length registers that may follow a factor.
+var registers = map[string]bool{
+	"textwidth":          true,
+	"textheight":         true,
+	"linewidth":          true,
+	"columnwidth":        true,
+	"columnsep":          true,
+	"paperwidth":         true,
+	"paperheight":        true,
+	"hsize":              true,
+	"vsize":              true,
+	"baselineskip":       true,
+	"parindent":          true,
+	"parskip":            true,
+	"unitlength":         true,
+	"marginparwidth":     true,
+	"tabcolsep":          true,
+	"arraycolsep":        true,
+	"fboxsep":            true,
+	"fboxrule":           true,
+	"topmargin":          true,
+	"oddsidemargin":      true,
+	"evensidemargin":     true,
+	"headheight":         true,
+	"headsep":            true,
+	"footskip":           true,
+	"itemsep":            true,
+	"leftmargin":         true,
+	"labelwidth":         true,
+	"abovedisplayskip":   true,
+	"belowdisplayskip":   true,
+	"normalbaselineskip": true,
+}
+
+// IsRegister reports whether name (without backslash) is a known length
+// register.
+func IsRegister(name string) bool { return registers[name] }
+
+// A Dimen is a parsed dimension.
+type Dimen struct {
+	Value    float64 // factor, e.g. 0.5 in 0.5\textwidth
+	Unit     Unit
+	Register string // register name without backslash if Unit is Register
+	True     bool   // true dimension (12truept), unaffected by \mag
+}
+
+// String returns the dimension in TeX syntax.
+func (d Dimen) String() string {
+	v := strconv.FormatFloat(d.Value, 'f', -1, 64)
+	switch {
+	case d.Unit == Register:
+		return v + "\\" + d.Register
+	case d.True:
+		return v + "true" + d.Unit.String()
+	}
+	return v + d.Unit.String()
+}
+
+// Points returns the size of d in TeX points. The result is only known
+// for absolute units; ok is false otherwise.
+func (d Dimen) Points() (pt float64, ok bool) {
+	if !d.Unit.IsAbsolute() {
+		return 0, false
+	}
+	return d.Value * points[d.Unit], true
+}
+
+// ScaledPoints returns the size of d in scaled points, rounded like TeX
+// rounds dimensions to its internal representation. The result is only
+// known for absolute units; ok is false otherwise.
+func (d Dimen) ScaledPoints() (sp int64, ok bool) {
+	pt, ok := d.Points()
+	if !ok {
+		return 0, false
+	}
+	return int64(math.Round(pt * 65536)), true
+}
+
+var (
+	errSyntax = errors.New("invalid number syntax")
+	errUnit   = errors.New("missing or unknown unit")
+)
+
+// ParseNumber parses a NUMBER literal: an optional sign followed by
+// digits with an optional decimal part, such as 42, -3.25 or .5.
+func ParseNumber(lit string) (float64, error) {
+	n, rest := cutNumber(lit)
+	if n == "" || rest != "" {
+		return 0, &Error{lit, errSyntax}
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0, &Error{lit, errSyntax}
+	}
+	return v, nil
+}
+
+// Parse parses a DIMENSION literal: a number followed by a unit keyword,
+// optionally preceded by "true", or by a length register, such as 12pt,
+// -3.2em, 1truein or 0.5\textwidth.
+func Parse(lit string) (Dimen, error) {
+	n, rest := cutNumber(lit)
+	if n == "" {
+		return Dimen{}, &Error{lit, errSyntax}
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return Dimen{}, &Error{lit, errSyntax}
+	}
+	d := Dimen{Value: v}
+
+	if name, ok := strings.CutPrefix(rest, "\\"); ok {
+		if name == "" {
+			return Dimen{}, &Error{lit, errUnit}
+		}
+		d.Unit, d.Register = Register, name
+		return d, nil
+	}
+	if len(rest) > 4 && strings.EqualFold(rest[:4], "true") {
+		d.True = true
+		rest = rest[4:]
+	}
+	if d.Unit = Lookup(rest); d.Unit == Invalid {
+		return Dimen{}, &Error{lit, errUnit}
+	}
+	return d, nil
+}
+
+// cutNumber splits lit into a leading number and the rest.
+func cutNumber(lit string) (number, rest string) {
+	i := 0
+	if i < len(lit) && (lit[i] == '+' || lit[i] == '-') {
+		i++
+	}
+	digits := 0
+	for ; i < len(lit) && isDigit(lit[i]); i++ {
+		digits++
+	}
+	if i < len(lit) && lit[i] == '.' {
+		i++
+		for ; i < len(lit) && isDigit(lit[i]); i++ {
+			digits++
+		}
+	}
+	if digits == 0 {
+		return "", lit
+	}
+	return lit[:i], lit[i:]
+}
+
+func isDigit(b byte) bool { return '0' <= b && b <= '9' }
+
+// An Error records a literal that could not be parsed.
+type Error struct {
+	Lit string
+	Err error
+}
+
+func (e *Error) Error() string {
+	return "units: parsing " + strconv.Quote(e.Lit) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
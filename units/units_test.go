@@ -0,0 +1,69 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want Dimen
+		pt   float64 // NaN if not absolute
+	}{
+		{"12pt", Dimen{Value: 12, Unit: Pt}, 12},
+		{"-3.2em", Dimen{Value: -3.2, Unit: Em}, math.NaN()},
+		{".5in", Dimen{Value: 0.5, Unit: In}, 36.135},
+		{"+1PT", Dimen{Value: 1, Unit: Pt}, 1},
+		{"2.54cm", Dimen{Value: 2.54, Unit: Cm}, 72.27},
+		{"72bp", Dimen{Value: 72, Unit: Bp}, 72.27},
+		{"1truein", Dimen{Value: 1, Unit: In, True: true}, 72.27},
+		{"65536sp", Dimen{Value: 65536, Unit: Sp}, 1},
+		{"0.5\\textwidth", Dimen{Value: 0.5, Unit: Register, Register: "textwidth"}, math.NaN()},
+	}
+	for _, test := range tests {
+		d, err := Parse(test.lit)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.lit, err)
+			continue
+		}
+		if d != test.want {
+			t.Errorf("Parse(%q) = %+v; want %+v", test.lit, d, test.want)
+		}
+		pt, ok := d.Points()
+		if ok == math.IsNaN(test.pt) || ok && math.Abs(pt-test.pt) > 1e-9 {
+			t.Errorf("Parse(%q).Points() = %v, %v; want %v", test.lit, pt, ok, test.pt)
+		}
+	}
+
+	for _, lit := range []string{"", "pt", "12", "12px", "12\\", ".em", "1.2.3pt"} {
+		if _, err := Parse(lit); err == nil {
+			t.Errorf("Parse(%q) succeeded; want error", lit)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	for lit, want := range map[string]float64{"42": 42, "-3.25": -3.25, ".5": 0.5, "+7": 7} {
+		if got, err := ParseNumber(lit); err != nil || got != want {
+			t.Errorf("ParseNumber(%q) = %v, %v; want %v", lit, got, err, want)
+		}
+	}
+	_, err := ParseNumber("12pt")
+	if !errors.Is(err, errSyntax) {
+		t.Errorf("ParseNumber(\"12pt\") error = %v; want syntax error", err)
+	}
+}
+
+func TestScaledPoints(t *testing.T) {
+	if sp, ok := (Dimen{Value: 1, Unit: Pt}).ScaledPoints(); !ok || sp != 65536 {
+		t.Errorf("1pt = %dsp, %v; want 65536sp", sp, ok)
+	}
+	if _, ok := (Dimen{Value: 1, Unit: Ex}).ScaledPoints(); ok {
+		t.Errorf("1ex has a size in scaled points")
+	}
+	if got := (Dimen{Value: 1.5, Unit: Mm, True: true}).String(); got != "1.5truemm" {
+		t.Errorf("String() = %q", got)
+	}
+}
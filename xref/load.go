@@ -0,0 +1,52 @@
+package xref
+
+import (
+	"github.com/neox5/gotex/loader"
+	"github.com/neox5/gotex/outline"
+	"github.com/neox5/gotex/token"
+)
+
+// A Loader builds the index of a document spread over several files,
+// which it loads with a [loader.Loader].
+type Loader struct {
+	Fset *token.FileSet
+
+	// ReadFile reads the named file. If nil, os.ReadFile is used.
+	ReadFile func(name string) ([]byte, error)
+}
+
+// Load returns the index of the document whose main file is filename.
+// Included files are resolved as described in package loader.
+//
+// Files that cannot be read or parsed are reported in a
+// [scanner.ErrorList] sorted by source position; the index of the
+// remaining files is returned nonetheless.
+func (l *Loader) Load(filename string) (*Index, error) {
+	ll := &loader.Loader{Fset: l.Fset, ReadFile: l.ReadFile}
+	doc, err := ll.Load(filename)
+	if doc == nil {
+		return nil, err
+	}
+	x := NewIndex(l.Fset)
+	x.AddDocument(doc)
+	return x, err
+}
+
+// AddDocument adds the files of doc, which must be parsed in full, to
+// the index. Each file is added once, so that a file included twice does
+// not define its labels twice. Labels before the first section of an
+// included file belong to the section including it.
+func (x *Index) AddDocument(doc *loader.Document) {
+	added := make(map[*loader.File]bool)
+	var add func(f *loader.File, outer *outline.Section)
+	add = func(f *loader.File, outer *outline.Section) {
+		added[f] = true
+		sections := x.addFile(f.AST, f.File, f.Src, outer)
+		for _, inc := range f.Includes {
+			if !added[inc.File] {
+				add(inc.File, enclosing(sections, inc.Spec.Pos(), outer))
+			}
+		}
+	}
+	add(doc.Main(), nil)
+}
@@ -0,0 +1,294 @@
+// Package xref indexes the cross references of gotex documents: the
+// labels defined with \label, the references to them made with \ref,
+// \eqref, \pageref and the like, the citations made with \cite and its
+// variants, and the bibliography files named by \bibliography and
+// \addbibresource. Which commands these are is told by the command
+// registry (see [command.Xref]), so modules may declare their own.
+//
+// An [Index] records, for each label, the environment and section it
+// appears in, and reports undefined references, duplicate labels and
+// labels that are never referenced. It also answers the queries of an
+// editor: what is at a position, where a label is referenced, and which
+// edits rename it. A [Loader] builds the index of a document spread over
+// several files.
+package xref
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/neox5/gotex/ast"
+	"github.com/neox5/gotex/command"
+	"github.com/neox5/gotex/outline"
+	"github.com/neox5/gotex/token"
+)
+
+// A Label is a label defined with \label.
+type Label struct {
+	Name     string
+	Pos, End token.Pos        // span of the name, without braces
+	Cmd      token.Pos        // position of \label
+	Env      string           // innermost enclosing environment, like "figure" or "equation", or ""
+	Section  *outline.Section // innermost enclosing section, or nil
+}
+
+// A Ref is a reference to a label, a citation of a bibliography entry, or
+// a bibliography file named by \bibliography or \addbibresource.
+type Ref struct {
+	Cmd      string    // command without backslash, like "ref" or "cite"
+	Name     string    // label, citation key or file name as written
+	Pos, End token.Pos // span of the name
+
+	kind command.Xref
+}
+
+// IsCite reports whether r is a citation.
+func (r *Ref) IsCite() bool {
+	return r.kind == command.Cite
+}
+
+// An Index holds the labels, references and citations of a document.
+type Index struct {
+	Fset   *token.FileSet
+	Labels []*Label // in the order the files were added, each in source order
+	Refs   []*Ref   // references to labels
+	Cites  []*Ref   // citations; \nocite{*} is recorded with the name "*"
+	Bibs   []*Ref   // bibliography files
+
+	// Commands tells the role of commands in cross references (see
+	// command.Xref). If nil, command.Default() is used.
+	Commands *command.Registry
+
+	labels map[string][]*Label
+	refs   map[string][]*Ref
+}
+
+// NewIndex returns an empty index.
+func NewIndex(fset *token.FileSet) *Index {
+	return &Index{
+		Fset:   fset,
+		labels: make(map[string][]*Label),
+		refs:   make(map[string][]*Ref),
+	}
+}
+
+// AddFile adds the labels, references and citations of f. The source must
+// be the one f was parsed from in full mode, and file its token.File.
+// Only the commands in f are indexed, so verbatim text and the bodies of
+// macro definitions are ignored.
+func (x *Index) AddFile(f *ast.File, file *token.File, src []byte) {
+	x.addFile(f, file, src, nil)
+}
+
+// addFile adds f; labels before the first section of f belong to outer.
+func (x *Index) addFile(f *ast.File, file *token.File, src []byte, outer *outline.Section) []*outline.Section {
+	commands := x.Commands
+	if commands == nil {
+		commands = command.Default()
+	}
+	sections := outline.Scan(file, src)
+	var envs []string // enclosing environments
+	ast.Inspect(f, func(n ast.Node) bool {
+		c, ok := n.(*ast.Command)
+		if !ok {
+			return true
+		}
+		switch c.Name {
+		case "begin":
+			envs = append(envs, c.Arg(0).Lit)
+		case "end":
+			if i := slices.Index(envs, c.Arg(0).Lit); i >= 0 {
+				envs = envs[:i] // unclosed inner environments end too
+			}
+		}
+		if sig := commands.Lookup(c.Name); sig != nil && sig.Xref != command.NoXref {
+			env := ""
+			if len(envs) > 0 {
+				env = envs[len(envs)-1]
+			}
+			x.addCommand(c, sig.Xref, env, enclosing(sections, c.Pos(), outer))
+		}
+		return true
+	})
+	return sections
+}
+
+// addCommand adds the names of a label, reference, citation or
+// bibliography command of the given kind. Stars and optional arguments,
+// like the page of \cite[p.~3]{key}, are ignored.
+func (x *Index) addCommand(c *ast.Command, kind command.Xref, env string, section *outline.Section) {
+	var arg *ast.Arg // last mandatory argument
+	for _, a := range c.Args {
+		if a.Kind == 'm' {
+			arg = a
+		}
+	}
+	if arg == nil || !arg.Present || strings.ContainsAny(arg.Lit, "{}") {
+		return
+	}
+	offs := 0
+	for _, name := range strings.Split(arg.Lit, ",") {
+		pos := arg.LitPos + token.Pos(offs+len(name)-len(strings.TrimLeft(name, " \t\r\n")))
+		offs += len(name) + 1
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		end := pos + token.Pos(len(name))
+		if kind == command.Label {
+			x.addLabel(&Label{Name: name, Pos: pos, End: end, Cmd: c.Pos(), Env: env, Section: section})
+			break // a label has a single name
+		}
+		x.addRef(&Ref{Cmd: c.Name, Name: name, Pos: pos, End: end, kind: kind})
+	}
+}
+
+func (x *Index) addLabel(l *Label) {
+	x.Labels = append(x.Labels, l)
+	x.labels[l.Name] = append(x.labels[l.Name], l)
+}
+
+func (x *Index) addRef(r *Ref) {
+	switch {
+	case r.kind == command.Cite:
+		x.Cites = append(x.Cites, r)
+		return
+	case r.kind == command.Bib:
+		x.Bibs = append(x.Bibs, r)
+		return
+	}
+	x.Refs = append(x.Refs, r)
+	x.refs[r.Name] = append(x.refs[r.Name], r)
+}
+
+// Lookup returns the definitions of the label name; more than one is an
+// error.
+func (x *Index) Lookup(name string) []*Label {
+	return x.labels[name]
+}
+
+// References returns the references to the label name.
+func (x *Index) References(name string) []*Ref {
+	return x.refs[name]
+}
+
+// At returns the label or reference whose name spans pos, if any. The end
+// of a name counts as part of it, as for a cursor placed after the name.
+func (x *Index) At(pos token.Pos) (*Label, *Ref) {
+	for _, l := range x.Labels {
+		if l.Pos <= pos && pos <= l.End {
+			return l, nil
+		}
+	}
+	for _, refs := range [][]*Ref{x.Refs, x.Cites} {
+		for _, r := range refs {
+			if r.Pos <= pos && pos <= r.End {
+				return nil, r
+			}
+		}
+	}
+	return nil, nil
+}
+
+// An Edit replaces the source between Pos and End by NewText.
+type Edit struct {
+	Pos, End token.Pos
+	NewText  string
+}
+
+// Rename returns the edits renaming the label name to newName in its
+// definitions and references, in the order of the index. It is an error
+// if newName is not a valid label or already in use.
+func (x *Index) Rename(name, newName string) ([]Edit, error) {
+	if newName == "" || strings.ContainsAny(newName, "{}[],#%\\ \t\r\n") {
+		return nil, fmt.Errorf("invalid label %q", newName)
+	}
+	if len(x.labels[newName]) > 0 || len(x.refs[newName]) > 0 {
+		return nil, fmt.Errorf("label %q already exists", newName)
+	}
+	var edits []Edit
+	for _, l := range x.labels[name] {
+		edits = append(edits, Edit{l.Pos, l.End, newName})
+	}
+	for _, r := range x.refs[name] {
+		edits = append(edits, Edit{r.Pos, r.End, newName})
+	}
+	return edits, nil
+}
+
+// ProblemKind classifies the problems found by [Index.Check].
+type ProblemKind int
+
+const (
+	Undefined ProblemKind = iota // reference to a label that is not defined
+	Duplicate                    // label defined more than once
+	Unused                       // label never referenced
+)
+
+var problemNames = [...]string{
+	Undefined: "undefined",
+	Duplicate: "duplicate",
+	Unused:    "unused",
+}
+
+func (k ProblemKind) String() string {
+	if 0 <= k && int(k) < len(problemNames) {
+		return problemNames[k]
+	}
+	return fmt.Sprintf("ProblemKind(%d)", int(k))
+}
+
+// A Problem is an undefined reference, a duplicate or an unused label.
+type Problem struct {
+	Kind ProblemKind
+	Name string // label
+	Pos  token.Position
+	Msg  string
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Pos, p.Msg)
+}
+
+// Check returns the problems of the index sorted by position.
+func (x *Index) Check() []*Problem {
+	var problems []*Problem
+	add := func(kind ProblemKind, name string, pos token.Pos, msg string) {
+		problems = append(problems, &Problem{Kind: kind, Name: name, Pos: x.Fset.Position(pos), Msg: msg})
+	}
+	for _, r := range x.Refs {
+		if len(x.labels[r.Name]) == 0 {
+			add(Undefined, r.Name, r.Pos, fmt.Sprintf("undefined reference to label %q", r.Name))
+		}
+	}
+	for _, l := range x.Labels {
+		defs := x.labels[l.Name]
+		switch {
+		case defs[0] != l:
+			add(Duplicate, l.Name, l.Pos, fmt.Sprintf("duplicate label %q (first defined at %s)", l.Name, x.Fset.Position(defs[0].Pos)))
+		case len(x.refs[l.Name]) == 0:
+			add(Unused, l.Name, l.Pos, fmt.Sprintf("label %q is never referenced", l.Name))
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Pos, problems[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return problems
+}
+
+// enclosing returns the innermost of the sections enclosing pos, or outer
+// if there is none. It is the last one starting before pos, since a
+// section extends to the next one of the same or a lower level.
+func enclosing(sections []*outline.Section, pos token.Pos, outer *outline.Section) *outline.Section {
+	i := sort.Search(len(sections), func(i int) bool { return sections[i].Pos > pos })
+	if i == 0 {
+		return outer
+	}
+	return sections[i-1]
+}
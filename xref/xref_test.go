@@ -0,0 +1,190 @@
+package xref
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neox5/gotex/parser"
+	"github.com/neox5/gotex/scanner"
+	"github.com/neox5/gotex/token"
+)
+
+func TestIndex(t *testing.T) {
+	src := `\section{Intro}\label{sec:intro}
+See \ref{fig:plot}, \eqref{eq:euler} and \cref{sec:intro, sec:missing}.
+\begin{figure}
+  \caption{A plot\label{fig:plot}}
+\end{figure}
+\subsection{Math}
+\begin{equation}
+  e^{i\pi} = -1 \label{ eq:euler }
+\end{equation}
+\label{unused} \label{sec:intro}
+\cite[p.~3]{knuth, lamport} \nocite{*}
+\citealp{a} \Parencite[see][]{b} \Textcite{c} \Autocite*{d}
+\bibliography{refs, more}
+\begin{verbatim}\label{verb}\end{verbatim}
+\newcommand{\fig}[1]{\label{fig:#1}}`
+	fset := token.NewFileSet()
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	f, err := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := NewIndex(fset)
+	x.AddFile(f, file, []byte(src))
+
+	type label struct{ name, env, section string }
+	want := []label{
+		{"sec:intro", "", "Intro"},
+		{"fig:plot", "figure", "Intro"},
+		{"eq:euler", "equation", "Math"},
+		{"unused", "", "Math"},
+		{"sec:intro", "", "Math"},
+	}
+	if len(x.Labels) != len(want) {
+		t.Fatalf("got %d labels; want %d", len(x.Labels), len(want))
+	}
+	for i, l := range x.Labels {
+		got := label{l.Name, l.Env, ""}
+		if l.Section != nil {
+			got.section = l.Section.Title
+		}
+		if got != want[i] {
+			t.Errorf("label %d: got %+v; want %+v", i, got, want[i])
+		}
+		if text := src[int(l.Pos)-file.Base() : int(l.End)-file.Base()]; text != l.Name {
+			t.Errorf("label %q spans %q", l.Name, text)
+		}
+	}
+
+	var refs, cites []string
+	for _, r := range x.Refs {
+		refs = append(refs, r.Cmd+":"+r.Name)
+	}
+	for _, r := range x.Cites {
+		cites = append(cites, r.Name)
+	}
+	if got := strings.Join(refs, " "); got != "ref:fig:plot eqref:eq:euler cref:sec:intro cref:sec:missing" {
+		t.Errorf("got references %s", got)
+	}
+	if got := strings.Join(cites, " "); got != "knuth lamport * a b c d" {
+		t.Errorf("got citations %s", got)
+	}
+
+	var bibs []string
+	for _, r := range x.Bibs {
+		bibs = append(bibs, r.Cmd+":"+r.Name)
+	}
+	if got := strings.Join(bibs, " "); got != "bibliography:refs bibliography:more" {
+		t.Errorf("got bibliographies %s", got)
+	}
+
+	var problems []string
+	for _, p := range x.Check() {
+		problems = append(problems, p.Kind.String()+" "+p.Error())
+	}
+	wantProblems := []string{
+		`undefined doc.tex:2:59: undefined reference to label "sec:missing"`,
+		`unused doc.tex:10:8: label "unused" is never referenced`,
+		`duplicate doc.tex:10:23: duplicate label "sec:intro" (first defined at doc.tex:1:23)`,
+	}
+	if strings.Join(problems, "\n") != strings.Join(wantProblems, "\n") {
+		t.Errorf("got problems\n%s\nwant\n%s", strings.Join(problems, "\n"), strings.Join(wantProblems, "\n"))
+	}
+}
+
+func TestEditorQueries(t *testing.T) {
+	src := `\label{a} \ref{a} \pageref{a} \ref{b} \cite{c}`
+	fset := token.NewFileSet()
+	file := fset.AddFile("doc.tex", fset.Base(), len(src))
+	f, _ := parser.Parse(fset, file, []byte(src), parser.ParseFull)
+	x := NewIndex(fset)
+	x.AddFile(f, file, []byte(src))
+	pos := func(offs int) token.Pos { return file.Pos(offs) }
+
+	if l, r := x.At(pos(7)); l == nil || l.Name != "a" || r != nil {
+		t.Errorf("At label: got %v, %v", l, r)
+	}
+	if l, r := x.At(pos(16)); r == nil || r.Cmd != "ref" || l != nil {
+		t.Errorf("At end of reference: got %v, %v", l, r)
+	}
+	if l, r := x.At(pos(45)); r == nil || !r.IsCite() || l != nil {
+		t.Errorf("At citation: got %v, %v", l, r)
+	}
+	if l, r := x.At(pos(0)); l != nil || r != nil {
+		t.Errorf("At command: got %v, %v", l, r)
+	}
+	if got := len(x.References("a")); got != 2 {
+		t.Errorf("got %d references to a; want 2", got)
+	}
+
+	edits, err := x.Rename("a", "sec:a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := []byte(src)
+	for i := len(edits) - 1; i >= 0; i-- {
+		// The edits are in source order within a file.
+		e := edits[i]
+		start, end := int(e.Pos)-file.Base(), int(e.End)-file.Base()
+		out = append(out[:start], append([]byte(e.NewText), out[end:]...)...)
+	}
+	if got, want := string(out), `\label{sec:a} \ref{sec:a} \pageref{sec:a} \ref{b} \cite{c}`; got != want {
+		t.Errorf("renamed:\n%s\nwant\n%s", got, want)
+	}
+	if _, err := x.Rename("a", "b"); err == nil {
+		t.Error("renaming to a referenced label succeeded")
+	}
+	if _, err := x.Rename("a", "x y"); err == nil {
+		t.Error("renaming to an invalid label succeeded")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := filepath.FromSlash("/doc")
+	files := map[string]string{
+		"main.tex": `\chapter{One}\label{one}
+\input{chapters/two}
+\input{chapters/two}
+\include{missing}
+\ref{two} \ref{one} \ref{inner}
+`,
+		"chapters/two.tex": `\label{inner}
+\chapter{Two}\label{two}
+\input{main}
+`,
+	}
+	l := &Loader{
+		Fset: token.NewFileSet(),
+		ReadFile: func(name string) ([]byte, error) {
+			rel, err := filepath.Rel(dir, name)
+			if err != nil {
+				return nil, err
+			}
+			if data, ok := files[filepath.ToSlash(rel)]; ok {
+				return []byte(data), nil
+			}
+			return nil, fs.ErrNotExist
+		},
+	}
+	x, err := l.Load(filepath.Join(dir, "main.tex"))
+
+	var labels []string
+	for _, l := range x.Labels {
+		labels = append(labels, l.Name+"@"+l.Section.Title)
+	}
+	if got := strings.Join(labels, " "); got != "one@One inner@One two@Two" {
+		t.Errorf("got labels %s", got)
+	}
+	if problems := x.Check(); len(problems) != 0 {
+		t.Errorf("got problems %v", problems)
+	}
+
+	errs, ok := err.(scanner.ErrorList)
+	if !ok || len(errs) != 1 || errs[0].Msg != `cannot find file "missing"` || errs[0].Pos.Line != 4 {
+		t.Errorf("got error %v", err)
+	}
+}